@@ -2,19 +2,35 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
+	"io"
+	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 
+	"crawler/pkg/auth"
+	"crawler/pkg/credentials"
 	"crawler/pkg/handler"
+	"crawler/pkg/logging"
+	"crawler/pkg/metrics"
+	"crawler/pkg/model"
+	"crawler/pkg/notify"
+	"crawler/pkg/robots"
+	"crawler/pkg/secrets"
 	"crawler/pkg/store"
+	"crawler/pkg/store/compress"
 	"crawler/pkg/store/memory"
 	redis_db "crawler/pkg/store/redis"
+	"crawler/pkg/stream"
+	"crawler/pkg/tracing"
 	"crawler/pkg/util"
 )
 
@@ -22,29 +38,90 @@ const (
 	defaultLimit = 1024 * 256
 	redisEnvVar  = "REDIS_URL"
 	portEnvVar   = "PORT"
+
+	secretEnvPrefix        = "CRAWLER_SECRET_"
+	serviceSecretEnvPrefix = "CRAWLER_SERVICE_SECRET_"
 )
 
 func main() {
-	port := os.Getenv(portEnvVar)
-	if port == "" {
-		log.Fatalf("%s variable not set", portEnvVar)
-	}
-
-	var limit int
+	var (
+		logLevel     string
+		limit        int
+		userAgent    string
+		ignoreRobots bool
+		robotsTTL    time.Duration
+		secretsDir   string
+		serviceDir   string
+		compression  int
+		webhooksFile string
+		tenantsFile  string
+		apiKeysFile  string
+		jwtSecretRef string
+		jwksFile     string
+		jwtIssuer    string
+		jwtAudience  string
+		traceFile    string
+	)
 
+	flag.StringVar(&logLevel, "log-level", logging.LevelInfo.String(), "minimum level of logged entries: debug, info, warn or error")
 	flag.IntVar(&limit, "limit", defaultLimit, "payload limit")
+	flag.StringVar(&userAgent, "user-agent", handler.DefaultUserAgent, "User-Agent sent with fetches, its product token is matched against robots.txt")
+	flag.BoolVar(&ignoreRobots, "ignore-robots", false, "do not honour robots.txt of fetched hosts")
+	flag.DurationVar(&robotsTTL, "robots-ttl", robots.DefaultTTL, "how long fetched robots.txt files are cached, failed fetches are retried after at most a minute")
+	flag.StringVar(&secretsDir, "secrets-dir", "", "directory with secret files referenced by task auth and webhooks, tenants' in tenants/<tenant> (default: "+secretEnvPrefix+"* env vars)")
+	flag.StringVar(&serviceDir, "service-secrets-dir", "", "directory with the secret files of API keys and the JWT secret, tasks cannot reference them (default: "+serviceSecretEnvPrefix+"* env vars)")
+	flag.IntVar(&compression, "compress-threshold", compress.DefaultThreshold, "compress stored responses of at least this many bytes (0 disables compression)")
+	flag.StringVar(&webhooksFile, "webhooks", "", "JSON file with webhooks notified about events of all tasks")
+	flag.StringVar(&tenantsFile, "tenants", "", "JSON file with the tenants and their quotas, requests name their tenant in the "+handler.TenantHeader+" header")
+	flag.StringVar(&apiKeysFile, "api-keys", "", "JSON file with the API keys, their roles and tenants, keys are referenced service secrets")
+	flag.StringVar(&jwtSecretRef, "jwt-secret-ref", "", "service secret verifying HS256 signed JWTs")
+	flag.StringVar(&jwksFile, "jwks", "", "JWKS file with the RSA keys verifying RS256 signed JWTs")
+	flag.StringVar(&jwtIssuer, "jwt-issuer", "", "required iss claim of JWTs")
+	flag.StringVar(&jwtAudience, "jwt-audience", "", "required aud claim of JWTs")
+	flag.StringVar(&traceFile, "trace-file", "", "file finished trace spans are appended to as JSON lines, - for stdout (default: no tracing)")
 	flag.Parse()
 
+	level, err := logging.ParseLevel(logLevel)
+	if err != nil {
+		log.Fatalf("parsing log level failed: %s", err)
+	}
+
+	logger := logging.New(os.Stderr, level)
+	logging.SetDefault(logger)
+
+	// entries of the standard logger are written as info entries
+	log.SetFlags(0)
+	log.SetOutput(logger.Writer(logging.LevelInfo))
+
+	if traceFile != "" {
+		spans, err := openTraceFile(traceFile)
+		if err != nil {
+			logger.Fatal("opening trace file failed", "error", err)
+		}
+
+		defer util.MustClose(spans)
+
+		tracing.Install(tracing.NewProvider(tracing.NewWriterExporter(spans)))
+	}
+
+	port := os.Getenv(portEnvVar)
+	if port == "" {
+		logger.Fatal("port variable not set", "variable", portEnvVar)
+	}
+
 	var storage store.Store
 
+	broadcaster := stream.NewBroadcaster()
+	var publisher stream.Publisher = broadcaster
+
 	redisUrl := os.Getenv(redisEnvVar)
 	if len(redisUrl) == 0 {
-		log.Printf("'%s' env var not set, using in-mem Store", redisEnvVar)
-		storage = memory.NewMemory()
+		logger.Info("redis url not set, using in-mem store", "variable", redisEnvVar)
+		storage = memory.NewMemory(memory.WithCompression(compression))
 	} else {
 		opts, err := redis.ParseURL(redisUrl)
 		if err != nil {
-			log.Fatalf("parsing redis url failed: %s", err)
+			logger.Fatal("parsing redis url failed", "error", err)
 		}
 
 		rdb := redis.NewClient(opts)
@@ -54,27 +131,199 @@ func main() {
 
 		err = util.RedisConnect(ctx, rdb)
 		if err != nil {
-			log.Fatalf("timeout waiting for redis: %s", err)
+			logger.Fatal("timeout waiting for redis", "error", err)
 		}
 
 		defer util.MustClose(rdb)
 
-		storage = redis_db.NewStore(rdb)
+		storage = redis_db.NewStore(rdb, redis_db.WithCompression(compression))
+
+		// attempts stored by any replica are streamed to the clients of all replicas
+		relay := stream.NewRelay(rdb, broadcaster)
+		go relay.Run(context.Background())
+		publisher = relay
+	}
+
+	registry := metrics.NewRegistry()
+	storage = store.NewObserved(storage, handler.NewStoreMetrics(registry))
+	storage = store.NewObserved(storage, handler.NewStoreTracing())
+
+	var secretsProvider secrets.Provider = secrets.NewEnv(secretEnvPrefix)
+	if secretsDir != "" {
+		secretsProvider = secrets.NewDir(secretsDir)
 	}
 
-	fetcher := handler.NewFetcher(storage, util.GenID)
+	// tasks must not be able to send the API's own credentials to their targets
+	var serviceSecrets secrets.Provider = secrets.NewEnv(serviceSecretEnvPrefix)
+	if serviceDir != "" {
+		if secretsDir != "" && within(serviceDir, secretsDir) {
+			logger.Fatal("service secrets must not be in the directory of task secrets", "dir", serviceDir)
+		}
+
+		serviceSecrets = secrets.NewDir(serviceDir)
+	}
+
+	webhooks, err := loadWebhooks(webhooksFile)
+	if err != nil {
+		logger.Fatal("loading webhooks failed", "error", err)
+	}
+
+	tenants, err := loadTenants(tenantsFile)
+	if err != nil {
+		logger.Fatal("loading tenants failed", "error", err)
+	}
+
+	authenticator, err := loadAuthenticator(serviceSecrets, apiKeysFile, jwtSecretRef, jwksFile, jwtIssuer, jwtAudience)
+	if err != nil {
+		logger.Fatal("loading api credentials failed", "error", err)
+	}
+
+	if !authenticator.Enabled() {
+		logger.Warn("no api keys or jwt keys configured, the api is not authenticated")
+	}
+
+	notifier := notify.NewNotifier(storage, notify.WithSecrets(secretsProvider), notify.WithWebhooks(webhooks))
+
+	fetcherOpts := []handler.FetcherOption{
+		handler.WithUserAgent(userAgent),
+		handler.WithCredentials(credentials.NewAuthenticator(secretsProvider)),
+		handler.WithNotifier(notifier),
+		handler.WithStream(broadcaster, publisher),
+		handler.WithTenants(tenants),
+		handler.WithMetrics(registry),
+	}
+	if !ignoreRobots {
+		fetcherOpts = append(fetcherOpts, handler.WithRobots(robots.NewChecker(userAgent, robotsTTL)))
+	}
+
+	fetcher := handler.NewFetcher(storage, util.GenID, fetcherOpts...)
 	fetcherStop := fetcher.Start()
 	defer fetcherStop()
 
 	router := handler.NewRouter(fetcher)
 	sizeLimiter := handler.NewSizeLimiter(limit)
 	contentType := handler.NewContentTypeMW()
+	accessLog := handler.NewAccessLogMW()
+	requestMetrics := handler.NewMetricsMW(registry, router)
+	requestTracing := handler.NewTracingMW(router)
+	authMW := handler.NewAuthMW(authenticator)
+	tenant := handler.NewTenantMW(tenants)
 
 	addr := net.JoinHostPort("", port)
-	log.Printf("listening on: %s", addr)
+	logger.Info("listening", "addr", addr)
+
+	err = http.ListenAndServe(addr, handler.NewProbes(fetcher, handler.NewChain(router, accessLog, requestMetrics, requestTracing, contentType, sizeLimiter, authMW, tenant)))
+	if err != nil {
+		logger.Fatal("starting server failed", "error", err)
+	}
+}
 
-	err := http.ListenAndServe(addr, handler.NewChain(router, contentType, sizeLimiter))
+// loadWebhooks reads the global webhooks, no file means no global webhooks.
+func loadWebhooks(path string) ([]model.Webhook, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
 	if err != nil {
-		log.Fatalf("starting server failed: %s", err)
+		return nil, err
 	}
+
+	var webhooks []model.Webhook
+
+	err = json.Unmarshal(data, &webhooks)
+	if err != nil {
+		return nil, err
+	}
+
+	return webhooks, notify.Validate(webhooks)
+}
+
+// loadTenants reads the tenants, no file means only the default tenant.
+func loadTenants(path string) ([]model.Tenant, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tenants []model.Tenant
+
+	err = json.Unmarshal(data, &tenants)
+	if err != nil {
+		return nil, err
+	}
+
+	return tenants, handler.ValidateTenants(tenants)
+}
+
+// loadAuthenticator configures the api keys and the keys verifying JWTs.
+func loadAuthenticator(provider secrets.Provider, keysFile, secretRef, jwksFile, issuer, audience string) (*auth.Authenticator, error) {
+	opts := []auth.Option{auth.WithIssuer(issuer), auth.WithAudience(audience)}
+
+	if keysFile != "" {
+		keys, err := auth.LoadKeys(keysFile, provider)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, auth.WithKeys(keys))
+	}
+
+	if secretRef != "" {
+		secret, err := provider.Secret(secretRef)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, auth.WithHMACSecret([]byte(secret)))
+	}
+
+	if jwksFile != "" {
+		keys, err := auth.LoadJWKS(jwksFile)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, auth.WithJWKS(keys))
+	}
+
+	return auth.NewAuthenticator(opts...), nil
+}
+
+// within tells whether the directory is dir or one of its subdirectories.
+func within(path, dir string) bool {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+
+	rel, err := filepath.Rel(dir, path)
+
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// openTraceFile opens the file spans are exported to, - means stdout.
+func openTraceFile(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+
+	return os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
 }
@@ -5,6 +5,7 @@ go 1.13
 require (
 	github.com/go-redis/redis/v8 v8.2.3
 	github.com/gorilla/mux v1.8.0
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/stretchr/testify v1.6.1
-	go.opentelemetry.io/otel v0.12.0 // indirect
+	go.opentelemetry.io/otel v0.12.0
 )
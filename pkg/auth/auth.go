@@ -0,0 +1,214 @@
+// Package auth authenticates API requests with static API keys or JWTs and
+// tells whether the role of the caller allows a request.
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"crawler/pkg/secrets"
+	"crawler/pkg/util"
+)
+
+const (
+	RoleReadOnly = "read-only"
+	RoleEditor   = "editor"
+	RoleAdmin    = "admin"
+
+	// KeyHeader carries API keys, they can also be sent as bearer tokens.
+	KeyHeader = "X-API-Key"
+)
+
+var (
+	ErrUnauthenticated = errors.New("unauthenticated")
+
+	ranks = map[string]int{RoleReadOnly: 1, RoleEditor: 2, RoleAdmin: 3}
+)
+
+// Principal is the authenticated caller. Callers without a tenant belong to the default tenant.
+type Principal struct {
+	Subject string
+	Role    string
+	Tenant  string
+}
+
+// Allows tells whether the principal's role includes the required role.
+func (p *Principal) Allows(role string) bool {
+	return ranks[p.Role] >= ranks[role]
+}
+
+func ValidRole(role string) bool {
+	return ranks[role] > 0
+}
+
+type principalKey struct{}
+
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the authenticated caller, nil when authentication is disabled.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+
+	return p
+}
+
+// KeyConfig describes an API key, the key itself is resolved from the secrets provider.
+type KeyConfig struct {
+	Name   string `json:"name"`
+	KeyRef string `json:"key_ref"`
+	Role   string `json:"role"`
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// Key is an API key of which only the hash is kept.
+type Key struct {
+	principal Principal
+	hash      [sha256.Size]byte
+}
+
+// LoadKeys reads the API key configuration and resolves the keys.
+func LoadKeys(path string, provider secrets.Provider) ([]Key, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var configs []KeyConfig
+
+	err = json.Unmarshal(data, &configs)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]Key, 0, len(configs))
+
+	for _, c := range configs {
+		if c.Name == "" || !ValidRole(c.Role) {
+			return nil, util.Wrap(util.ErrValidation, fmt.Sprintf("api key '%s' needs a name and a valid role", c.Name))
+		}
+
+		value, err := provider.Secret(c.KeyRef)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, NewKey(value, Principal{Subject: c.Name, Role: c.Role, Tenant: c.Tenant}))
+	}
+
+	return keys, nil
+}
+
+func NewKey(value string, p Principal) Key {
+	return Key{principal: p, hash: sha256.Sum256([]byte(value))}
+}
+
+type Authenticator struct {
+	keys       []Key
+	hmacSecret []byte
+	rsaKeys    map[string]*rsa.PublicKey
+	issuer     string
+	audience   string
+	now        func() time.Time
+}
+
+type Option func(*Authenticator)
+
+func WithKeys(keys []Key) Option {
+	return func(a *Authenticator) {
+		a.keys = keys
+	}
+}
+
+// WithHMACSecret accepts JWTs signed with HS256 and the secret.
+func WithHMACSecret(secret []byte) Option {
+	return func(a *Authenticator) {
+		a.hmacSecret = secret
+	}
+}
+
+// WithJWKS accepts JWTs signed with RS256 and one of the keys, by key id.
+func WithJWKS(keys map[string]*rsa.PublicKey) Option {
+	return func(a *Authenticator) {
+		a.rsaKeys = keys
+	}
+}
+
+// WithIssuer requires the iss claim of JWTs.
+func WithIssuer(issuer string) Option {
+	return func(a *Authenticator) {
+		a.issuer = issuer
+	}
+}
+
+// WithAudience requires the aud claim of JWTs to contain the audience.
+func WithAudience(audience string) Option {
+	return func(a *Authenticator) {
+		a.audience = audience
+	}
+}
+
+func NewAuthenticator(opts ...Option) *Authenticator {
+	a := &Authenticator{now: util.NowFunc}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+// Enabled tells whether any credentials are configured, requests are not
+// authenticated otherwise.
+func (a *Authenticator) Enabled() bool {
+	return len(a.keys) > 0 || len(a.hmacSecret) > 0 || len(a.rsaKeys) > 0
+}
+
+func (a *Authenticator) jwtEnabled() bool {
+	return len(a.hmacSecret) > 0 || len(a.rsaKeys) > 0
+}
+
+// Authenticate returns the caller of the request.
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	credential := r.Header.Get(KeyHeader)
+	if credential == "" {
+		authorization := r.Header.Get("Authorization")
+		if len(authorization) > 7 && strings.EqualFold(authorization[:7], "bearer ") {
+			credential = strings.TrimSpace(authorization[7:])
+		}
+	}
+
+	if credential == "" {
+		return nil, util.Wrap(ErrUnauthenticated, "no credentials")
+	}
+
+	if a.jwtEnabled() && strings.Count(credential, ".") == 2 {
+		return a.verifyJWT(credential)
+	}
+
+	hash := sha256.Sum256([]byte(credential))
+
+	// every key is compared so that the time taken does not tell which one matched
+	var found *Principal
+	for i := range a.keys {
+		if subtle.ConstantTimeCompare(hash[:], a.keys[i].hash[:]) == 1 {
+			p := a.keys[i].principal
+			found = &p
+		}
+	}
+
+	if found == nil {
+		return nil, util.Wrap(ErrUnauthenticated, "unknown api key")
+	}
+
+	return found, nil
+}
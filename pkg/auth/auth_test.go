@@ -0,0 +1,151 @@
+// +build unit !integration
+
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encode(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func hs256(secret string, claims map[string]interface{}) string {
+	signed := encode(map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + encode(claims)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func rs256(key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	signed := encode(map[string]string{"alg": "RS256", "kid": kid}) + "." + encode(claims)
+
+	digest := sha256.Sum256([]byte(signed))
+	signature, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func request(header, value string) *http.Request {
+	r, _ := http.NewRequest(http.MethodGet, "/api/fetcher", nil)
+	if header != "" {
+		r.Header.Set(header, value)
+	}
+
+	return r
+}
+
+func TestAPIKeys(t *testing.T) {
+	a := NewAuthenticator(WithKeys([]Key{
+		NewKey("reader-key", Principal{Subject: "reader", Role: RoleReadOnly}),
+		NewKey("acme-key", Principal{Subject: "acme", Role: RoleEditor, Tenant: "acme"}),
+	}))
+	require.True(t, a.Enabled())
+
+	p, err := a.Authenticate(request(KeyHeader, "acme-key"))
+	require.NoError(t, err)
+	assert.Equal(t, &Principal{Subject: "acme", Role: RoleEditor, Tenant: "acme"}, p)
+
+	p, err = a.Authenticate(request("Authorization", "Bearer reader-key"))
+	require.NoError(t, err)
+	assert.Equal(t, "reader", p.Subject)
+
+	_, err = a.Authenticate(request(KeyHeader, "other"))
+	assert.True(t, errors.Is(err, ErrUnauthenticated))
+
+	_, err = a.Authenticate(request("", ""))
+	assert.True(t, errors.Is(err, ErrUnauthenticated))
+
+	assert.False(t, NewAuthenticator().Enabled())
+}
+
+func TestRoles(t *testing.T) {
+	admin := &Principal{Role: RoleAdmin}
+	reader := &Principal{Role: RoleReadOnly}
+
+	assert.True(t, admin.Allows(RoleEditor))
+	assert.True(t, reader.Allows(RoleReadOnly))
+	assert.False(t, reader.Allows(RoleEditor))
+	assert.False(t, (&Principal{Role: "root"}).Allows(RoleReadOnly))
+}
+
+func TestJWT(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	jwks := fmt.Sprintf(`{"keys": [{"kty": "RSA", "kid": "k1", "use": "sig", "n": "%s", "e": "%s"}]}`,
+		base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()))
+
+	rsaKeys, err := ParseJWKS([]byte(jwks))
+	require.NoError(t, err)
+
+	a := NewAuthenticator(WithHMACSecret([]byte("secret")), WithJWKS(rsaKeys), WithIssuer("issuer"), WithAudience("crawler"))
+	a.now = func() time.Time { return now }
+
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub": "alice", "iss": "issuer", "aud": []string{"crawler"},
+			"exp": now.Add(time.Minute).Unix(), "role": RoleEditor, "tenant": "acme",
+		}
+		for k, v := range changes {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+
+		return c
+	}
+
+	p, err := a.Authenticate(request("Authorization", "Bearer "+hs256("secret", claims(nil))))
+	require.NoError(t, err)
+	assert.Equal(t, &Principal{Subject: "alice", Role: RoleEditor, Tenant: "acme"}, p)
+
+	p, err = a.Authenticate(request("Authorization", "Bearer "+rs256(key, "k1", claims(map[string]interface{}{"role": nil}))))
+	require.NoError(t, err)
+	assert.Equal(t, RoleReadOnly, p.Role)
+
+	rejected := map[string]string{
+		"wrong secret":  hs256("other", claims(nil)),
+		"unknown kid":   rs256(key, "k2", claims(nil)),
+		"expired":       hs256("secret", claims(map[string]interface{}{"exp": now.Add(-time.Hour).Unix()})),
+		"no expiry":     hs256("secret", claims(map[string]interface{}{"exp": nil})),
+		"not yet valid": hs256("secret", claims(map[string]interface{}{"nbf": now.Add(time.Hour).Unix()})),
+		"issuer":        hs256("secret", claims(map[string]interface{}{"iss": "other"})),
+		"audience":      hs256("secret", claims(map[string]interface{}{"aud": "other"})),
+		"role":          hs256("secret", claims(map[string]interface{}{"role": "root"})),
+		"alg none":      encode(map[string]string{"alg": "none"}) + "." + encode(claims(nil)) + ".",
+	}
+
+	// the claims of a signed token are swapped
+	parts := strings.Split(hs256("secret", claims(nil)), ".")
+	rejected["tampered"] = parts[0] + "." + encode(claims(map[string]interface{}{"role": RoleAdmin})) + "." + parts[2]
+
+	for name, token := range rejected {
+		_, err := a.Authenticate(request("Authorization", "Bearer "+token))
+		assert.True(t, errors.Is(err, ErrUnauthenticated), name)
+	}
+}
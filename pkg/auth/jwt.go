@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
+
+	"crawler/pkg/util"
+)
+
+// leeway tolerates clock skew between the token issuer and the service
+const leeway = time.Second * 30
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type claims struct {
+	Subject   string          `json:"sub"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *int64          `json:"exp"`
+	NotBefore *int64          `json:"nbf"`
+	Role      string          `json:"role"`
+	Tenant    string          `json:"tenant"`
+}
+
+// audiences reads the aud claim, which is a string or an array of strings.
+func (c *claims) audiences() []string {
+	var one string
+	if json.Unmarshal(c.Audience, &one) == nil {
+		return []string{one}
+	}
+
+	var many []string
+	_ = json.Unmarshal(c.Audience, &many)
+
+	return many
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+func (a *Authenticator) verifyJWT(token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, util.Wrap(ErrUnauthenticated, "malformed token header")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, util.Wrap(ErrUnauthenticated, "malformed token signature")
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+
+	// the algorithm must match the configured key, so that a public key is never used as hmac secret
+	switch header.Alg {
+	case "HS256":
+		if len(a.hmacSecret) == 0 {
+			return nil, util.Wrap(ErrUnauthenticated, "HS256 tokens not accepted")
+		}
+
+		mac := hmac.New(sha256.New, a.hmacSecret)
+		mac.Write(signed)
+
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, util.Wrap(ErrUnauthenticated, "invalid token signature")
+		}
+	case "RS256":
+		key, ok := a.rsaKey(header.Kid)
+		if !ok {
+			return nil, util.Wrap(ErrUnauthenticated, "unknown token key")
+		}
+
+		digest := sha256.Sum256(signed)
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) != nil {
+			return nil, util.Wrap(ErrUnauthenticated, "invalid token signature")
+		}
+	default:
+		return nil, util.Wrap(ErrUnauthenticated, "unsupported token algorithm")
+	}
+
+	var c claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return nil, util.Wrap(ErrUnauthenticated, "malformed token claims")
+	}
+
+	return a.principal(&c)
+}
+
+// rsaKey returns the key of the id, tokens without a key id are accepted when there is a single key.
+func (a *Authenticator) rsaKey(kid string) (*rsa.PublicKey, bool) {
+	if kid == "" && len(a.rsaKeys) == 1 {
+		for _, key := range a.rsaKeys {
+			return key, true
+		}
+	}
+
+	key, ok := a.rsaKeys[kid]
+
+	return key, ok
+}
+
+func (a *Authenticator) principal(c *claims) (*Principal, error) {
+	now := a.now()
+
+	if c.ExpiresAt == nil || now.After(time.Unix(*c.ExpiresAt, 0).Add(leeway)) {
+		return nil, util.Wrap(ErrUnauthenticated, "token expired")
+	}
+
+	if c.NotBefore != nil && now.Add(leeway).Before(time.Unix(*c.NotBefore, 0)) {
+		return nil, util.Wrap(ErrUnauthenticated, "token not valid yet")
+	}
+
+	if a.issuer != "" && c.Issuer != a.issuer {
+		return nil, util.Wrap(ErrUnauthenticated, "unexpected token issuer")
+	}
+
+	if a.audience != "" && !contains(c.audiences(), a.audience) {
+		return nil, util.Wrap(ErrUnauthenticated, "unexpected token audience")
+	}
+
+	// tokens without a role may only read
+	role := c.Role
+	if role == "" {
+		role = RoleReadOnly
+	}
+
+	if !ValidRole(role) {
+		return nil, util.Wrap(ErrUnauthenticated, fmt.Sprintf("unknown role '%s'", role))
+	}
+
+	return &Principal{Subject: c.Subject, Role: role, Tenant: c.Tenant}, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// LoadJWKS reads the RSA keys of a JWKS file by key id.
+func LoadJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseJWKS(data)
+}
+
+func ParseJWKS(data []byte) (map[string]*rsa.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	err := json.Unmarshal(data, &set)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, util.Wrap(util.ErrValidation, fmt.Sprintf("invalid modulus of key '%s'", k.Kid))
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, util.Wrap(util.ErrValidation, fmt.Sprintf("invalid exponent of key '%s'", k.Kid))
+		}
+
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+
+	if len(keys) == 0 {
+		return nil, util.Wrap(util.ErrValidation, "no RSA signing keys")
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,215 @@
+package cookies
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"crawler/pkg/model"
+	"crawler/pkg/util"
+)
+
+// Jar is a http.CookieJar whose content can be exported and restored, so that
+// a task's session survives between attempts and service restarts. It implements
+// the RFC 6265 domain and path matching rules but has no public suffix list, which
+// is acceptable because the crawler only talks to the hosts it was configured for.
+type Jar struct {
+	cookies map[string]*model.Cookie
+	now     func() time.Time
+	mutex   sync.Mutex
+}
+
+func NewJar(cookies []*model.Cookie) *Jar {
+	j := &Jar{
+		cookies: make(map[string]*model.Cookie),
+		now:     util.NowFunc,
+	}
+
+	for _, c := range cookies {
+		cp := *c
+		j.cookies[key(&cp)] = &cp
+	}
+
+	return j
+}
+
+func key(c *model.Cookie) string {
+	return c.Domain + ";" + c.Path + ";" + c.Name
+}
+
+func (j *Jar) expired(c *model.Cookie) bool {
+	return c.Expires != 0 && c.Expires <= j.now().Unix()
+}
+
+func (j *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	host := canonicalHost(u)
+	if host == "" {
+		return
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	for _, hc := range cookies {
+		c := &model.Cookie{
+			Name:     hc.Name,
+			Value:    hc.Value,
+			Path:     hc.Path,
+			Secure:   hc.Secure,
+			HttpOnly: hc.HttpOnly,
+		}
+
+		if c.Path == "" || c.Path[0] != '/' {
+			c.Path = defaultPath(u.Path)
+		}
+
+		if hc.Domain == "" {
+			c.Domain = host
+			c.HostOnly = true
+		} else {
+			domain := strings.ToLower(strings.TrimPrefix(hc.Domain, "."))
+			if !domainMatch(host, domain) {
+				continue
+			}
+
+			c.Domain = domain
+		}
+
+		switch {
+		case hc.MaxAge < 0:
+			c.Expires = -1
+		case hc.MaxAge > 0:
+			c.Expires = j.now().Add(time.Duration(hc.MaxAge) * time.Second).Unix()
+		case !hc.Expires.IsZero():
+			c.Expires = hc.Expires.Unix()
+			if c.Expires <= 0 {
+				c.Expires = -1
+			}
+		}
+
+		if j.expired(c) {
+			delete(j.cookies, key(c))
+			continue
+		}
+
+		j.cookies[key(c)] = c
+	}
+}
+
+func (j *Jar) Cookies(u *url.URL) []*http.Cookie {
+	host := canonicalHost(u)
+	if host == "" {
+		return nil
+	}
+
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	var matching []*model.Cookie
+	for k, c := range j.cookies {
+		if j.expired(c) {
+			delete(j.cookies, k)
+			continue
+		}
+
+		if c.HostOnly && c.Domain != host || !c.HostOnly && !domainMatch(host, c.Domain) {
+			continue
+		}
+
+		if c.Secure && u.Scheme != "https" || !pathMatch(path, c.Path) {
+			continue
+		}
+
+		matching = append(matching, c)
+	}
+
+	// longer paths first as required by RFC 6265
+	sort.Slice(matching, func(a, b int) bool {
+		if len(matching[a].Path) != len(matching[b].Path) {
+			return len(matching[a].Path) > len(matching[b].Path)
+		}
+
+		return matching[a].Name < matching[b].Name
+	})
+
+	ret := make([]*http.Cookie, 0, len(matching))
+	for _, c := range matching {
+		ret = append(ret, &http.Cookie{Name: c.Name, Value: c.Value})
+	}
+
+	return ret
+}
+
+// Export returns all cookies that are not expired yet, sorted for stable output.
+func (j *Jar) Export() []*model.Cookie {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	ret := make([]*model.Cookie, 0, len(j.cookies))
+	for _, c := range j.cookies {
+		if j.expired(c) {
+			continue
+		}
+
+		cp := *c
+		ret = append(ret, &cp)
+	}
+
+	sort.Slice(ret, func(a, b int) bool {
+		return key(ret[a]) < key(ret[b])
+	})
+
+	return ret
+}
+
+func canonicalHost(u *url.URL) string {
+	host := u.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return strings.ToLower(host)
+}
+
+func domainMatch(host, domain string) bool {
+	if host == domain {
+		return true
+	}
+
+	// IP addresses only match exactly
+	if net.ParseIP(host) != nil {
+		return false
+	}
+
+	return strings.HasSuffix(host, "."+domain)
+}
+
+func pathMatch(requestPath, cookiePath string) bool {
+	if requestPath == cookiePath {
+		return true
+	}
+
+	if !strings.HasPrefix(requestPath, cookiePath) {
+		return false
+	}
+
+	return strings.HasSuffix(cookiePath, "/") || requestPath[len(cookiePath)] == '/'
+}
+
+func defaultPath(path string) string {
+	i := strings.LastIndex(path, "/")
+	if i <= 0 {
+		return "/"
+	}
+
+	return path[:i]
+}
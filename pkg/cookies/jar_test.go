@@ -0,0 +1,61 @@
+// +build unit !integration
+
+package cookies
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustParse(t *testing.T, raw string) *url.URL {
+	u, err := url.Parse(raw)
+	require.NoError(t, err)
+
+	return u
+}
+
+func names(cookies []*http.Cookie) []string {
+	ret := make([]string, 0, len(cookies))
+	for _, c := range cookies {
+		ret = append(ret, c.Name)
+	}
+
+	return ret
+}
+
+func TestJar(t *testing.T) {
+	now := time.Unix(1000, 0)
+
+	jar := NewJar(nil)
+	jar.now = func() time.Time { return now }
+
+	jar.SetCookies(mustParse(t, "http://www.example.com/app/login"), []*http.Cookie{
+		{Name: "host", Value: "1"},
+		{Name: "domain", Value: "2", Domain: ".example.com", Path: "/"},
+		{Name: "secure", Value: "3", Secure: true, Path: "/"},
+		{Name: "short", Value: "4", MaxAge: 10, Path: "/"},
+		{Name: "foreign", Value: "5", Domain: "other.com"},
+	})
+
+	assert.Equal(t, []string{"host", "domain", "short"}, names(jar.Cookies(mustParse(t, "http://www.example.com/app/page"))))
+	assert.Equal(t, []string{"domain", "short"}, names(jar.Cookies(mustParse(t, "http://www.example.com/other"))))
+	assert.Equal(t, []string{"domain"}, names(jar.Cookies(mustParse(t, "http://api.example.com/"))))
+	assert.Equal(t, []string{"domain", "secure", "short"}, names(jar.Cookies(mustParse(t, "https://www.example.com/"))))
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, []string{"domain", "secure"}, names(jar.Cookies(mustParse(t, "https://www.example.com/"))))
+
+	// restored jar behaves the same
+	restored := NewJar(jar.Export())
+	restored.now = jar.now
+	assert.Equal(t, []string{"host", "domain"}, names(restored.Cookies(mustParse(t, "http://www.example.com/app/x"))))
+
+	// deleting a cookie
+	jar.SetCookies(mustParse(t, "http://www.example.com/"), []*http.Cookie{{Name: "domain", Domain: "example.com", Path: "/", MaxAge: -1}})
+	assert.Equal(t, []string{"secure"}, names(jar.Cookies(mustParse(t, "https://www.example.com/"))))
+}
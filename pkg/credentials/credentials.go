@@ -0,0 +1,211 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"crawler/pkg/model"
+	"crawler/pkg/secrets"
+	"crawler/pkg/util"
+)
+
+const (
+	// tokens are refreshed a bit before they actually expire
+	expirySkew   = time.Second * 30
+	defaultTTL   = time.Hour
+	tokenTimeout = time.Second * 5
+	tokenLimit   = 1024 * 64
+)
+
+var ErrUnsupported = errors.New("unsupported auth type")
+
+type token struct {
+	value     string
+	expiresAt time.Time
+}
+
+type Authenticator struct {
+	secrets secrets.Provider
+	client  *http.Client
+	now     func() time.Time
+
+	tokens map[string]*token
+	mutex  sync.Mutex
+}
+
+func NewAuthenticator(provider secrets.Provider) *Authenticator {
+	return &Authenticator{
+		secrets: provider,
+		client:  http.DefaultClient,
+		now:     util.NowFunc,
+		tokens:  make(map[string]*token),
+	}
+}
+
+// Apply adds credentials to the request. The referenced secrets are resolved among
+// those of the context's tenant. It returns the secret values it used, so that the
+// caller can scrub them from anything it stores.
+func (a *Authenticator) Apply(ctx context.Context, req *http.Request, auth *model.Auth) ([]string, error) {
+	provider := secrets.Scope(a.secrets, util.Tenant(ctx))
+
+	switch auth.Type {
+	case model.AuthBasic:
+		password, err := provider.Secret(auth.PasswordRef)
+		if err != nil {
+			return nil, err
+		}
+
+		req.SetBasicAuth(auth.Username, password)
+
+		return []string{password}, nil
+	case model.AuthBearer:
+		value, err := provider.Secret(auth.TokenRef)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Authorization", "Bearer "+value)
+
+		return []string{value}, nil
+	case model.AuthOAuth2:
+		clientSecret, err := provider.Secret(auth.ClientSecretRef)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := a.token(ctx, auth, clientSecret)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Authorization", "Bearer "+value)
+
+		return []string{clientSecret, value}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, auth.Type)
+	}
+}
+
+// Invalidate drops a cached OAuth2 token, i.e. after the target rejected it.
+func (a *Authenticator) Invalidate(ctx context.Context, auth *model.Auth) {
+	if auth.Type != model.AuthOAuth2 {
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	delete(a.tokens, tokenKey(ctx, auth))
+}
+
+// tokenKey identifies a cached token, tenants do not share tokens.
+func tokenKey(ctx context.Context, auth *model.Auth) string {
+	return strings.Join([]string{util.Tenant(ctx), auth.TokenUrl, auth.ClientId, strings.Join(auth.Scopes, " ")}, "\x00")
+}
+
+func (a *Authenticator) token(ctx context.Context, auth *model.Auth, clientSecret string) (string, error) {
+	key := tokenKey(ctx, auth)
+
+	a.mutex.Lock()
+	t, found := a.tokens[key]
+	a.mutex.Unlock()
+
+	if found && a.now().Before(t.expiresAt) {
+		return t.value, nil
+	}
+
+	t, err := a.requestToken(ctx, auth, clientSecret)
+	if err != nil {
+		return "", err
+	}
+
+	a.mutex.Lock()
+	a.tokens[key] = t
+	a.mutex.Unlock()
+
+	return t.value, nil
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func (a *Authenticator) requestToken(ctx context.Context, auth *model.Auth, clientSecret string) (*token, error) {
+	ctx, cancel := context.WithTimeout(ctx, tokenTimeout)
+	defer cancel()
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(auth.Scopes) > 0 {
+		form.Set("scope", strings.Join(auth.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, auth.TokenUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, util.Wrap(err, "creating token request failed")
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(auth.ClientId), url.QueryEscape(clientSecret))
+
+	res, err := a.client.Do(req)
+	if err != nil {
+		return nil, util.Wrap(err, "requesting token failed")
+	}
+	defer util.MustClose(res.Body)
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, tokenLimit))
+	if err != nil {
+		return nil, util.Wrap(err, "reading token response failed")
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint responded with %d", res.StatusCode)
+	}
+
+	var tr tokenResponse
+
+	err = json.Unmarshal(body, &tr)
+	if err != nil {
+		return nil, util.Wrap(err, "decoding token response failed")
+	}
+
+	if tr.AccessToken == "" {
+		return nil, errors.New("token endpoint returned no access token")
+	}
+
+	ttl := defaultTTL
+	if tr.ExpiresIn > 0 {
+		ttl = time.Duration(tr.ExpiresIn) * time.Second
+	}
+
+	if ttl > expirySkew*2 {
+		ttl -= expirySkew
+	}
+
+	return &token{value: tr.AccessToken, expiresAt: a.now().Add(ttl)}, nil
+}
+
+// Scrub replaces every occurrence of the secret values in s.
+func Scrub(s string, values []string) string {
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+
+		s = strings.Replace(s, v, model.Redacted, -1)
+	}
+
+	return s
+}
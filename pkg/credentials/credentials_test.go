@@ -0,0 +1,134 @@
+// +build unit !integration
+
+package credentials
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"crawler/pkg/model"
+	"crawler/pkg/secrets"
+	"crawler/pkg/util"
+)
+
+type staticSecrets map[string]string
+
+func (s staticSecrets) Secret(name string) (string, error) {
+	v, ok := s[name]
+	if !ok {
+		return "", secrets.ErrSecretNotFound
+	}
+
+	return v, nil
+}
+
+func TestApplyStatic(t *testing.T) {
+	authenticator := NewAuthenticator(staticSecrets{"password": "p4ss", "token": "t0ken"})
+	ctx := context.Background()
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+	used, err := authenticator.Apply(ctx, req, &model.Auth{Type: model.AuthBasic, Username: "user", PasswordRef: "password"})
+	require.NoError(t, err)
+
+	username, password, ok := req.BasicAuth()
+	require.True(t, ok)
+	assert.Equal(t, "user", username)
+	assert.Equal(t, "p4ss", password)
+	assert.Equal(t, []string{"p4ss"}, used)
+
+	req = httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+	_, err = authenticator.Apply(ctx, req, &model.Auth{Type: model.AuthBearer, TokenRef: "token"})
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer t0ken", req.Header.Get("Authorization"))
+
+	_, err = authenticator.Apply(ctx, req, &model.Auth{Type: model.AuthBearer, TokenRef: "missing"})
+	assert.Error(t, err)
+}
+
+func TestApplyOAuth2(t *testing.T) {
+	issued := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientId, clientSecret, ok := r.BasicAuth()
+		if !ok || clientId != "client" || clientSecret != "s3cret" || r.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		issued++
+		assert.Equal(t, "read write", r.FormValue("scope"))
+
+		_, _ = io.WriteString(w, `{"access_token":"abc","token_type":"bearer","expires_in":3600}`)
+	}))
+	defer ts.Close()
+
+	now := time.Unix(1000, 0)
+
+	authenticator := NewAuthenticator(staticSecrets{"client-secret": "s3cret"})
+	authenticator.now = func() time.Time { return now }
+
+	auth := &model.Auth{
+		Type:            model.AuthOAuth2,
+		TokenUrl:        ts.URL,
+		ClientId:        "client",
+		ClientSecretRef: "client-secret",
+		Scopes:          []string{"read", "write"},
+	}
+
+	apply := func() {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+		_, err := authenticator.Apply(context.Background(), req, auth)
+		require.NoError(t, err)
+		assert.Equal(t, "Bearer abc", req.Header.Get("Authorization"))
+	}
+
+	apply()
+	apply()
+	assert.Equal(t, 1, issued)
+
+	now = now.Add(time.Hour)
+	apply()
+	assert.Equal(t, 2, issued)
+
+	authenticator.Invalidate(context.Background(), auth)
+	apply()
+	assert.Equal(t, 3, issued)
+}
+
+func TestApplyTenantSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "tenants", "acme"), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "token"), []byte("default"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "tenants", "acme", "token"), []byte("acme"), 0600))
+
+	authenticator := NewAuthenticator(secrets.NewDir(dir))
+	auth := &model.Auth{Type: model.AuthBearer, TokenRef: "token"}
+
+	for tenant, expected := range map[string]string{"": "Bearer default", "acme": "Bearer acme"} {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+		_, err = authenticator.Apply(util.WithTenant(context.Background(), tenant), req, auth)
+		require.NoError(t, err)
+		assert.Equal(t, expected, req.Header.Get("Authorization"))
+	}
+
+	// tenants only reach their own secrets
+	req := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+	_, err = authenticator.Apply(util.WithTenant(context.Background(), "globex"), req, auth)
+	assert.Error(t, err)
+}
+
+func TestScrub(t *testing.T) {
+	assert.Equal(t, "token=[REDACTED]&other=[REDACTED]", Scrub("token=abc&other=def", []string{"abc", "def", ""}))
+}
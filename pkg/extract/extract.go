@@ -0,0 +1,183 @@
+package extract
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"crawler/pkg/model"
+	"crawler/pkg/util"
+)
+
+type extractor interface {
+	extract(body string, doc *document) (string, bool)
+}
+
+// document lazily parses the body once for all extractors of a task.
+type document struct {
+	body string
+
+	json      interface{}
+	jsonErr   error
+	jsonReady bool
+
+	html *node
+}
+
+func (d *document) JSON() (interface{}, error) {
+	if !d.jsonReady {
+		d.jsonErr = json.Unmarshal([]byte(d.body), &d.json)
+		d.jsonReady = true
+	}
+
+	return d.json, d.jsonErr
+}
+
+func (d *document) HTML() *node {
+	if d.html == nil {
+		d.html = parseHTML(d.body)
+	}
+
+	return d.html
+}
+
+type regexExtractor struct {
+	re *regexp.Regexp
+}
+
+// extract returns the first capture group, or the whole match when the expression has none.
+func (e *regexExtractor) extract(body string, _ *document) (string, bool) {
+	m := e.re.FindStringSubmatch(body)
+	if m == nil {
+		return "", false
+	}
+
+	if len(m) > 1 {
+		return m[1], true
+	}
+
+	return m[0], true
+}
+
+type jsonExtractor struct {
+	path []segment
+}
+
+// extract returns strings as they are and any other value JSON encoded.
+func (e *jsonExtractor) extract(_ string, doc *document) (string, bool) {
+	v, err := doc.JSON()
+	if err != nil {
+		return "", false
+	}
+
+	v, ok := lookup(v, e.path)
+	if !ok {
+		return "", false
+	}
+
+	switch value := v.(type) {
+	case string:
+		return value, true
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), true
+	default:
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return "", false
+		}
+
+		return string(encoded), true
+	}
+}
+
+type cssExtractor struct {
+	selector *selector
+}
+
+func (e *cssExtractor) extract(_ string, doc *document) (string, bool) {
+	n := e.selector.first(doc.HTML())
+	if n == nil {
+		return "", false
+	}
+
+	return e.selector.value(n)
+}
+
+func compile(e *model.Extractor) (extractor, error) {
+	switch e.Type {
+	case model.ExtractRegex:
+		re, err := regexp.Compile(e.Expr)
+		if err != nil {
+			return nil, err
+		}
+
+		return &regexExtractor{re: re}, nil
+	case model.ExtractJSON:
+		path, err := parsePath(e.Expr)
+		if err != nil {
+			return nil, err
+		}
+
+		return &jsonExtractor{path: path}, nil
+	case model.ExtractCSS:
+		sel, err := parseSelector(e.Expr)
+		if err != nil {
+			return nil, err
+		}
+
+		return &cssExtractor{selector: sel}, nil
+	default:
+		return nil, fmt.Errorf("unknown extractor type '%s'", e.Type)
+	}
+}
+
+// Validate checks that all extractors have unique names and compile.
+func Validate(extractors []model.Extractor) error {
+	names := make(map[string]bool, len(extractors))
+
+	for i := range extractors {
+		e := &extractors[i]
+		if e.Name == "" || names[e.Name] {
+			return util.Wrap(util.ErrValidation, "extractor names must be unique and not empty")
+		}
+
+		names[e.Name] = true
+
+		_, err := compile(e)
+		if err != nil {
+			return util.Wrap(util.ErrValidation, fmt.Sprintf("extractor '%s': %s", e.Name, err))
+		}
+	}
+
+	return nil
+}
+
+// Value applies a single extractor to the body.
+func Value(e model.Extractor, body string) (string, bool) {
+	compiled, err := compile(&e)
+	if err != nil {
+		return "", false
+	}
+
+	return compiled.extract(body, &document{body: body})
+}
+
+// Run applies the extractors to the body. Extractors that do not match are left out of the result.
+func Run(extractors []model.Extractor, body string) map[string]string {
+	doc := &document{body: body}
+	values := make(map[string]string, len(extractors))
+
+	for i := range extractors {
+		e, err := compile(&extractors[i])
+		if err != nil {
+			continue
+		}
+
+		if v, ok := e.extract(body, doc); ok {
+			values[extractors[i].Name] = v
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,91 @@
+// +build unit !integration
+
+package extract
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"crawler/pkg/model"
+	"crawler/pkg/util"
+)
+
+const page = `<!DOCTYPE html>
+<html>
+<head><title>Shop &amp; more</title><script>var x = "<div class='price'>0</div>";</script></head>
+<body>
+	<!-- <span class="price">commented</span> -->
+	<div id="product" class="item featured">
+		<h1>Widget</h1>
+		<span class="price">  12.50
+			EUR</span>
+		<ul><li>one<li>two</ul>
+		<a href="/download?v=1.2.3&amp;os=linux" data-kind=stable>Download</a>
+		<img src="/widget.png" alt="widget">
+	</div>
+	<div class="item"><span class="price">99</span></div>
+</body>
+</html>`
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name      string
+		extractor model.Extractor
+		body      string
+		expected  string
+		found     bool
+	}{
+		{name: "regex group", extractor: model.Extractor{Type: model.ExtractRegex, Expr: `version (\d+\.\d+)`}, body: "current version 1.25 released", expected: "1.25", found: true},
+		{name: "regex match", extractor: model.Extractor{Type: model.ExtractRegex, Expr: `\d+`}, body: "abc 42", expected: "42", found: true},
+		{name: "regex no match", extractor: model.Extractor{Type: model.ExtractRegex, Expr: `\d+`}, body: "abc", found: false},
+		{name: "json string", extractor: model.Extractor{Type: model.ExtractJSON, Expr: `$.data.items[1].name`}, body: `{"data":{"items":[{"name":"a"},{"name":"b"}]}}`, expected: "b", found: true},
+		{name: "json number", extractor: model.Extractor{Type: model.ExtractJSON, Expr: `price`}, body: `{"price": 12.5}`, expected: "12.5", found: true},
+		{name: "json object", extractor: model.Extractor{Type: model.ExtractJSON, Expr: `$["odd key"]`}, body: `{"odd key": {"a": true}}`, expected: `{"a":true}`, found: true},
+		{name: "json missing", extractor: model.Extractor{Type: model.ExtractJSON, Expr: `$.a[3]`}, body: `{"a": [1]}`, found: false},
+		{name: "json invalid body", extractor: model.Extractor{Type: model.ExtractJSON, Expr: `$.a`}, body: `<html>`, found: false},
+		{name: "css text", extractor: model.Extractor{Type: model.ExtractCSS, Expr: `#product .price`}, body: page, expected: "12.50 EUR", found: true},
+		{name: "css child", extractor: model.Extractor{Type: model.ExtractCSS, Expr: `div.item > span.price`}, body: page, expected: "12.50 EUR", found: true},
+		{name: "css no match", extractor: model.Extractor{Type: model.ExtractCSS, Expr: `section .price`}, body: page, found: false},
+		{name: "css attr", extractor: model.Extractor{Type: model.ExtractCSS, Expr: `a[data-kind=stable]::attr(href)`}, body: page, expected: "/download?v=1.2.3&os=linux", found: true},
+		{name: "css implicit close", extractor: model.Extractor{Type: model.ExtractCSS, Expr: `ul > li`}, body: page, expected: "one", found: true},
+		{name: "css title", extractor: model.Extractor{Type: model.ExtractCSS, Expr: `title`}, body: page, expected: "Shop & more", found: true},
+		{name: "css void element", extractor: model.Extractor{Type: model.ExtractCSS, Expr: `img::attr(alt)`}, body: page, expected: "widget", found: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.extractor.Name = "value"
+
+			values := Run([]model.Extractor{tc.extractor}, tc.body)
+
+			v, found := values["value"]
+			assert.Equal(t, tc.found, found)
+			assert.Equal(t, tc.expected, v)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := []model.Extractor{
+		{Name: "a", Type: model.ExtractRegex, Expr: `a+`},
+		{Name: "b", Type: model.ExtractJSON, Expr: `$.a[0]`},
+		{Name: "c", Type: model.ExtractCSS, Expr: `div > p.x[title]`},
+	}
+	assert.NoError(t, Validate(valid))
+
+	invalid := [][]model.Extractor{
+		{{Name: "a", Type: model.ExtractRegex, Expr: `(`}},
+		{{Name: "a", Type: model.ExtractJSON, Expr: `$.a[x]`}},
+		{{Name: "a", Type: model.ExtractCSS, Expr: `div >`}},
+		{{Name: "a", Type: "xpath", Expr: `//div`}},
+		{{Name: "", Type: model.ExtractRegex, Expr: `a`}},
+		{{Name: "a", Type: model.ExtractRegex, Expr: `a`}, {Name: "a", Type: model.ExtractRegex, Expr: `b`}},
+	}
+
+	for _, extractors := range invalid {
+		err := Validate(extractors)
+		assert.True(t, errors.Is(err, util.ErrValidation), "%v", extractors)
+	}
+}
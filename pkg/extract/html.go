@@ -0,0 +1,240 @@
+package extract
+
+import (
+	"html"
+	"strings"
+)
+
+// node is an element of the minimal DOM built by parseHTML. Text nodes have
+// an empty tag and carry their content in text.
+type node struct {
+	tag      string
+	attrs    map[string]string
+	text     string
+	parent   *node
+	children []*node
+}
+
+var (
+	voidElements = map[string]bool{
+		"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+		"input": true, "link": true, "meta": true, "param": true, "source": true, "track": true, "wbr": true,
+	}
+	rawTextElements = map[string]bool{"script": true, "style": true, "textarea": true, "title": true}
+	// raw text elements whose content still has character references decoded
+	escapableRawText = map[string]bool{"textarea": true, "title": true}
+	// elements closed implicitly when a sibling of the same kind starts
+	selfClosingSiblings = map[string]bool{
+		"p": true, "li": true, "td": true, "th": true, "tr": true, "option": true, "dt": true, "dd": true,
+	}
+)
+
+// parseHTML builds a tree from possibly malformed html. It is tolerant rather than
+// spec compliant: unknown end tags are ignored and unclosed elements end with their parent.
+func parseHTML(s string) *node {
+	root := &node{tag: "#root"}
+	current := root
+
+	appendText := func(text string) {
+		if text == "" {
+			return
+		}
+
+		current.children = append(current.children, &node{text: html.UnescapeString(text), parent: current})
+	}
+
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '<')
+		if i < 0 {
+			appendText(s)
+			break
+		}
+
+		appendText(s[:i])
+		s = s[i:]
+
+		switch {
+		case strings.HasPrefix(s, "<!--"):
+			end := strings.Index(s, "-->")
+			if end < 0 {
+				return root
+			}
+
+			s = s[end+3:]
+		case strings.HasPrefix(s, "<!") || strings.HasPrefix(s, "<?"):
+			end := strings.IndexByte(s, '>')
+			if end < 0 {
+				return root
+			}
+
+			s = s[end+1:]
+		case strings.HasPrefix(s, "</"):
+			end := strings.IndexByte(s, '>')
+			if end < 0 {
+				return root
+			}
+
+			tag := strings.ToLower(strings.TrimSpace(s[2:end]))
+			s = s[end+1:]
+
+			for n := current; n != root; n = n.parent {
+				if n.tag == tag {
+					current = n.parent
+					break
+				}
+			}
+		default:
+			tag, attrs, selfClosing, rest, ok := parseTag(s)
+			if !ok {
+				appendText("<")
+				s = s[1:]
+				continue
+			}
+
+			s = rest
+
+			if selfClosingSiblings[tag] && current.tag == tag {
+				current = current.parent
+			}
+
+			n := &node{tag: tag, attrs: attrs, parent: current}
+			current.children = append(current.children, n)
+
+			if selfClosing || voidElements[tag] {
+				continue
+			}
+
+			if rawTextElements[tag] {
+				end := strings.Index(strings.ToLower(s), "</"+tag)
+				if end < 0 {
+					end = len(s)
+				}
+
+				text := s[:end]
+				if escapableRawText[tag] {
+					text = html.UnescapeString(text)
+				}
+
+				n.children = append(n.children, &node{text: text, parent: n})
+				s = s[end:]
+				if gt := strings.IndexByte(s, '>'); gt >= 0 {
+					s = s[gt+1:]
+				}
+
+				continue
+			}
+
+			current = n
+		}
+	}
+
+	return root
+}
+
+// parseTag parses a start tag at the beginning of s.
+func parseTag(s string) (tag string, attrs map[string]string, selfClosing bool, rest string, ok bool) {
+	i := 1
+	for i < len(s) && isNameChar(s[i]) {
+		i++
+	}
+
+	if i == 1 {
+		return "", nil, false, s, false
+	}
+
+	tag = strings.ToLower(s[1:i])
+	attrs = make(map[string]string)
+
+	for i < len(s) {
+		for i < len(s) && isSpace(s[i]) {
+			i++
+		}
+
+		if i >= len(s) {
+			return tag, attrs, false, "", true
+		}
+
+		switch s[i] {
+		case '>':
+			return tag, attrs, selfClosing, s[i+1:], true
+		case '/':
+			selfClosing = true
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(s) && !isSpace(s[i]) && s[i] != '=' && s[i] != '>' && s[i] != '/' {
+			i++
+		}
+
+		name := strings.ToLower(s[start:i])
+		value := ""
+
+		for i < len(s) && isSpace(s[i]) {
+			i++
+		}
+
+		if i < len(s) && s[i] == '=' {
+			i++
+			for i < len(s) && isSpace(s[i]) {
+				i++
+			}
+
+			if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+				quote := s[i]
+				end := strings.IndexByte(s[i+1:], quote)
+				if end < 0 {
+					value = s[i+1:]
+					i = len(s)
+				} else {
+					value = s[i+1 : i+1+end]
+					i += end + 2
+				}
+			} else {
+				start := i
+				for i < len(s) && !isSpace(s[i]) && s[i] != '>' {
+					i++
+				}
+
+				value = s[start:i]
+			}
+		}
+
+		if name != "" {
+			attrs[name] = html.UnescapeString(value)
+		}
+
+		selfClosing = false
+	}
+
+	return tag, attrs, selfClosing, "", true
+}
+
+func isNameChar(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || b == '-' || b == ':'
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\f'
+}
+
+func (n *node) textContent() string {
+	var b strings.Builder
+
+	var walk func(*node)
+	walk = func(n *node) {
+		if n.tag == "" {
+			b.WriteString(n.text)
+			return
+		}
+
+		for _, c := range n.children {
+			walk(c)
+		}
+	}
+
+	walk(n)
+
+	return strings.Join(strings.Fields(b.String()), " ")
+}
@@ -0,0 +1,97 @@
+package extract
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var errPath = errors.New("invalid json path")
+
+// segment of a json path, either an object key or an array index
+type segment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parsePath parses paths like $.items[0].price or $["odd key"].value, the leading $ is optional.
+func parsePath(path string) ([]segment, error) {
+	s := strings.TrimPrefix(strings.TrimSpace(path), "$")
+
+	var segments []segment
+
+	for len(s) > 0 {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+
+			i := 0
+			for i < len(s) && s[i] != '.' && s[i] != '[' {
+				i++
+			}
+
+			if i == 0 {
+				return nil, errPath
+			}
+
+			segments = append(segments, segment{key: s[:i]})
+			s = s[i:]
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, errPath
+			}
+
+			inner := strings.TrimSpace(s[1:end])
+			s = s[end+1:]
+
+			if len(inner) >= 2 && (inner[0] == '"' || inner[0] == '\'') && inner[len(inner)-1] == inner[0] {
+				segments = append(segments, segment{key: inner[1 : len(inner)-1]})
+				continue
+			}
+
+			index, err := strconv.Atoi(inner)
+			if err != nil || index < 0 {
+				return nil, errPath
+			}
+
+			segments = append(segments, segment{index: index, isIndex: true})
+		default:
+			// allow a bare first key, i.e. "items[0]"
+			if len(segments) > 0 {
+				return nil, errPath
+			}
+
+			s = "." + s
+		}
+	}
+
+	return segments, nil
+}
+
+func lookup(v interface{}, segments []segment) (interface{}, bool) {
+	for _, seg := range segments {
+		if seg.isIndex {
+			arr, ok := v.([]interface{})
+			if !ok || seg.index >= len(arr) {
+				return nil, false
+			}
+
+			v = arr[seg.index]
+			continue
+		}
+
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		v, ok = obj[seg.key]
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return v, true
+}
@@ -0,0 +1,240 @@
+package extract
+
+import (
+	"errors"
+	"strings"
+)
+
+var errSelector = errors.New("invalid selector")
+
+type attrMatcher struct {
+	name     string
+	value    string
+	hasValue bool
+}
+
+type compound struct {
+	tag     string
+	id      string
+	classes []string
+	attrs   []attrMatcher
+	// child is set when the compound must be a direct child of the previous one
+	child bool
+}
+
+// selector is a subset of CSS selectors: type, #id, .class, [attr] and [attr=value]
+// compounds joined by descendant or child (>) combinators, optionally followed by
+// ::attr(name) to select an attribute instead of the text content. Attribute values
+// in selectors may not contain whitespace or '>'.
+type selector struct {
+	compounds []compound
+	attr      string
+}
+
+func parseSelector(s string) (*selector, error) {
+	sel := &selector{}
+
+	if i := strings.Index(s, "::"); i >= 0 {
+		pseudo := strings.TrimSpace(s[i+2:])
+		s = s[:i]
+
+		switch {
+		case pseudo == "text":
+		case strings.HasPrefix(pseudo, "attr(") && strings.HasSuffix(pseudo, ")"):
+			sel.attr = strings.ToLower(strings.TrimSpace(pseudo[5 : len(pseudo)-1]))
+			if sel.attr == "" {
+				return nil, errSelector
+			}
+		default:
+			return nil, errSelector
+		}
+	}
+
+	child := false
+	for _, part := range strings.Fields(strings.Replace(s, ">", " > ", -1)) {
+		if part == ">" {
+			if child || len(sel.compounds) == 0 {
+				return nil, errSelector
+			}
+
+			child = true
+			continue
+		}
+
+		c, err := parseCompound(part)
+		if err != nil {
+			return nil, err
+		}
+
+		c.child = child
+		child = false
+
+		sel.compounds = append(sel.compounds, c)
+	}
+
+	if child || len(sel.compounds) == 0 {
+		return nil, errSelector
+	}
+
+	return sel, nil
+}
+
+func parseCompound(s string) (compound, error) {
+	c := compound{}
+
+	i := 0
+	for i < len(s) && (isNameChar(s[i]) || s[i] == '*') {
+		i++
+	}
+
+	c.tag = strings.ToLower(s[:i])
+	if c.tag == "*" {
+		c.tag = ""
+	}
+
+	for i < len(s) {
+		switch s[i] {
+		case '#', '.':
+			start := i + 1
+			i = start
+			for i < len(s) && (isNameChar(s[i]) || s[i] == '_') {
+				i++
+			}
+
+			if i == start {
+				return c, errSelector
+			}
+
+			if s[start-1] == '#' {
+				c.id = s[start:i]
+			} else {
+				c.classes = append(c.classes, s[start:i])
+			}
+		case '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return c, errSelector
+			}
+
+			expr := s[i+1 : i+end]
+			i += end + 1
+
+			m := attrMatcher{name: strings.ToLower(strings.TrimSpace(expr))}
+			if eq := strings.IndexByte(expr, '='); eq >= 0 {
+				m.name = strings.ToLower(strings.TrimSpace(expr[:eq]))
+				m.value = strings.Trim(strings.TrimSpace(expr[eq+1:]), `"'`)
+				m.hasValue = true
+			}
+
+			if m.name == "" {
+				return c, errSelector
+			}
+
+			c.attrs = append(c.attrs, m)
+		default:
+			return c, errSelector
+		}
+	}
+
+	return c, nil
+}
+
+func (c *compound) matches(n *node) bool {
+	if n.tag == "" || n.tag == "#root" {
+		return false
+	}
+
+	if c.tag != "" && c.tag != n.tag {
+		return false
+	}
+
+	if c.id != "" && n.attrs["id"] != c.id {
+		return false
+	}
+
+	if len(c.classes) > 0 {
+		classes := strings.Fields(n.attrs["class"])
+		for _, want := range c.classes {
+			found := false
+			for _, class := range classes {
+				if class == want {
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				return false
+			}
+		}
+	}
+
+	for _, m := range c.attrs {
+		v, ok := n.attrs[m.name]
+		if !ok || m.hasValue && v != m.value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchesAt checks the compounds up to index i against n and its ancestors.
+func (s *selector) matchesAt(n *node, i int) bool {
+	if !s.compounds[i].matches(n) {
+		return false
+	}
+
+	if i == 0 {
+		return true
+	}
+
+	if s.compounds[i].child {
+		return n.parent != nil && s.matchesAt(n.parent, i-1)
+	}
+
+	for p := n.parent; p != nil; p = p.parent {
+		if s.matchesAt(p, i-1) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// first returns the first node in document order matching the selector.
+func (s *selector) first(root *node) *node {
+	last := len(s.compounds) - 1
+
+	var found *node
+
+	var walk func(*node) bool
+	walk = func(n *node) bool {
+		if s.matchesAt(n, last) {
+			found = n
+			return true
+		}
+
+		for _, c := range n.children {
+			if walk(c) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	walk(root)
+
+	return found
+}
+
+func (s *selector) value(n *node) (string, bool) {
+	if s.attr == "" {
+		return n.textContent(), true
+	}
+
+	v, ok := n.attrs[s.attr]
+
+	return v, ok
+}
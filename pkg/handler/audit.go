@@ -0,0 +1,258 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"crawler/pkg/auth"
+	"crawler/pkg/logging"
+	"crawler/pkg/model"
+	"crawler/pkg/util"
+)
+
+const (
+	defaultAuditLimit = 100
+
+	// anonymousActor changed tasks while authentication was disabled
+	anonymousActor = "anonymous"
+)
+
+func actor(ctx context.Context) string {
+	if principal := auth.FromContext(ctx); principal != nil {
+		return principal.Subject
+	}
+
+	return anonymousActor
+}
+
+// audit records a change of a task, the tasks are redacted like in the task list.
+func (f *Fetcher) audit(ctx context.Context, action string, before, after *model.Task) {
+	e := &model.AuditEntry{Action: action, Actor: actor(ctx), CreatedAt: util.NowFunc().Unix()}
+
+	if before != nil {
+		e.TaskId = before.Id
+		e.Before = redact(before)
+	}
+
+	if after != nil {
+		e.TaskId = after.Id
+		e.After = redact(after)
+	}
+
+	f.record(ctx, e)
+}
+
+// auditGroup records a change of a group, its headers are redacted like those of tasks.
+func (f *Fetcher) auditGroup(ctx context.Context, action string, before, after *model.Group) {
+	e := &model.AuditEntry{Action: action, Actor: actor(ctx), CreatedAt: util.NowFunc().Unix()}
+
+	if before != nil {
+		e.Group = before.Name
+		e.BeforeGroup = redactGroup(before)
+	}
+
+	if after != nil {
+		e.Group = after.Name
+		e.AfterGroup = redactGroup(after)
+	}
+
+	f.record(ctx, e)
+}
+
+// record stores an audit entry. Failing to record it is logged, the change is not undone.
+func (f *Fetcher) record(ctx context.Context, e *model.AuditEntry) {
+	err := f.storage.AddAuditEntry(ctx, e)
+	if err != nil {
+		logging.FromContext(ctx).Error("recording audit entry failed", "task_id", e.TaskId, "group", e.Group, "action", e.Action, "actor", e.Actor, "error", err)
+	}
+}
+
+// pauseTask pauses or resumes a task and records the change.
+func (f *Fetcher) pauseTask(ctx context.Context, id int, paused bool) error {
+	before, err := f.storage.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	err = f.storage.SetPaused(ctx, id, paused)
+	if err != nil || before.Paused == paused {
+		return err
+	}
+
+	after := *before
+	after.Paused = paused
+
+	action := model.AuditResume
+	if paused {
+		action = model.AuditPause
+	}
+
+	f.audit(ctx, action, before, &after)
+
+	return nil
+}
+
+// deleteTask deletes a task and records the change.
+func (f *Fetcher) deleteTask(ctx context.Context, id int) error {
+	before, err := f.storage.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	err = f.storage.Delete(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	f.audit(ctx, model.AuditDelete, before, nil)
+
+	return nil
+}
+
+// createTask stores a task under an unused id and records the change.
+func (f *Fetcher) createTask(ctx context.Context, task *model.Task) error {
+	var err error
+
+	// ids are drawn at random, taken ones are drawn again
+	for i := 0; i < maxIdDraws; i++ {
+		task.Id = int(f.idGen(maxId))
+
+		err = f.storage.CreateLimited(ctx, task, f.maxTasks(ctx))
+		if !errors.Is(err, util.ErrConflict) {
+			break
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	f.audit(ctx, model.AuditCreate, nil, task)
+
+	return nil
+}
+
+// saveGroup creates or replaces a group and records the change.
+func (f *Fetcher) saveGroup(ctx context.Context, g *model.Group) error {
+	before, err := f.storage.GetGroup(ctx, g.Name)
+	if err != nil && !errors.Is(err, util.ErrResourceNotFound) {
+		return err
+	}
+
+	err = f.storage.SaveGroup(ctx, g)
+	if err != nil {
+		return err
+	}
+
+	action := model.AuditGroupUpdate
+	if before == nil {
+		action = model.AuditGroupCreate
+	}
+
+	f.auditGroup(ctx, action, before, g)
+
+	return nil
+}
+
+// deleteGroup deletes a group and records the change.
+func (f *Fetcher) deleteGroup(ctx context.Context, name string) error {
+	before, err := f.storage.GetGroup(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	err = f.storage.DeleteGroup(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	f.auditGroup(ctx, model.AuditGroupDelete, before, nil)
+
+	return nil
+}
+
+// parseAuditQuery reads the filter and paging parameters of the audit trail.
+func parseAuditQuery(values url.Values) (*model.AuditQuery, error) {
+	q := &model.AuditQuery{
+		Group:  values.Get("group"),
+		Actor:  values.Get("actor"),
+		Action: values.Get("action"),
+		Limit:  defaultAuditLimit,
+	}
+
+	var err error
+
+	if v := values.Get("task_id"); v != "" {
+		q.TaskId, err = strconv.Atoi(v)
+		if err != nil {
+			return nil, util.Wrap(util.ErrValidation, "task_id must be a number")
+		}
+	}
+
+	if v := values.Get("since"); v != "" {
+		q.Since, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, util.Wrap(util.ErrValidation, "since must be a unix timestamp")
+		}
+	}
+
+	if v := values.Get("until"); v != "" {
+		q.Until, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, util.Wrap(util.ErrValidation, "until must be a unix timestamp")
+		}
+	}
+
+	if v := values.Get("before"); v != "" {
+		q.Before, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || q.Before < 1 {
+			return nil, util.Wrap(util.ErrValidation, "before must be a positive entry id")
+		}
+	}
+
+	if v := values.Get("limit"); v != "" {
+		q.Limit, err = strconv.Atoi(v)
+		if err != nil || q.Limit < 1 || q.Limit > maxPageSize {
+			return nil, util.Wrap(util.ErrValidation, "limit must be between 1 and "+strconv.Itoa(maxPageSize))
+		}
+	}
+
+	switch q.Action {
+	case "", model.AuditCreate, model.AuditDelete, model.AuditPause, model.AuditResume,
+		model.AuditGroupCreate, model.AuditGroupUpdate, model.AuditGroupDelete:
+	default:
+		return nil, util.Wrap(util.ErrValidation, "action must be one of create, delete, pause, resume, group_create, group_update, group_delete")
+	}
+
+	return q, nil
+}
+
+// Audit returns the recorded task and group changes of the tenant, newest first. Older
+// pages are requested with the id of the last returned entry as before.
+func (f *Fetcher) Audit(w http.ResponseWriter, r *http.Request) {
+	q, err := parseAuditQuery(r.URL.Query())
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	entries, err := f.storage.ListAuditEntries(r.Context(), q)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	if entries == nil {
+		entries = []*model.AuditEntry{}
+	}
+
+	err = json.NewEncoder(w).Encode(entries)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+}
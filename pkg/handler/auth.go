@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"net/http"
+
+	"crawler/pkg/auth"
+	"crawler/pkg/logging"
+)
+
+// NewAuthMW authenticates requests and adds the caller to their context. Without
+// configured credentials requests are not authenticated and every route is open.
+func NewAuthMW(authenticator *auth.Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if authenticator == nil || !authenticator.Enabled() {
+			return next
+		}
+
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				principal, err := authenticator.Authenticate(r)
+				if err != nil {
+					auditDenied(r, "", err.Error())
+					w.Header().Set("WWW-Authenticate", `Bearer realm="crawler"`)
+					http.Error(w, "", http.StatusUnauthorized)
+					return
+				}
+
+				next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), principal)))
+			},
+		)
+	}
+}
+
+// authorize lets requests through whose caller has at least the role. Requests
+// without a caller are let through, as authentication is disabled then.
+func authorize(role string, h http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			principal := auth.FromContext(r.Context())
+			if principal != nil && !principal.Allows(role) {
+				auditDenied(r, principal.Subject, "role "+principal.Role+" lacks "+role)
+				http.Error(w, "", http.StatusForbidden)
+				return
+			}
+
+			h(w, r)
+		},
+	)
+}
+
+// authorizeOperator lets requests through whose caller is an admin bound to no tenant,
+// for routes which show the state of all tenants.
+func authorizeOperator(h http.HandlerFunc) http.Handler {
+	return authorize(auth.RoleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		principal := auth.FromContext(r.Context())
+		if principal != nil && principal.Tenant != "" {
+			auditDenied(r, principal.Subject, "bound to tenant "+principal.Tenant)
+			http.Error(w, "", http.StatusForbidden)
+			return
+		}
+
+		h(w, r)
+	})
+}
+
+// auditDenied records a denied request.
+func auditDenied(r *http.Request, subject, reason string) {
+	logging.FromContext(r.Context()).Warn("request denied", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr, "subject", subject, "reason", reason)
+}
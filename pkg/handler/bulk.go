@@ -0,0 +1,252 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"crawler/pkg/labels"
+	"crawler/pkg/logging"
+	"crawler/pkg/model"
+	"crawler/pkg/util"
+)
+
+const (
+	ndjsonContentType = "application/x-ndjson"
+	maxBulkTasks      = 1000
+)
+
+// decodeTasks reads tasks from a JSON array or from NDJSON. Items of the wrong shape
+// are reported as nil tasks with an error, malformed JSON fails the whole request.
+func decodeTasks(r io.Reader) ([]*model.Task, []error, error) {
+	reader := bufio.NewReader(r)
+
+	// NDJSON is told apart by not starting with an array
+	array := false
+	for {
+		b, err := reader.ReadByte()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		if !strings.ContainsRune(" \t\r\n", rune(b)) {
+			array = b == '['
+			_ = reader.UnreadByte()
+
+			break
+		}
+	}
+
+	d := json.NewDecoder(reader)
+
+	if array {
+		if _, err := d.Token(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var (
+		tasks []*model.Task
+		errs  []error
+	)
+
+	for d.More() {
+		if len(tasks) == maxBulkTasks {
+			return nil, nil, util.Wrap(util.ErrValidation, fmt.Sprintf("at most %d tasks can be imported at once", maxBulkTasks))
+		}
+
+		var task model.Task
+
+		err := d.Decode(&task)
+
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			tasks = append(tasks, nil)
+			errs = append(errs, util.Wrap(util.ErrValidation, "invalid task"))
+
+			continue
+		} else if err != nil {
+			return nil, nil, util.Wrap(util.ErrValidation, "malformed JSON")
+		}
+
+		tasks = append(tasks, &task)
+		errs = append(errs, validateTask(&task))
+	}
+
+	if array {
+		if _, err := d.Token(); err != nil {
+			return nil, nil, util.Wrap(util.ErrValidation, "malformed JSON")
+		}
+	}
+
+	return tasks, errs, nil
+}
+
+// Bulk creates tasks from a JSON array or NDJSON and reports the result of each.
+// With atomic=true no task is created unless all of them are valid.
+func (f *Fetcher) Bulk(w http.ResponseWriter, r *http.Request) {
+	defer util.MustClose(r.Body)
+
+	tasks, errs, err := decodeTasks(r.Body)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	for i, task := range tasks {
+		if errs[i] == nil {
+			errs[i] = f.checkGroup(r.Context(), task)
+		}
+	}
+
+	atomic := r.URL.Query().Get("atomic") == "true"
+
+	results := make([]*model.BulkResult, len(tasks))
+	failed := false
+
+	for i := range tasks {
+		results[i] = &model.BulkResult{Index: i}
+
+		if errs[i] != nil {
+			results[i].Error = errs[i].Error()
+			failed = true
+		}
+	}
+
+	if atomic && failed {
+		w.WriteHeader(http.StatusBadRequest)
+		writeResults(w, results)
+
+		return
+	}
+
+	var created []int
+
+	now := time.Now().Unix()
+
+	for i, task := range tasks {
+		if errs[i] != nil {
+			continue
+		}
+
+		// the quota is checked as the tasks are created so that it counts the earlier ones
+		err := f.checkQuota(r.Context(), task)
+		if err == nil {
+			task.CreatedAt = now
+
+			err = f.createTask(r.Context(), task)
+		}
+
+		if err != nil && atomic {
+			f.rollback(r, created)
+			util.EmitHttpError(w, err)
+
+			return
+		} else if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+
+		results[i].Id = task.Id
+		created = append(created, task.Id)
+	}
+
+	writeResults(w, results)
+}
+
+func (f *Fetcher) rollback(r *http.Request, created []int) {
+	for _, id := range created {
+		err := f.deleteTask(r.Context(), id)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("rolling back task failed", "task_id", id, "error", err)
+		}
+	}
+}
+
+func writeResults(w http.ResponseWriter, results []*model.BulkResult) {
+	err := json.NewEncoder(w).Encode(results)
+	if err != nil {
+		logging.Default().Error("encoding bulk results failed", "error", err)
+	}
+}
+
+// Export streams all task definitions as NDJSON, redacted like the task list. Bulk
+// imports the export once the redacted values are filled in again.
+func (f *Fetcher) Export(w http.ResponseWriter, r *http.Request) {
+	tasks, err := f.storage.ListTasks(r.Context())
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", ndjsonContentType)
+
+	// Encode terminates every value with a newline
+	e := json.NewEncoder(w)
+	for _, task := range tasks {
+		err = e.Encode(redact(task))
+		if err != nil {
+			logging.FromContext(r.Context()).Error("exporting task failed", "task_id", task.Id, "error", err)
+			return
+		}
+	}
+}
+
+// BulkAction pauses, resumes or deletes all tasks matching the label selector
+// and reports the result for each of them.
+func (f *Fetcher) BulkAction(w http.ResponseWriter, r *http.Request) {
+	var apply func(ctx context.Context, id int) error
+
+	switch mux.Vars(r)["action"] {
+	case "pause":
+		apply = func(ctx context.Context, id int) error { return f.pauseTask(ctx, id, true) }
+	case "resume":
+		apply = func(ctx context.Context, id int) error { return f.pauseTask(ctx, id, false) }
+	case "delete":
+		apply = f.deleteTask
+	default:
+		util.EmitHttpError(w, util.ErrResourceNotFound)
+		return
+	}
+
+	sel, err := labels.Parse(r.URL.Query().Get("selector"))
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	// an empty selector would match every task
+	if sel.Empty() {
+		util.EmitHttpError(w, util.Wrap(util.ErrValidation, "selector required"))
+		return
+	}
+
+	tasks, _, err := f.storage.QueryTasks(r.Context(), &model.TaskQuery{Selector: sel})
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	results := make([]*model.BulkResult, len(tasks))
+
+	for i, task := range tasks {
+		results[i] = &model.BulkResult{Index: i, Id: task.Id}
+
+		err = apply(r.Context(), task.Id)
+		if err != nil {
+			results[i].Error = err.Error()
+		}
+	}
+
+	writeResults(w, results)
+}
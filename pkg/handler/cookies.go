@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"crawler/pkg/cookies"
+	"crawler/pkg/util"
+)
+
+func (f *Fetcher) loadJar(ctx context.Context, id int) (*cookies.Jar, error) {
+	stored, err := f.storage.ListCookies(ctx, id)
+	if err != nil {
+		return nil, util.Wrap(err, "loading cookies failed")
+	}
+
+	return cookies.NewJar(stored), nil
+}
+
+func (f *Fetcher) Cookies(w http.ResponseWriter, r *http.Request) {
+	id, err := taskId(r)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	// the jar drops cookies which expired since they were stored
+	jar, err := f.loadJar(r.Context(), id)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(jar.Export())
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+}
+
+func (f *Fetcher) ClearCookies(w http.ResponseWriter, r *http.Request) {
+	id, err := taskId(r)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	err = f.storage.SaveCookies(r.Context(), id, nil)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+}
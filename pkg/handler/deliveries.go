@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"crawler/pkg/util"
+)
+
+func (f *Fetcher) Deliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := taskId(r)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	deliveries, err := f.storage.ListDeliveries(r.Context(), id)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(deliveries)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pmezard/go-difflib/difflib"
+
+	"crawler/pkg/model"
+	"crawler/pkg/util"
+)
+
+const diffContext = 3
+
+func attemptId(r *http.Request, name string) (int64, error) {
+	id, err := strconv.ParseInt(mux.Vars(r)[name], 10, 64)
+	if err != nil {
+		return 0, util.ErrValidation
+	}
+
+	return id, nil
+}
+
+func findAttempt(attempts []*model.Attempt, id int64) (*model.Attempt, error) {
+	for _, a := range attempts {
+		if a.Id == id {
+			return a, nil
+		}
+	}
+
+	return nil, util.Wrap(util.ErrResourceNotFound, fmt.Sprintf("attempt %d", id))
+}
+
+func attemptLabel(a *model.Attempt) string {
+	return fmt.Sprintf("attempt %d (%s)", a.Id, time.Unix(a.CreatedAt, 0).UTC().Format(time.RFC3339))
+}
+
+// Diff responds with a unified diff between the responses of two attempts of a task.
+func (f *Fetcher) Diff(w http.ResponseWriter, r *http.Request) {
+	id, err := taskId(r)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	fromId, err := attemptId(r, "a")
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	toId, err := attemptId(r, "b")
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	attempts, err := f.storage.ListAttempts(r.Context(), id)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	from, err := findAttempt(attempts, fromId)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	to, err := findAttempt(attempts, toId)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(from.Response),
+		B:        difflib.SplitLines(to.Response),
+		FromFile: attemptLabel(from),
+		ToFile:   attemptLabel(to),
+		Context:  diffContext,
+	})
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = io.WriteString(w, diff)
+}
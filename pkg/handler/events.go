@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"crawler/pkg/logging"
+	"crawler/pkg/stream"
+	"crawler/pkg/util"
+)
+
+const (
+	heartbeatInterval = time.Second * 15
+	attemptEvent      = "attempt"
+)
+
+// Events streams new attempts of a task as server-sent events. Event ids are
+// attempt ids, a reconnecting client gets the attempts it missed since Last-Event-ID.
+func (f *Fetcher) Events(w http.ResponseWriter, r *http.Request) {
+	id, err := taskId(r)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	_, err = f.storage.Get(r.Context(), id)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	f.streamAttempts(w, r, id)
+}
+
+// AllEvents streams new attempts of all tasks. Event ids are <created_at>:<task id>:<attempt id>,
+// a reconnecting client gets the attempts created since Last-Event-ID, possibly
+// including some of the same second it received already.
+func (f *Fetcher) AllEvents(w http.ResponseWriter, r *http.Request) {
+	f.streamAttempts(w, r, stream.AllTasks)
+}
+
+func (f *Fetcher) streamAttempts(w http.ResponseWriter, r *http.Request, id int) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		util.EmitHttpError(w, errors.New("streaming unsupported"))
+		return
+	}
+
+	// subscribing before the replay makes sure nothing stored in between is lost
+	sub := f.broadcaster.Subscribe(util.Tenant(r.Context()), id)
+	defer f.broadcaster.Unsubscribe(sub)
+
+	missed, err := f.missedAttempts(r.Context(), id, r.Header.Get("Last-Event-ID"))
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	// the newest attempt sent per task, live messages overlapping with the replay are skipped
+	sent := make(map[int]int64)
+
+	for _, m := range missed {
+		writeEvent(w, id, m)
+		sent[m.TaskId] = m.Attempt.Id
+	}
+
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case m, ok := <-sub.C:
+			if !ok {
+				// the client was too slow, it resumes with Last-Event-ID after reconnecting
+				return
+			}
+
+			if m.Attempt.Id <= sent[m.TaskId] {
+				continue
+			}
+
+			writeEvent(w, id, m)
+			sent[m.TaskId] = m.Attempt.Id
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func eventId(id int, m *stream.Message) string {
+	if id != stream.AllTasks {
+		return strconv.FormatInt(m.Attempt.Id, 10)
+	}
+
+	return fmt.Sprintf("%d:%d:%d", m.Attempt.CreatedAt, m.TaskId, m.Attempt.Id)
+}
+
+func writeEvent(w http.ResponseWriter, id int, m *stream.Message) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		logging.Default().Error("encoding event failed", "task_id", m.TaskId, "error", err)
+		return
+	}
+
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", eventId(id, m), attemptEvent, data)
+}
+
+// missedAttempts returns the stored attempts a client resuming from lastEventId did not receive.
+func (f *Fetcher) missedAttempts(ctx context.Context, id int, lastEventId string) ([]*stream.Message, error) {
+	if lastEventId == "" {
+		return nil, nil
+	}
+
+	if id != stream.AllTasks {
+		last, err := strconv.ParseInt(lastEventId, 10, 64)
+		if err != nil {
+			return nil, util.Wrap(util.ErrValidation, "invalid Last-Event-ID")
+		}
+
+		return f.attemptsAfter(ctx, id, func(taskId int, attemptId, _ int64) bool {
+			return attemptId > last
+		})
+	}
+
+	parts := strings.Split(lastEventId, ":")
+	if len(parts) != 3 {
+		return nil, util.Wrap(util.ErrValidation, "invalid Last-Event-ID")
+	}
+
+	var values [3]int64
+	for i, part := range parts {
+		var err error
+
+		values[i], err = strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return nil, util.Wrap(util.ErrValidation, "invalid Last-Event-ID")
+		}
+	}
+
+	since, lastTask, lastAttempt := values[0], int(values[1]), values[2]
+
+	return f.attemptsAfter(ctx, id, func(taskId int, attemptId, createdAt int64) bool {
+		if taskId == lastTask && attemptId <= lastAttempt {
+			return false
+		}
+
+		return createdAt >= since
+	})
+}
+
+// attemptsAfter returns the stored attempts of the task (or all tasks) accepted by
+// the filter, ordered by creation.
+func (f *Fetcher) attemptsAfter(ctx context.Context, id int, filter func(taskId int, attemptId, createdAt int64) bool) ([]*stream.Message, error) {
+	ids := []int{id}
+
+	if id == stream.AllTasks {
+		tasks, err := f.storage.ListTasks(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = ids[:0]
+		for _, t := range tasks {
+			ids = append(ids, t.Id)
+		}
+	}
+
+	var messages []*stream.Message
+
+	for _, taskId := range ids {
+		attempts, err := f.storage.ListAttempts(ctx, taskId)
+		if errors.Is(err, util.ErrResourceNotFound) && id == stream.AllTasks {
+			// deleted in the meantime
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		for _, a := range attempts {
+			if filter(taskId, a.Id, a.CreatedAt) {
+				messages = append(messages, &stream.Message{TaskId: taskId, Attempt: a})
+			}
+		}
+	}
+
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].Attempt.CreatedAt < messages[j].Attempt.CreatedAt
+	})
+
+	return messages, nil
+}
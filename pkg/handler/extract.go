@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"crawler/pkg/extract"
+	"crawler/pkg/model"
+)
+
+const extractedFilterPrefix = "extracted."
+
+// applyExtractors fills the extracted values of a successful attempt. Attempts
+// answered with 304 keep the values of the attempt they refer to.
+func applyExtractors(task *model.Task, attempt *model.Attempt, previous *model.Attempt) {
+	if len(task.Extractors) == 0 || attempt.Outcome != model.OutcomeSuccess {
+		return
+	}
+
+	if attempt.NotModified {
+		attempt.Extracted = previous.Extracted
+		return
+	}
+
+	attempt.Extracted = extract.Run(task.Extractors, attempt.Response)
+
+	if task.ExtractOnly {
+		// changes are tracked on the extracted values only
+		encoded, _ := json.Marshal(attempt.Extracted)
+
+		attempt.Response = ""
+		attempt.Hash = contentHash(string(encoded))
+		attempt.Changed = previous == nil || previous.Hash != attempt.Hash
+	}
+}
+
+// filterExtracted keeps attempts whose extracted values equal all extracted.<name>=<value> query parameters.
+func filterExtracted(r *http.Request, attempts []*model.Attempt) []*model.Attempt {
+	filters := make(map[string]string)
+	for k, v := range r.URL.Query() {
+		if strings.HasPrefix(k, extractedFilterPrefix) && len(v) > 0 {
+			filters[strings.TrimPrefix(k, extractedFilterPrefix)] = v[0]
+		}
+	}
+
+	if len(filters) == 0 {
+		return attempts
+	}
+
+	filtered := make([]*model.Attempt, 0, len(attempts))
+
+next:
+	for _, a := range attempts {
+		for name, value := range filters {
+			if v, ok := a.Extracted[name]; !ok || v != value {
+				continue next
+			}
+		}
+
+		filtered = append(filtered, a)
+	}
+
+	return filtered
+}
@@ -2,18 +2,37 @@ package handler
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"io"
 	"io/ioutil"
-	"log"
 	"math"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
-
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/label"
+
+	"crawler/pkg/cookies"
+	"crawler/pkg/credentials"
+	"crawler/pkg/health"
+	"crawler/pkg/logging"
+	"crawler/pkg/metrics"
 	"crawler/pkg/model"
+	"crawler/pkg/notify"
+	"crawler/pkg/robots"
+	"crawler/pkg/schedule"
 	"crawler/pkg/store"
+	"crawler/pkg/stream"
+	"crawler/pkg/tracing"
 	"crawler/pkg/util"
 )
 
@@ -22,169 +41,698 @@ const (
 	defaultTimeout        = time.Second * 5
 	defaultWorkers        = 10
 	maxId                 = math.MaxInt16
+	maxIdDraws            = 100
+
+	DefaultUserAgent = "crawler/1.0"
 )
 
 type assignment struct {
-	task   *model.Task
-	result *model.Attempt
+	tenant   string
+	task     *model.Task
+	previous *model.Attempt
+	result   *model.Attempt
+	// failures is the number of consecutive failed attempts before this one
+	failures int
+	// planned is when the scheduler wants the fetch to start, zero for manual runs
+	planned time.Time
+	// started is set once a worker picked the assignment up, guarded by the pending mutex
+	started bool
+	// timer hands a planned assignment to the workers, guarded by the pending mutex
+	timer *time.Timer
+	// trace is the parent of the fetch span, the API request's span for manual runs,
+	// and once fetched the fetch span, which is the parent of the save span
+	trace trace.SpanContext
+	// done receives the outcome of a manual run, it is nil for scheduled fetches
+	done chan error
+	// dryRun keeps the fetch of an unsaved task spec out of the metrics
+	dryRun bool
+}
+
+type response struct {
+	body         string
+	statusCode   int
+	etag         string
+	lastModified string
 }
 
 type Fetcher struct {
-	storage store.Store
-	idGen   func(int64) int64
+	storage     store.Store
+	idGen       func(int64) int64
+	userAgent   string
+	robots      *robots.Checker
+	credentials *credentials.Authenticator
+	notifier    *notify.Notifier
+	broadcaster *stream.Broadcaster
+	publisher   stream.Publisher
+
+	tenants map[string]*model.Tenant
+
+	// pending holds the tasks which are planned or being fetched
+	pending      map[taskRef]*assignment
+	pendingMutex sync.Mutex
+	// assignments feeds the workers while the scheduler runs and finish is closed once it
+	// stops, both guarded by the pending mutex
+	assignments chan *assignment
+	finish      chan bool
+	drift       driftStats
+
+	registry *metrics.Registry
+	metrics  *fetcherMetrics
+	state    runState
+}
+
+type FetcherOption func(*Fetcher)
+
+func WithUserAgent(userAgent string) FetcherOption {
+	return func(f *Fetcher) {
+		f.userAgent = userAgent
+	}
 }
 
-func NewFetcher(storage store.Store, idGen func(int64) int64) *Fetcher {
-	return &Fetcher{storage: storage, idGen: idGen}
+// WithRobots makes the workers honour robots.txt of the fetched hosts.
+func WithRobots(checker *robots.Checker) FetcherOption {
+	return func(f *Fetcher) {
+		f.robots = checker
+	}
+}
+
+// WithCredentials enables authentication against fetched targets.
+func WithCredentials(authenticator *credentials.Authenticator) FetcherOption {
+	return func(f *Fetcher) {
+		f.credentials = authenticator
+	}
+}
+
+// WithNotifier sends events of stored attempts to webhooks.
+func WithNotifier(notifier *notify.Notifier) FetcherOption {
+	return func(f *Fetcher) {
+		f.notifier = notifier
+	}
+}
+
+// WithStream serves attempt streams from the broadcaster and announces stored
+// attempts through the publisher, which can reach the broadcasters of other replicas.
+func WithStream(broadcaster *stream.Broadcaster, publisher stream.Publisher) FetcherOption {
+	return func(f *Fetcher) {
+		f.broadcaster = broadcaster
+		f.publisher = publisher
+	}
+}
+
+func NewFetcher(storage store.Store, idGen func(int64) int64, opts ...FetcherOption) *Fetcher {
+	broadcaster := stream.NewBroadcaster()
+
+	f := &Fetcher{
+		storage:     storage,
+		idGen:       idGen,
+		userAgent:   DefaultUserAgent,
+		broadcaster: broadcaster,
+		publisher:   broadcaster,
+		pending:     make(map[taskRef]*assignment),
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	if f.registry == nil {
+		f.registry = metrics.NewRegistry()
+	}
+
+	f.metrics = newFetcherMetrics(f.registry, f)
+
+	return f
+}
+
+// getTasks returns the tasks of all tenants due before the next tick which are not planned yet.
+func (f *Fetcher) getTasks(ctx context.Context) []*assignment {
+	var dueTasks []*assignment
+
+	for _, tenant := range f.tenantIds() {
+		dueTasks = append(dueTasks, f.tenantTasks(util.WithTenant(ctx, tenant))...)
+	}
+
+	return dueTasks
 }
 
-func (f *Fetcher) getTasks(ctx context.Context) []*model.Task {
+// tenantTasks returns the due tasks of the context's tenant.
+func (f *Fetcher) tenantTasks(ctx context.Context) []*assignment {
 	tasks, err := f.storage.ListTasks(ctx)
 	if err != nil {
-		log.Printf("retrieving current tasks from DB failed: %s", err)
+		logging.FromContext(ctx).Error("retrieving current tasks failed", "error", err)
+		return nil
+	}
+
+	groups, err := f.groups(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Error("retrieving groups failed", "error", err)
 		return nil
 	}
 
-	now := time.Now().Unix()
+	now := time.Now()
+	horizon := now.Add(defaultTickerInterval)
 
-	var dueTasks []*model.Task
+	var dueTasks []*assignment
 	for i, task := range tasks {
+		if f.reserved(util.Tenant(ctx), task.Id) {
+			continue
+		}
+
+		if g, ok := groups[task.Group]; ok {
+			tasks[i] = g.Apply(task)
+			task = tasks[i]
+		}
+
 		attempts, err := f.storage.ListAttempts(ctx, task.Id)
 		if err != nil {
-			log.Printf("retrieving history for task %d from DB failed: %s", task.Id, err)
+			logging.FromContext(ctx).Error("retrieving history failed", "task_id", task.Id, "error", err)
 			continue
 		}
 
-		if len(attempts) == 0 {
-			dueTasks = append(dueTasks, tasks[i])
+		next, err := nextRun(task, attempts, now)
+		if err != nil {
+			logging.FromContext(ctx).Warn("invalid schedule", "task_id", task.Id, "error", err)
 			continue
 		}
 
-		lastAttempt := attempts[len(attempts)-1]
+		if !next.IsZero() && next.Before(horizon) {
+			a := newAssignment(ctx, tasks[i], attempts)
+			a.planned = next
 
-		if now-lastAttempt.CreatedAt > int64(task.Interval) {
-			dueTasks = append(dueTasks, tasks[i])
+			dueTasks = append(dueTasks, a)
 		}
 	}
 
 	return dueTasks
 }
 
-func (f *Fetcher) retriever(finish chan bool, ticker *time.Ticker, assignments chan *assignment) func() {
+// nextRun returns when the task runs next given its history, the zero time when it does not run anymore.
+func nextRun(task *model.Task, attempts []*model.Attempt, now time.Time) (time.Time, error) {
+	if task.Paused {
+		return time.Time{}, nil
+	}
+
+	sched, err := schedule.New(task)
+	if errors.Is(err, schedule.ErrNoInterval) {
+		// tasks stored without an interval by older versions ran on every tick
+		legacy := *task
+		legacy.IntervalMs = defaultTickerInterval.Milliseconds()
+		sched, err = schedule.New(&legacy)
+	}
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// attempts stored by older versions or run manually only have the creation time
+	var last time.Time
+	if len(attempts) > 0 {
+		a := attempts[len(attempts)-1]
+
+		last = time.Unix(a.CreatedAt, 0)
+		if a.PlannedAtMs > 0 {
+			last = time.Unix(0, a.PlannedAtMs*int64(time.Millisecond))
+		}
+	}
+
+	return sched.Next(last, now), nil
+}
+
+// newAssignment prepares fetching the task of the context's tenant, the history provides
+// the state new attempts are compared with.
+func newAssignment(ctx context.Context, task *model.Task, attempts []*model.Attempt) *assignment {
+	return &assignment{
+		tenant:   util.Tenant(ctx),
+		task:     task,
+		previous: lastSuccess(attempts),
+		failures: notify.Failures(attempts),
+	}
+}
+
+// lastSuccess returns the newest attempt which got a response, new responses
+// are compared against it and it provides validators for conditional requests.
+func lastSuccess(attempts []*model.Attempt) *model.Attempt {
+	for i := len(attempts) - 1; i >= 0; i-- {
+		if attempts[i].Outcome == model.OutcomeSuccess {
+			return attempts[i]
+		}
+	}
+
+	return nil
+}
+
+func (f *Fetcher) retriever(finish chan bool, ticker *time.Ticker) {
 	ctx := context.Background()
 
 	for {
 		select {
-		case <-ticker.C:
+		case now := <-ticker.C:
+			f.state.tick(now)
+
 			tasks := f.getTasks(ctx)
-			log.Printf("tasks in this interval: %d\n", len(tasks))
+			logging.Default().Debug("scheduler tick", "due_tasks", len(tasks))
 			for i := range tasks {
-				assignments <- &assignment{task: tasks[i], result: nil}
+				if f.reserve(tasks[i]) {
+					f.plan(tasks[i])
+				}
 			}
 		case <-finish:
-			break
+			return
 		}
 	}
 }
 
-func (f *Fetcher) saver(finish chan bool, results chan *assignment) func() {
+func (f *Fetcher) saver(finish chan bool, results chan *assignment) {
 	ctx := context.Background()
 
 	for {
 		select {
 		case result := <-results:
-			err := f.storage.AddAttempt(ctx, result.task.Id, result.result)
+			err := f.save(ctx, result)
 			if err != nil {
-				log.Printf("saving attempt for task %d failed: %s", result.task.Id, err)
+				logging.FromContext(result.context()).Error("saving attempt failed", "task_id", result.task.Id, "error", err)
+				f.release(result)
+				result.finish(err)
+
+				continue
 			}
+
+			result.finish(nil)
+			f.followUp(ctx, result)
 		case <-finish:
-			break
+			return
+		}
+	}
+}
+
+// save stores the assignment's result and announces it to webhooks and streams.
+func (f *Fetcher) save(ctx context.Context, a *assignment) (err error) {
+	ctx = util.WithTenant(tracing.WithParent(ctx, a.trace), a.tenant)
+
+	ctx, span := tracing.Start(ctx, "save attempt", label.Int("task.id", a.task.Id))
+	defer func() { tracing.End(span, err) }()
+
+	f.enforceHistoryQuota(ctx, a)
+
+	err = f.storage.AddAttempt(ctx, a.task.Id, a.result)
+	if err != nil {
+		return err
+	}
+
+	if a.task.Retention > 0 {
+		err = f.storage.TrimAttempts(ctx, a.task.Id, a.task.Retention)
+		if err != nil {
+			logging.FromContext(ctx).Error("trimming history failed", "task_id", a.task.Id, "error", err)
 		}
 	}
+
+	if f.notifier != nil {
+		f.notifier.Notify(ctx, a.task, a.result, a.previous, a.failures)
+	}
+
+	err = f.publisher.Publish(ctx, &stream.Message{Tenant: a.tenant, TaskId: a.task.Id, Attempt: a.result})
+	if err != nil {
+		logging.FromContext(ctx).Error("publishing attempt failed", "task_id", a.task.Id, "error", err)
+	}
+
+	return nil
+}
+
+// targetUrl returns the task's url with its query parameters.
+func targetUrl(task *model.Task) (*url.URL, error) {
+	u, err := url.Parse(task.Url)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(task.Query) > 0 {
+		query := u.Query()
+		for k, v := range task.Query {
+			query.Set(k, v)
+		}
+
+		u.RawQuery = query.Encode()
+	}
+
+	return u, nil
 }
 
-func fetchUrl(url string) string {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+func (f *Fetcher) newRequest(ctx context.Context, task *model.Task) (*http.Request, error) {
+	method := task.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	u, err := targetUrl(task)
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.Reader
+	if task.Body != "" {
+		body = strings.NewReader(task.Body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range task.Headers {
+		req.Header.Set(k, v)
+	}
+
+	userAgent := task.UserAgent
+	if userAgent == "" {
+		userAgent = f.userAgent
+	}
+
+	req.Header.Set("User-Agent", userAgent)
+	tracing.Inject(ctx, req.Header)
+
+	return req, nil
+}
+
+// fetchUrl fetches the task's url. When the previous attempt carried validators,
+// the request is conditional and a 304 response comes back with an empty body.
+func (f *Fetcher) fetchUrl(parent context.Context, task *model.Task, previous *model.Attempt) (*response, error) {
+	ctx, cancel := context.WithTimeout(parent, defaultTimeout)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	req, err := f.newRequest(ctx, task)
 	if err != nil {
-		log.Printf("creating request for url '%s' failed: %s", url, err)
-		return ""
+		return nil, util.Wrap(err, "creating request failed")
+	}
+
+	// health checks always want a full response to evaluate
+	if previous != nil && task.Assertions == nil {
+		if previous.ETag != "" {
+			req.Header.Set("If-None-Match", previous.ETag)
+		}
+
+		if previous.LastModified != "" {
+			req.Header.Set("If-Modified-Since", previous.LastModified)
+		}
+	}
+
+	var secretValues []string
+	if task.Auth != nil {
+		if f.credentials == nil {
+			return nil, errors.New("authentication is not configured")
+		}
+
+		secretValues, err = f.credentials.Apply(ctx, req, task.Auth)
+		if err != nil {
+			return nil, util.Wrap(err, "applying credentials failed")
+		}
 	}
 
 	httpClient := http.DefaultClient
 
+	var jar *cookies.Jar
+	if task.Cookies {
+		jar, err = f.loadJar(ctx, task.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		httpClient = &http.Client{Jar: jar}
+	}
+
 	res, err := httpClient.Do(req)
 	if err != nil {
-		log.Printf("fetching url '%s' failed: %s", url, err.Error())
-		return ""
+		return nil, util.Wrap(err, "fetching url failed")
 	}
 	defer util.MustClose(res.Body)
 
+	if res.StatusCode == http.StatusUnauthorized && task.Auth != nil {
+		f.credentials.Invalidate(ctx, task.Auth)
+	}
+
+	if jar != nil {
+		err = f.storage.SaveCookies(ctx, task.Id, jar.Export())
+		if err != nil {
+			logging.FromContext(ctx).Error("saving cookies failed", "task_id", task.Id, "error", err)
+		}
+	}
+
 	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		log.Printf("reading body failed from url '%s' failed: %s", url, err)
-		return ""
+		return nil, util.Wrap(err, "reading body failed")
+	}
+
+	return &response{
+		body:         credentials.Scrub(string(body), secretValues),
+		statusCode:   res.StatusCode,
+		etag:         res.Header.Get("ETag"),
+		lastModified: res.Header.Get("Last-Modified"),
+	}, nil
+}
+
+func contentHash(body string) string {
+	sum := sha256.Sum256([]byte(body))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func fillAttempt(attempt *model.Attempt, res *response, previous *model.Attempt) {
+	attempt.Outcome = model.OutcomeSuccess
+	attempt.StatusCode = res.statusCode
+	attempt.ETag = res.etag
+	attempt.LastModified = res.lastModified
+
+	if res.statusCode != http.StatusNotModified || previous == nil {
+		attempt.Response = res.body
+		attempt.Hash = contentHash(res.body)
+		attempt.Changed = previous == nil || previous.Hash != attempt.Hash
+
+		return
+	}
+
+	// the body did not change, point at the attempt which holds it
+	attempt.NotModified = true
+	attempt.Hash = previous.Hash
+	attempt.BodyRef = previous.Id
+	if previous.NotModified {
+		attempt.BodyRef = previous.BodyRef
+	}
+
+	if attempt.ETag == "" {
+		attempt.ETag = previous.ETag
+	}
+
+	if attempt.LastModified == "" {
+		attempt.LastModified = previous.LastModified
+	}
+}
+
+func (f *Fetcher) checkRobots(task *model.Task) robots.Decision {
+	if f.robots == nil {
+		return robots.Decision{Allowed: true}
+	}
+
+	u, err := targetUrl(task)
+	if err != nil {
+		// let the fetch itself report the malformed url
+		return robots.Decision{Allowed: true}
 	}
 
-	return string(body)
+	return f.robots.Check(context.Background(), u)
 }
 
-func (f *Fetcher) worker(finish chan bool, assignmentsIn chan *assignment, assignmentsOut chan *assignment) func() {
+// process fetches the assignment's task and fills in its result. It returns false
+// when the fetch was deferred because the host's crawl delay did not pass yet.
+func (f *Fetcher) process(a *assignment) bool {
+	start := time.Now()
+
+	ctx, span := tracing.Start(tracing.WithParent(a.context(), a.trace), "fetch task",
+		label.Int("task.id", a.task.Id),
+		label.String("tenant", a.tenant),
+		label.Bool("scheduled", !a.planned.IsZero()),
+	)
+	defer span.End()
+
+	a.trace = span.SpanContext()
+
+	decision := f.checkRobots(a.task)
+	if decision.Wait > 0 {
+		span.SetAttribute("deferred", true)
+
+		// the task stays due and is picked up again once the crawl delay passes
+		logging.FromContext(ctx).Debug("fetch deferred by crawl delay", "task_id", a.task.Id, "wait_ms", decision.Wait)
+		return false
+	}
+
+	a.result = &model.Attempt{Outcome: model.OutcomeBlocked}
+
+	if !a.planned.IsZero() {
+		drift := start.Sub(a.planned)
+
+		a.result.PlannedAtMs = unixMs(a.planned)
+		a.result.DriftMs = drift.Milliseconds()
+		f.drift.add(drift)
+	}
+
+	var res *response
+	if decision.Allowed {
+		var err error
+
+		res, err = f.fetchUrl(ctx, a.task, a.previous)
+		if err != nil {
+			span.RecordError(ctx, err, trace.WithErrorStatus(codes.Unknown))
+			logging.FromContext(ctx).Warn("fetching url failed", "task_id", a.task.Id, "url", a.task.Url, "error", err)
+			a.result.Outcome = model.OutcomeError
+		}
+	}
+
+	end := time.Now()
+
+	a.result.CreatedAt = end.Unix()
+	a.result.Duration = end.Sub(start).Seconds()
+
+	if res != nil {
+		fillAttempt(a.result, res, a.previous)
+	}
+
+	// assertions need the full body, extractors may drop it
+	a.result.Assertions = health.Evaluate(a.task.Assertions, a.result)
+	applyExtractors(a.task, a.result, a.previous)
+
+	if a.task.HealthCheck {
+		a.result.Response = ""
+	}
+
+	if !a.dryRun {
+		f.metrics.observe(a.result, res)
+	}
+	span.SetAttributes(label.String("outcome", a.result.Outcome), label.Int("http.status_code", a.result.StatusCode))
+
+	return true
+}
+
+func (f *Fetcher) worker(id int, finish chan bool, assignmentsIn chan *assignment, assignmentsOut chan *assignment) {
 	for {
 		select {
 		case a := <-assignmentsIn:
-			start := time.Now()
-			response := fetchUrl(a.task.Url)
-			end := time.Now()
-
-			a.result = &model.Attempt{
-				Response:  response,
-				CreatedAt: end.Unix(),
-				Duration:  end.Sub(start).Seconds(),
+			f.start(a)
+
+			idle := f.state.work(id, a)
+			done := f.metrics.working()
+			processed := f.process(a)
+			done()
+			idle()
+
+			if processed {
+				select {
+				case assignmentsOut <- a:
+				case <-finish:
+					f.release(a)
+					a.finish(errStopped)
+					return
+				}
+			} else {
+				f.release(a)
+				a.finish(errDeferred)
 			}
 
-			assignmentsOut <- a
-
 		case <-finish:
-			break
+			return
 		}
 	}
 }
 
+// Start runs the scheduler and the workers, the returned function stops them once the
+// running fetches are saved.
 func (f *Fetcher) Start() func() {
 	finish := make(chan bool)
 	ticker := time.NewTicker(defaultTickerInterval)
 
 	tasks := make(chan *assignment)
 	results := make(chan *assignment)
+
+	f.state.start(time.Now(), defaultWorkers)
+
+	f.pendingMutex.Lock()
+	f.assignments = tasks
+	f.finish = finish
+	f.pendingMutex.Unlock()
+
+	var running sync.WaitGroup
+	running.Add(defaultWorkers + 2)
+
 	for i := 0; i < defaultWorkers; i++ {
-		go f.worker(finish, tasks, results)
+		go func(i int) {
+			defer running.Done()
+			f.worker(i, finish, tasks, results)
+		}(i)
 	}
-	go f.saver(finish, results)
-	go f.retriever(finish, ticker, tasks)
+
+	go func() {
+		defer running.Done()
+		f.saver(finish, results)
+	}()
+
+	go func() {
+		defer running.Done()
+		f.retriever(finish, ticker)
+	}()
 
 	return func() {
 		ticker.Stop()
-		finish <- true
+		f.state.stop()
+
+		// plan drops new assignments from here on
+		f.pendingMutex.Lock()
+		f.assignments = nil
+		f.finish = nil
+		close(finish)
+		f.pendingMutex.Unlock()
+
+		// running fetches and saves are finished, planned ones are released
+		running.Wait()
+		f.drop()
 	}
 }
 
-func (f *Fetcher) Create(w http.ResponseWriter, r *http.Request) {
-	d := json.NewDecoder(r.Body)
+// decodeTask reads and validates a task spec from the request body.
+func decodeTask(r *http.Request) (*model.Task, error) {
+	defer util.MustClose(r.Body)
+
 	var task model.Task
 
-	err := d.Decode(&task)
+	err := json.NewDecoder(r.Body).Decode(&task)
+	if err != nil {
+		return nil, util.ErrValidation
+	}
+
+	err = validateTask(&task)
+	if err != nil {
+		return nil, err
+	}
+
+	return &task, nil
+}
+
+func (f *Fetcher) Create(w http.ResponseWriter, r *http.Request) {
+	task, err := decodeTask(r)
 	if err != nil {
-		util.EmitHttpError(w, util.ErrValidation)
+		util.EmitHttpError(w, err)
 		return
 	}
 
-	defer util.MustClose(r.Body)
+	err = f.checkGroup(r.Context(), task)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
 
-	task.Id = int(f.idGen(maxId))
-	err = f.storage.Create(r.Context(), &task)
+	err = f.checkQuota(r.Context(), task)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	task.CreatedAt = time.Now().Unix()
+	err = f.createTask(r.Context(), task)
 	if err != nil {
 		util.EmitHttpError(w, err)
 		return
@@ -193,56 +741,84 @@ func (f *Fetcher) Create(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Location", strconv.Itoa(task.Id))
 }
 
-func (f *Fetcher) Delete(w http.ResponseWriter, r *http.Request) {
+func taskId(r *http.Request) (int, error) {
 	ids, ok := mux.Vars(r)["id"]
 	if !ok {
-		util.EmitHttpError(w, util.ErrValidation)
-		return
+		return 0, util.ErrValidation
 	}
 
 	id, err := strconv.Atoi(ids)
 	if err != nil {
-		util.EmitHttpError(w, util.ErrValidation)
-		return
+		return 0, util.ErrValidation
 	}
 
-	task, err := f.storage.Get(r.Context(), id)
+	return id, nil
+}
+
+func (f *Fetcher) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := taskId(r)
 	if err != nil {
 		util.EmitHttpError(w, err)
 		return
 	}
 
-	err = f.storage.Delete(r.Context(), task.Id)
+	err = f.deleteTask(r.Context(), id)
 	if err != nil {
 		util.EmitHttpError(w, err)
 		return
 	}
 }
 
+// List returns a page of tasks, the number of all matching tasks is in the X-Total-Count header.
 func (f *Fetcher) List(w http.ResponseWriter, r *http.Request) {
-	tasks, err := f.storage.ListTasks(r.Context())
+	q, err := parseTaskQuery(r.URL.Query())
 	if err != nil {
 		util.EmitHttpError(w, err)
 		return
 	}
 
-	err = json.NewEncoder(w).Encode(&tasks)
+	tasks, total, err := f.storage.QueryTasks(r.Context(), q)
 	if err != nil {
 		util.EmitHttpError(w, err)
 		return
 	}
-}
 
-func (f *Fetcher) History(w http.ResponseWriter, r *http.Request) {
-	ids, ok := mux.Vars(r)["id"]
-	if !ok {
-		util.EmitHttpError(w, util.ErrValidation)
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	now := time.Now()
+
+	for i := range tasks {
+		// the full history with its bodies is not needed to plan the next run
+		last, err := f.storage.LastAttempt(r.Context(), tasks[i].Id)
+		if err != nil {
+			util.EmitHttpError(w, err)
+			return
+		}
+
+		var attempts []*model.Attempt
+		if last != nil {
+			attempts = append(attempts, last)
+		}
+
+		next, err := nextRun(f.resolve(r.Context(), tasks[i]), attempts, now)
+		if err == nil && !next.IsZero() {
+			tasks[i].NextRunAt = next.Unix()
+		}
+
+		tasks[i] = redact(tasks[i])
+	}
+
+	err = json.NewEncoder(w).Encode(&tasks)
+	if err != nil {
+		util.EmitHttpError(w, err)
 		return
 	}
+}
 
-	id, err := strconv.Atoi(ids)
+func (f *Fetcher) History(w http.ResponseWriter, r *http.Request) {
+	id, err := taskId(r)
 	if err != nil {
-		util.EmitHttpError(w, util.ErrValidation)
+		util.EmitHttpError(w, err)
 		return
 	}
 
@@ -252,6 +828,19 @@ func (f *Fetcher) History(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.URL.Query().Get("changed_only") == "true" {
+		changed := make([]*model.Attempt, 0, len(attempts))
+		for _, a := range attempts {
+			if a.Changed {
+				changed = append(changed, a)
+			}
+		}
+
+		attempts = changed
+	}
+
+	attempts = filterExtracted(r, attempts)
+
 	err = json.NewEncoder(w).Encode(&attempts)
 	if err != nil {
 		util.EmitHttpError(w, err)
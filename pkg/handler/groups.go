@@ -0,0 +1,240 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"crawler/pkg/logging"
+	"crawler/pkg/model"
+	"crawler/pkg/schedule"
+	"crawler/pkg/util"
+)
+
+// maxRetention is the most attempts a task keeps, the limit of the redis store
+const maxRetention = 100
+
+var groupNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,64}$`)
+
+func validGroupName(name string) bool {
+	return groupNamePattern.MatchString(name)
+}
+
+func validateGroup(g *model.Group) error {
+	if !validGroupName(g.Name) {
+		return util.Wrap(util.ErrValidation, "invalid group name")
+	}
+
+	if g.Interval < 0 {
+		return util.Wrap(util.ErrValidation, "interval must not be negative")
+	}
+
+	if g.Retention < 0 || g.Retention > maxRetention {
+		return util.Wrap(util.ErrValidation, fmt.Sprintf("retention must be between 0 and %d", maxRetention))
+	}
+
+	for k := range g.Headers {
+		if k == "" || strings.ContainsAny(k, " :\r\n") {
+			return util.Wrap(util.ErrValidation, "invalid header name")
+		}
+	}
+
+	if redacted(g.Headers) {
+		return util.Wrap(util.ErrValidation, "redacted header value")
+	}
+
+	return nil
+}
+
+// checkGroup makes sure the group of a new task exists and provides an interval
+// when the task has none.
+func (f *Fetcher) checkGroup(ctx context.Context, task *model.Task) error {
+	if task.Group == "" {
+		return nil
+	}
+
+	group, err := f.storage.GetGroup(ctx, task.Group)
+	if errors.Is(err, util.ErrResourceNotFound) {
+		return util.Wrap(util.ErrValidation, "unknown group "+task.Group)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = schedule.New(group.Apply(task))
+
+	return err
+}
+
+// stranded returns the ids of the group's members which have no interval of their own
+// and would not get one from the group's new settings, g is nil when it is deleted.
+func (f *Fetcher) stranded(ctx context.Context, name string, g *model.Group) ([]string, error) {
+	tasks, err := f.storage.ListTasks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+
+	for _, task := range tasks {
+		if task.Group != name {
+			continue
+		}
+
+		if g != nil {
+			task = g.Apply(task)
+		}
+
+		_, err = schedule.New(task)
+		if errors.Is(err, schedule.ErrNoInterval) {
+			ids = append(ids, strconv.Itoa(task.Id))
+		}
+	}
+
+	return ids, nil
+}
+
+// checkStranded refuses a group change which leaves members without an interval,
+// the response lists them.
+func (f *Fetcher) checkStranded(w http.ResponseWriter, r *http.Request, g *model.Group) bool {
+	ids, err := f.stranded(r.Context(), mux.Vars(r)["name"], g)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return false
+	}
+
+	if len(ids) > 0 {
+		http.Error(w, "tasks without an interval: "+strings.Join(ids, ","), http.StatusConflict)
+		return false
+	}
+
+	return true
+}
+
+// resolve returns the task with the settings inherited from its group. Tasks
+// of deleted groups keep only their own settings.
+func (f *Fetcher) resolve(ctx context.Context, task *model.Task) *model.Task {
+	if task.Group == "" {
+		return task
+	}
+
+	g, err := f.storage.GetGroup(ctx, task.Group)
+	if err != nil {
+		if !errors.Is(err, util.ErrResourceNotFound) {
+			logging.FromContext(ctx).Error("getting group failed", "task_id", task.Id, "group", task.Group, "error", err)
+		}
+
+		return task
+	}
+
+	return g.Apply(task)
+}
+
+// groups returns all groups by name.
+func (f *Fetcher) groups(ctx context.Context) (map[string]*model.Group, error) {
+	groups, err := f.storage.ListGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*model.Group, len(groups))
+	for _, g := range groups {
+		byName[g.Name] = g
+	}
+
+	return byName, nil
+}
+
+func (f *Fetcher) Groups(w http.ResponseWriter, r *http.Request) {
+	groups, err := f.storage.ListGroups(r.Context())
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	for i := range groups {
+		groups[i] = redactGroup(groups[i])
+	}
+
+	err = json.NewEncoder(w).Encode(groups)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+}
+
+func (f *Fetcher) Group(w http.ResponseWriter, r *http.Request) {
+	g, err := f.storage.GetGroup(r.Context(), mux.Vars(r)["name"])
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(redactGroup(g))
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+}
+
+// SaveGroup creates or replaces a group, its members inherit the new settings from their next run.
+// It is refused when members without an interval of their own would not get one anymore.
+func (f *Fetcher) SaveGroup(w http.ResponseWriter, r *http.Request) {
+	defer util.MustClose(r.Body)
+
+	var g model.Group
+
+	err := json.NewDecoder(r.Body).Decode(&g)
+	if err != nil {
+		util.EmitHttpError(w, util.ErrValidation)
+		return
+	}
+
+	g.Name = mux.Vars(r)["name"]
+
+	err = validateGroup(&g)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	if tenant, ok := f.tenants[util.Tenant(r.Context())]; ok && g.Interval > 0 {
+		err = checkInterval(tenant, int64(g.Interval)*1000, nil)
+		if err != nil {
+			util.EmitHttpError(w, err)
+			return
+		}
+	}
+
+	if !f.checkStranded(w, r, &g) {
+		return
+	}
+
+	err = f.saveGroup(r.Context(), &g)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+}
+
+// DeleteGroup removes a group, its members keep only their own settings. It is refused
+// while members depend on the group's interval.
+func (f *Fetcher) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	if !f.checkStranded(w, r, nil) {
+		return
+	}
+
+	err := f.deleteGroup(r.Context(), mux.Vars(r)["name"])
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+}
@@ -3,21 +3,40 @@
 package handler
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"crawler/pkg/auth"
+	"crawler/pkg/health"
+	"crawler/pkg/logging"
+	"crawler/pkg/metrics"
+	"crawler/pkg/model"
+	"crawler/pkg/robots"
 	"crawler/pkg/store"
 	"crawler/pkg/store/memory"
+	"crawler/pkg/stream"
+	"crawler/pkg/tracing"
 	"crawler/pkg/util"
 
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/api/global"
 )
 
 type httpTestCase struct {
@@ -98,6 +117,38 @@ const (
 			"url": "
 		}
 	`
+
+	createWithRequest = `
+		{
+			"url": "http://localhost:8081/api",
+			"interval": 1,
+			"method": "post",
+			"headers": {"Accept": "application/json"},
+			"body": "{}"
+		}
+	`
+
+	createInvalidMethod = `
+		{
+			"url": "http://localhost:8081/api",
+			"interval": 1,
+			"method": "FETCH"
+		}
+	`
+
+	createWithoutInterval = `
+		{
+			"url": "http://localhost:8081/api",
+			"interval": 0
+		}
+	`
+	createGetWithBody = `
+		{
+			"url": "http://localhost:8081/api",
+			"interval": 1,
+			"body": "{}"
+		}
+	`
 )
 
 func TestCreateTask(t *testing.T) {
@@ -116,6 +167,34 @@ func TestCreateTask(t *testing.T) {
 			payload:            createInvalid,
 			expectedStatusCode: http.StatusBadRequest,
 		},
+		{
+			name:               "ok - custom request",
+			method:             "POST",
+			path:               "/api/fetcher",
+			payload:            createWithRequest,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "error - unsupported method",
+			method:             "POST",
+			path:               "/api/fetcher",
+			payload:            createInvalidMethod,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "error - body with GET",
+			method:             "POST",
+			path:               "/api/fetcher",
+			payload:            createGetWithBody,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "error - no interval",
+			method:             "POST",
+			path:               "/api/fetcher",
+			payload:            createWithoutInterval,
+			expectedStatusCode: http.StatusBadRequest,
+		},
 		{
 			name:               "error - wrong path",
 			method:             "POST",
@@ -306,18 +385,1683 @@ func TestGetTasks(t *testing.T) {
 	}
 }
 
-func makeRequest(t *testing.T, storage store.Store, idGen func(int64) int64, method, path, payload string) *http.Response {
+func TestFetchCustomRequest(t *testing.T) {
+	var received *http.Request
+	var receivedBody string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = r
+		receivedBody = string(body)
+
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer ts.Close()
+
+	fetcher := NewFetcher(memory.NewMemory(), util.GenID, WithUserAgent("global/1.0"))
+
+	res, err := fetcher.fetchUrl(context.Background(), &model.Task{
+		Url:     ts.URL + "/path?a=1",
+		Method:  "POST",
+		Headers: map[string]string{"Accept": "application/json"},
+		Query:   map[string]string{"b": "2"},
+		Body:    `{"key":"value"}`,
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", res.body)
+
+	assert.Equal(t, "POST", received.Method)
+	assert.Equal(t, "/path", received.URL.Path)
+	assert.Equal(t, "1", received.URL.Query().Get("a"))
+	assert.Equal(t, "2", received.URL.Query().Get("b"))
+	assert.Equal(t, "application/json", received.Header.Get("Accept"))
+	assert.Equal(t, "global/1.0", received.Header.Get("User-Agent"))
+	assert.Equal(t, `{"key":"value"}`, receivedBody)
+
+	_, err = fetcher.fetchUrl(context.Background(), &model.Task{Url: ts.URL, UserAgent: "task/2.0"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "GET", received.Method)
+	assert.Equal(t, "task/2.0", received.Header.Get("User-Agent"))
+}
+
+func TestListRedactsCredentials(t *testing.T) {
+	storage := memory.NewMemory()
+
+	payload := `
+		{
+			"url": "http://localhost:8081/api",
+			"interval": 1,
+			"headers": {"Authorization": "Basic dXNlcjpwYXNz", "Accept": "text/plain"},
+			"query": {"api_key": "123", "page": "1"},
+			"auth": {"type": "bearer", "token_ref": "api-token"}
+		}
+	`
+
+	resp := makeRequest(t, storage, util.GenID, "POST", "/api/fetcher", payload)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = makeRequest(t, storage, util.GenID, "GET", "/api/fetcher", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var tasks []*model.Task
+	err := json.NewDecoder(resp.Body).Decode(&tasks)
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+
+	assert.Equal(t, map[string]string{"Authorization": model.Redacted, "Accept": "text/plain"}, tasks[0].Headers)
+	assert.Equal(t, map[string]string{"api_key": model.Redacted, "page": "1"}, tasks[0].Query)
+	assert.Equal(t, "api-token", tasks[0].Auth.TokenRef)
+
+	resp = makeRequest(t, storage, util.GenID, "POST", "/api/fetcher", `{"url": "http://localhost", "auth": {"type": "basic"}}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestCookieSession(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, err := r.Cookie("session")
+		if err != nil {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1", Path: "/"})
+			_, _ = io.WriteString(w, "new")
+			return
+		}
+
+		_, _ = io.WriteString(w, "known "+session.Value)
+	}))
+	defer ts.Close()
+
+	storage := memory.NewMemory()
+	idGen := func(_ int64) int64 { return 123 }
+
+	resp := makeRequest(t, storage, idGen, "POST", "/api/fetcher", fmt.Sprintf(`{"url": "%s", "interval": 60, "cookies": true}`, ts.URL))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	task, err := storage.Get(context.Background(), 123)
+	require.NoError(t, err)
+
 	fetcher := NewFetcher(storage, idGen)
-	router := NewRouter(fetcher)
 
-	ts := httptest.NewServer(router)
-	client := ts.Client()
+	res, err := fetcher.fetchUrl(context.Background(), task, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "new", res.body)
 
-	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(payload))
+	res, err = fetcher.fetchUrl(context.Background(), task, nil)
 	require.NoError(t, err)
+	assert.Equal(t, "known s1", res.body)
 
-	resp, err := client.Do(req)
+	resp = makeRequest(t, storage, idGen, "GET", "/api/fetcher/123/cookies", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var stored []*model.Cookie
+	err = json.NewDecoder(resp.Body).Decode(&stored)
 	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	assert.Equal(t, "s1", stored[0].Value)
 
-	return resp
+	resp = makeRequest(t, storage, idGen, "DELETE", "/api/fetcher/123/cookies", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	res, err = fetcher.fetchUrl(context.Background(), task, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "new", res.body)
+}
+
+func TestConditionalFetch(t *testing.T) {
+	const lastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` && r.Header.Get("If-Modified-Since") == lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", lastModified)
+		_, _ = io.WriteString(w, "content")
+	}))
+	defer ts.Close()
+
+	fetcher := NewFetcher(memory.NewMemory(), util.GenID)
+	task := &model.Task{Url: ts.URL}
+
+	first := &model.Attempt{Id: 1}
+	res, err := fetcher.fetchUrl(context.Background(), task, nil)
+	require.NoError(t, err)
+	fillAttempt(first, res, nil)
+
+	assert.Equal(t, "content", first.Response)
+	assert.Equal(t, http.StatusOK, first.StatusCode)
+	assert.Equal(t, `"v1"`, first.ETag)
+	assert.False(t, first.NotModified)
+
+	second := &model.Attempt{Id: 2}
+	res, err = fetcher.fetchUrl(context.Background(), task, first)
+	require.NoError(t, err)
+	fillAttempt(second, res, first)
+
+	assert.Equal(t, "", second.Response)
+	assert.Equal(t, http.StatusNotModified, second.StatusCode)
+	assert.True(t, second.NotModified)
+	assert.Equal(t, int64(1), second.BodyRef)
+	assert.Equal(t, `"v1"`, second.ETag)
+	assert.Equal(t, lastModified, second.LastModified)
+
+	third := &model.Attempt{Id: 3}
+	res, err = fetcher.fetchUrl(context.Background(), task, second)
+	require.NoError(t, err)
+	fillAttempt(third, res, second)
+
+	assert.True(t, third.NotModified)
+	assert.Equal(t, int64(1), third.BodyRef)
+}
+
+func TestHistoryChanges(t *testing.T) {
+	storage := memory.NewMemory()
+	idGen := func(_ int64) int64 { return 123 }
+
+	resp := makeRequest(t, storage, idGen, "POST", "/api/fetcher", createValid)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var previous *model.Attempt
+	for _, body := range []string{"a\nb\nc\n", "a\nb\nc\n", "a\nB\nc\n"} {
+		attempt := &model.Attempt{CreatedAt: 1000}
+		fillAttempt(attempt, &response{body: body, statusCode: http.StatusOK}, previous)
+
+		err := storage.AddAttempt(context.Background(), 123, attempt)
+		require.NoError(t, err)
+
+		previous = attempt
+	}
+
+	resp = makeRequest(t, storage, idGen, "GET", "/api/fetcher/123/history?changed_only=true", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var attempts []*model.Attempt
+	err := json.NewDecoder(resp.Body).Decode(&attempts)
+	require.NoError(t, err)
+	require.Len(t, attempts, 2)
+	assert.Equal(t, int64(1), attempts[0].Id)
+	assert.Equal(t, int64(3), attempts[1].Id)
+
+	resp = makeRequest(t, storage, idGen, "GET", "/api/fetcher/123/history/1/diff/3", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "--- attempt 1")
+	assert.Contains(t, string(body), "-b\n+B\n")
+
+	resp = makeRequest(t, storage, idGen, "GET", "/api/fetcher/123/history/1/diff/9", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestExtractOnlyHistory(t *testing.T) {
+	storage := memory.NewMemory()
+	idGen := func(_ int64) int64 { return 123 }
+
+	payload := `
+		{
+			"url": "http://localhost:8081/api",
+			"interval": 1,
+			"extract_only": true,
+			"extractors": [{"name": "price", "type": "json", "expr": "$.price"}]
+		}
+	`
+
+	resp := makeRequest(t, storage, idGen, "POST", "/api/fetcher", payload)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	task, err := storage.Get(context.Background(), 123)
+	require.NoError(t, err)
+
+	var previous *model.Attempt
+	for _, body := range []string{`{"price": 10, "ts": 1}`, `{"price": 10, "ts": 2}`, `{"price": 12, "ts": 3}`} {
+		attempt := &model.Attempt{CreatedAt: 1000}
+		fillAttempt(attempt, &response{body: body, statusCode: http.StatusOK}, previous)
+		applyExtractors(task, attempt, previous)
+
+		err := storage.AddAttempt(context.Background(), 123, attempt)
+		require.NoError(t, err)
+
+		previous = attempt
+	}
+
+	resp = makeRequest(t, storage, idGen, "GET", "/api/fetcher/123/history?extracted.price=10", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var attempts []*model.Attempt
+	err = json.NewDecoder(resp.Body).Decode(&attempts)
+	require.NoError(t, err)
+	require.Len(t, attempts, 2)
+
+	for _, a := range attempts {
+		assert.Equal(t, "", a.Response)
+		assert.Equal(t, map[string]string{"price": "10"}, a.Extracted)
+	}
+
+	// only the extracted value is compared, the changing timestamp is ignored
+	assert.True(t, attempts[0].Changed)
+	assert.False(t, attempts[1].Changed)
+
+	resp = makeRequest(t, storage, idGen, "GET", "/api/fetcher/123/history?changed_only=true&extracted.price=12", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	err = json.NewDecoder(resp.Body).Decode(&attempts)
+	require.NoError(t, err)
+	require.Len(t, attempts, 1)
+	assert.Equal(t, int64(3), attempts[0].Id)
+
+	payload = `{"url": "http://localhost", "extractors": [{"name": "x", "type": "regex", "expr": "("}]}`
+	resp = makeRequest(t, storage, idGen, "POST", "/api/fetcher", payload)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestHealthStatus(t *testing.T) {
+	storage := memory.NewMemory()
+	idGen := func(_ int64) int64 { return 123 }
+
+	payload := `
+		{
+			"url": "http://localhost:8081/health",
+			"interval": 1,
+			"health_check": true,
+			"assertions": {"status_codes": [200], "json_fields": {"$.status": "ok"}}
+		}
+	`
+
+	resp := makeRequest(t, storage, idGen, "POST", "/api/fetcher", payload)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = makeRequest(t, storage, idGen, "GET", "/api/fetcher/123/status", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var status model.TaskStatus
+	err := json.NewDecoder(resp.Body).Decode(&status)
+	require.NoError(t, err)
+	assert.Equal(t, model.StateUnknown, status.State)
+
+	task, err := storage.Get(context.Background(), 123)
+	require.NoError(t, err)
+
+	for i, res := range []*response{
+		{body: `{"status": "ok"}`, statusCode: http.StatusOK},
+		{body: `{"status": "ok"}`, statusCode: http.StatusOK},
+		{body: `{"status": "degraded"}`, statusCode: http.StatusOK},
+		{body: `{"status": "ok"}`, statusCode: http.StatusServiceUnavailable},
+	} {
+		attempt := &model.Attempt{CreatedAt: int64(1000 + i)}
+		fillAttempt(attempt, res, nil)
+		attempt.Assertions = health.Evaluate(task.Assertions, attempt)
+
+		err := storage.AddAttempt(context.Background(), 123, attempt)
+		require.NoError(t, err)
+	}
+
+	resp = makeRequest(t, storage, idGen, "GET", "/api/fetcher/123/status", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	require.NoError(t, err)
+	assert.Equal(t, model.StateDown, status.State)
+	assert.Equal(t, 4, status.Checks)
+	assert.Equal(t, 2, status.Passed)
+	assert.Equal(t, 50.0, status.Uptime)
+	assert.Equal(t, int64(1002), status.Since)
+	assert.Equal(t, []string{"status code 503 not in [200]"}, status.Failures)
+
+	payload = `{"url": "http://localhost", "health_check": true}`
+	resp = makeRequest(t, storage, idGen, "POST", "/api/fetcher", payload)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	payload = `{"url": "http://localhost", "assertions": {"body_regex": "("}}`
+	resp = makeRequest(t, storage, idGen, "POST", "/api/fetcher", payload)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = makeRequest(t, storage, idGen, "GET", "/api/fetcher/9/status", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	storage := memory.NewMemory()
+	idGen := func(_ int64) int64 { return 123 }
+
+	payload := `{"url": "http://localhost", "webhooks": [{"url": "http://hooks", "events": ["exploded"]}]}`
+	resp := makeRequest(t, storage, idGen, "POST", "/api/fetcher", payload)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	payload = `{"url": "http://localhost", "interval": 60, "webhooks": [{"url": "http://hooks", "events": ["recovered"]}]}`
+	resp = makeRequest(t, storage, idGen, "POST", "/api/fetcher", payload)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	delivery := &model.Delivery{Event: model.EventRecovered, Url: "http://hooks", Tries: 1, Delivered: true}
+	err := storage.AddDelivery(context.Background(), 123, delivery)
+	require.NoError(t, err)
+
+	resp = makeRequest(t, storage, idGen, "GET", "/api/fetcher/123/deliveries", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var deliveries []*model.Delivery
+	err = json.NewDecoder(resp.Body).Decode(&deliveries)
+	require.NoError(t, err)
+	assert.Equal(t, []*model.Delivery{delivery}, deliveries)
+
+	resp = makeRequest(t, storage, idGen, "GET", "/api/fetcher/9/deliveries", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestEventStream(t *testing.T) {
+	storage := memory.NewMemory()
+	ctx := context.Background()
+
+	for _, id := range []int{1, 2} {
+		err := storage.Create(ctx, &model.Task{Id: id, Url: "http://localhost"})
+		require.NoError(t, err)
+	}
+
+	for _, a := range []struct {
+		task      int
+		createdAt int64
+	}{{1, 100}, {1, 200}, {2, 150}} {
+		err := storage.AddAttempt(ctx, a.task, &model.Attempt{Outcome: model.OutcomeSuccess, CreatedAt: a.createdAt})
+		require.NoError(t, err)
+	}
+
+	fetcher := NewFetcher(storage, nil)
+	ts := httptest.NewServer(NewRouter(fetcher))
+	defer ts.Close()
+
+	// readEvents connects to the stream, publishes the live attempt and returns the ids of the first n events
+	readEvents := func(path, lastEventId string, live *stream.Message, n int) []string {
+		req, err := http.NewRequest("GET", ts.URL+path, nil)
+		require.NoError(t, err)
+
+		if lastEventId != "" {
+			req.Header.Set("Last-Event-ID", lastEventId)
+		}
+
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		err = fetcher.publisher.Publish(ctx, live)
+		require.NoError(t, err)
+
+		var ids []string
+
+		scanner := bufio.NewScanner(resp.Body)
+		for len(ids) < n && scanner.Scan() {
+			if strings.HasPrefix(scanner.Text(), "id: ") {
+				ids = append(ids, strings.TrimPrefix(scanner.Text(), "id: "))
+			}
+		}
+
+		return ids
+	}
+
+	live := &stream.Message{TaskId: 1, Attempt: &model.Attempt{Id: 3, CreatedAt: 300}}
+
+	ids := readEvents("/api/fetcher/1/events", "1", live, 2)
+	assert.Equal(t, []string{"2", "3"}, ids)
+
+	ids = readEvents("/api/events", "150:2:1", live, 2)
+	assert.Equal(t, []string{"200:1:2", "300:1:3"}, ids)
+
+	resp := makeRequest(t, storage, nil, "GET", "/api/fetcher/9/events", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	req, err := http.NewRequest("GET", ts.URL+"/api/events", nil)
+	require.NoError(t, err)
+	req.Header.Set("Last-Event-ID", "garbage")
+
+	resp, err = ts.Client().Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestRunNow(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "fresh")
+	}))
+	defer target.Close()
+
+	storage := memory.NewMemory()
+	idGen := func(_ int64) int64 { return 123 }
+
+	err := storage.Create(context.Background(), &model.Task{Id: 123, Url: target.URL, Interval: 3600})
+	require.NoError(t, err)
+
+	resp := makeRequest(t, storage, idGen, "POST", "/api/fetcher/123/run?wait=true", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var attempt model.Attempt
+	err = json.NewDecoder(resp.Body).Decode(&attempt)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), attempt.Id)
+	assert.Equal(t, "fresh", attempt.Response)
+	assert.Equal(t, model.OutcomeSuccess, attempt.Outcome)
+
+	resp = makeRequest(t, storage, idGen, "POST", "/api/fetcher/123/run", "")
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	assert.Eventually(t, func() bool {
+		attempts, err := storage.ListAttempts(context.Background(), 123)
+		return err == nil && len(attempts) == 2
+	}, time.Second, time.Millisecond*10)
+
+	resp = makeRequest(t, storage, idGen, "POST", "/api/fetcher/9/run", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// a planned fetch of the task refuses manual runs until it is done
+	fetcher := NewFetcher(storage, idGen)
+	ts := httptest.NewServer(NewRouter(fetcher))
+	defer ts.Close()
+
+	planned := &assignment{task: &model.Task{Id: 123}, planned: time.Now().Add(time.Hour)}
+	require.True(t, fetcher.reserve(planned))
+
+	resp, err = ts.Client().Post(ts.URL+"/api/fetcher/123/run", "application/json", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	fetcher.release(planned)
+
+	// with a started scheduler the workers fetch it
+	stop := fetcher.Start()
+	defer stop()
+
+	resp, err = ts.Client().Post(ts.URL+"/api/fetcher/123/run?wait=true", "application/json", nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	err = json.NewDecoder(resp.Body).Decode(&attempt)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), attempt.Id)
+
+	// runs no worker picks up are released once the scheduler stops or the client gives up
+	busy := NewFetcher(storage, idGen)
+	busy.assignments = make(chan *assignment)
+	busy.finish = make(chan bool)
+
+	busyServer := httptest.NewServer(NewRouter(busy))
+	defer busyServer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", busyServer.URL+"/api/fetcher/123/run?wait=true", nil)
+	require.NoError(t, err)
+
+	_, err = busyServer.Client().Do(req)
+	assert.Error(t, err)
+	assert.Eventually(t, func() bool {
+		return !busy.reserved("", 123)
+	}, time.Second, time.Millisecond*10)
+
+	time.AfterFunc(time.Millisecond*100, func() { close(busy.finish) })
+
+	resp, err = busyServer.Client().Post(busyServer.URL+"/api/fetcher/123/run?wait=true", "application/json", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.False(t, busy.reserved("", 123))
+}
+
+func TestRobotsQuery(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			_, _ = io.WriteString(w, "User-agent: *\nDisallow: /*?session=\n")
+			return
+		}
+
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer target.Close()
+
+	storage := memory.NewMemory()
+
+	// the disallowed parameter is only added by the task's query
+	err := storage.Create(context.Background(), &model.Task{Id: 1, Url: target.URL + "/page", Interval: 60, Query: map[string]string{"session": "1"}})
+	require.NoError(t, err)
+
+	fetcher := NewFetcher(storage, nil, WithRobots(robots.NewChecker(DefaultUserAgent, robots.DefaultTTL)))
+	ts := httptest.NewServer(NewRouter(fetcher))
+	defer ts.Close()
+
+	resp, err := ts.Client().Post(ts.URL+"/api/fetcher/1/run?wait=true", "application/json", nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var attempt model.Attempt
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&attempt))
+	assert.Equal(t, model.OutcomeBlocked, attempt.Outcome)
+}
+
+func TestDryRun(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"status": "ok"}`)
+	}))
+	defer target.Close()
+
+	storage := memory.NewMemory()
+	idGen := func(_ int64) int64 { return 123 }
+
+	payload := fmt.Sprintf(`
+		{
+			"url": "%s",
+			"interval": 60,
+			"cookies": true,
+			"extractors": [{"name": "status", "type": "json", "expr": "$.status"}],
+			"assertions": {"status_codes": [200]}
+		}
+	`, target.URL)
+
+	resp := makeRequest(t, storage, idGen, "POST", "/api/fetcher/test", payload)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var attempt model.Attempt
+	err := json.NewDecoder(resp.Body).Decode(&attempt)
+	require.NoError(t, err)
+	assert.Equal(t, `{"status": "ok"}`, attempt.Response)
+	assert.Equal(t, map[string]string{"status": "ok"}, attempt.Extracted)
+	assert.Equal(t, &model.AssertionResult{Passed: true}, attempt.Assertions)
+
+	tasks, err := storage.ListTasks(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, tasks)
+
+	resp = makeRequest(t, storage, idGen, "POST", "/api/fetcher/test", `{"url": "ftp://localhost"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestScheduledTask(t *testing.T) {
+	storage := memory.NewMemory()
+	idGen := func(_ int64) int64 { return 123 }
+
+	payload := `{"url": "http://localhost", "schedule": {"cron": "*/5 9-17 * * MON-FRI", "time_zone": "Nowhere/Special"}}`
+	resp := makeRequest(t, storage, idGen, "POST", "/api/fetcher", payload)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	payload = `{"url": "http://localhost", "schedule": {"cron": "0 0 1 1 *", "time_zone": "Europe/Berlin"}}`
+	resp = makeRequest(t, storage, idGen, "POST", "/api/fetcher", payload)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = makeRequest(t, storage, idGen, "GET", "/api/fetcher", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var tasks []*model.Task
+	err := json.NewDecoder(resp.Body).Decode(&tasks)
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+
+	loc, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	next := time.Unix(tasks[0].NextRunAt, 0).In(loc)
+	assert.Equal(t, time.January, next.Month())
+	assert.Equal(t, 1, next.Day())
+	assert.Equal(t, 0, next.Hour())
+	assert.Equal(t, "0 0 1 1 *", tasks[0].Schedule.Cron)
+}
+
+func TestSubSecondInterval(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer target.Close()
+
+	storage := memory.NewMemory()
+
+	err := storage.Create(context.Background(), &model.Task{Id: 1, Url: target.URL, IntervalMs: 200})
+	require.NoError(t, err)
+
+	fetcher := NewFetcher(storage, nil)
+	stop := fetcher.Start()
+	defer stop()
+
+	var attempts []*model.Attempt
+
+	require.Eventually(t, func() bool {
+		attempts, err = storage.ListAttempts(context.Background(), 1)
+		return err == nil && len(attempts) >= 4
+	}, time.Second*5, time.Millisecond*50)
+
+	// runs after the first are planned by the interval, not by the once per second tick
+	for i := 2; i < 4; i++ {
+		assert.Equal(t, int64(200), attempts[i].PlannedAtMs-attempts[i-1].PlannedAtMs)
+	}
+
+	stats := fetcher.drift.snapshot()
+	assert.True(t, stats.Runs >= 4)
+	assert.True(t, stats.MeanDriftMs < 100, stats.MeanDriftMs)
+
+	resp := makeRequest(t, storage, nil, "GET", "/api/scheduler", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	payload := `{"url": "http://localhost", "interval_ms": 100, "jitter_ms": 500}`
+	resp = makeRequest(t, storage, nil, "POST", "/api/fetcher", payload)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestLegacyInterval(t *testing.T) {
+	storage := memory.NewMemory()
+
+	// older versions stored tasks without an interval, they ran on every tick
+	err := storage.Create(context.Background(), &model.Task{Id: 1, Url: "http://localhost"})
+	require.NoError(t, err)
+
+	fetcher := NewFetcher(storage, nil)
+
+	due := fetcher.tenantTasks(context.Background())
+	require.Len(t, due, 1)
+	assert.Equal(t, 1, due[0].task.Id)
+
+	last := time.Now().Truncate(time.Millisecond)
+	attempt := &model.Attempt{CreatedAt: last.Unix(), PlannedAtMs: unixMs(last)}
+
+	next, err := nextRun(due[0].task, []*model.Attempt{attempt}, last)
+	require.NoError(t, err)
+	assert.Equal(t, last.Add(defaultTickerInterval), next)
+
+	resp := makeRequest(t, storage, nil, "GET", "/api/fetcher", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var tasks []*model.Task
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&tasks))
+	require.Len(t, tasks, 1)
+	assert.NotZero(t, tasks[0].NextRunAt)
+}
+
+func TestStopPlanned(t *testing.T) {
+	fetcher := NewFetcher(memory.NewMemory(), nil)
+	stop := fetcher.Start()
+
+	planned := &assignment{task: &model.Task{Id: 1}, planned: time.Now().Add(time.Hour)}
+	require.True(t, fetcher.reserve(planned))
+	fetcher.plan(planned)
+
+	stop()
+
+	assert.False(t, fetcher.reserved("", 1))
+	assert.Eventually(t, func() bool {
+		return !fetcherRunning()
+	}, time.Second, time.Millisecond*10)
+
+	// follow-ups of fetches saved while stopping are not planned anymore
+	following := &assignment{task: &model.Task{Id: 2}, planned: time.Now()}
+	fetcher.plan(following)
+	assert.False(t, fetcher.reserved("", 2))
+
+	// a restarted scheduler plans the dropped task again
+	stop = fetcher.Start()
+	defer stop()
+
+	assert.True(t, fetcher.reserve(planned))
+}
+
+// fetcherRunning tells whether any goroutine runs code of a fetcher.
+func fetcherRunning() bool {
+	buf := make([]byte, 1<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+
+	return bytes.Contains(buf, []byte("handler.(*Fetcher)"))
+}
+
+func makeRequest(t *testing.T, storage store.Store, idGen func(int64) int64, method, path, payload string) *http.Response {
+	fetcher := NewFetcher(storage, idGen)
+	router := NewRouter(fetcher)
+
+	ts := httptest.NewServer(router)
+	client := ts.Client()
+
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(payload))
+	require.NoError(t, err)
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+
+	return resp
+}
+
+func TestBulkIdCollision(t *testing.T) {
+	storage := memory.NewMemory()
+
+	err := storage.Create(context.Background(), &model.Task{Id: 1, Url: "http://localhost/existing", Interval: 60})
+	require.NoError(t, err)
+
+	// draws the existing id first and then each id twice
+	ids := []int64{1, 2, 2, 3}
+	idGen := func(_ int64) int64 {
+		id := ids[0]
+		ids = ids[1:]
+		return id
+	}
+
+	payload := `[{"url": "http://localhost/a", "interval": 60}, {"url": "http://localhost/b", "interval": 60}]`
+	resp := makeRequest(t, storage, idGen, "POST", "/api/fetcher/bulk", payload)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var results []*model.BulkResult
+	err = json.NewDecoder(resp.Body).Decode(&results)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, &model.BulkResult{Index: 0, Id: 2}, results[0])
+	assert.Equal(t, &model.BulkResult{Index: 1, Id: 3}, results[1])
+
+	existing, err := storage.Get(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost/existing", existing.Url)
+
+	tasks, err := storage.ListTasks(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, tasks, 3)
+}
+
+func TestBulk(t *testing.T) {
+	storage := memory.NewMemory()
+
+	var next int64
+	idGen := func(_ int64) int64 {
+		next++
+		return next
+	}
+
+	payload := `[{"url": "http://localhost/a", "interval": 60}, {"url": "ftp://localhost"}, {"url": "http://localhost/b", "interval": "60"}]`
+	resp := makeRequest(t, storage, idGen, "POST", "/api/fetcher/bulk?atomic=true", payload)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	var results []*model.BulkResult
+	err := json.NewDecoder(resp.Body).Decode(&results)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.Empty(t, results[0].Error)
+	assert.NotEmpty(t, results[1].Error)
+	assert.NotEmpty(t, results[2].Error)
+
+	tasks, err := storage.ListTasks(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, tasks)
+
+	resp = makeRequest(t, storage, idGen, "POST", "/api/fetcher/bulk", payload)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	results = nil
+	err = json.NewDecoder(resp.Body).Decode(&results)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.Equal(t, &model.BulkResult{Index: 0, Id: 1}, results[0])
+	assert.Equal(t, 0, results[1].Id)
+
+	payload = "{\"url\": \"http://localhost/c\", \"interval\": 60, \"headers\": {\"Authorization\": \"secret\"}}\n{\"url\": \"http://localhost/d\", \"interval\": 60}\n"
+	resp = makeRequest(t, storage, idGen, "POST", "/api/fetcher/bulk?atomic=true", payload)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	results = nil
+	err = json.NewDecoder(resp.Body).Decode(&results)
+	require.NoError(t, err)
+	assert.Equal(t, []*model.BulkResult{{Index: 0, Id: 2}, {Index: 1, Id: 3}}, results)
+
+	resp = makeRequest(t, storage, idGen, "POST", "/api/fetcher/bulk", `[{"url": "http://localhost"`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = makeRequest(t, storage, idGen, "GET", "/api/fetcher/export", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var exported []*model.Task
+
+	d := json.NewDecoder(resp.Body)
+	for d.More() {
+		var task model.Task
+		require.NoError(t, d.Decode(&task))
+		exported = append(exported, &task)
+	}
+
+	require.Len(t, exported, 3)
+
+	for _, task := range exported {
+		if task.Id == 2 {
+			assert.Equal(t, model.Redacted, task.Headers["Authorization"])
+		}
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	storage := memory.NewMemory()
+
+	var next int64
+	idGen := func(_ int64) int64 {
+		next++
+		return next
+	}
+
+	payload := `[
+		{"url": "http://localhost/a", "interval": 60, "labels": {"team": "search"}, "headers": {"Accept": "text/plain"}, "query": {"page": "1"}},
+		{"url": "http://localhost/b", "schedule": {"cron": "0 6 * * *", "timezone": "Europe/Berlin"}, "retention": 5},
+		{"url": "http://localhost/c", "interval": 60, "headers": {"Authorization": "secret"}}
+	]`
+	resp := makeRequest(t, storage, idGen, "POST", "/api/fetcher/bulk?atomic=true", payload)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = makeRequest(t, storage, idGen, "GET", "/api/fetcher/export", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	export, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	// the redacted credential is not imported as it is
+	imported := memory.NewMemory()
+
+	resp = makeRequest(t, imported, idGen, "POST", "/api/fetcher/bulk", string(export))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var results []*model.BulkResult
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&results))
+	require.Len(t, results, 3)
+
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			assert.Contains(t, result.Error, "redacted")
+			failed++
+		}
+	}
+
+	assert.Equal(t, 1, failed)
+
+	tasks := func(s store.Store) []*model.Task {
+		tasks, err := s.ListTasks(context.Background())
+		require.NoError(t, err)
+
+		sort.Slice(tasks, func(i, j int) bool { return tasks[i].Url < tasks[j].Url })
+
+		for _, task := range tasks {
+			task.Id = 0
+			task.CreatedAt = 0
+		}
+
+		return tasks
+	}
+
+	assert.Equal(t, tasks(storage)[:2], tasks(imported))
+}
+
+func TestListQuery(t *testing.T) {
+	storage := memory.NewMemory()
+
+	for i, u := range []string{"http://b.example.com", "http://a.example.com", "http://c.example.com"} {
+		err := storage.Create(context.Background(), &model.Task{Id: i + 1, Url: u, Interval: 60})
+		require.NoError(t, err)
+	}
+
+	list := func(path string) []*model.Task {
+		resp := makeRequest(t, storage, nil, "GET", path, "")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "3", resp.Header.Get("X-Total-Count"))
+
+		var tasks []*model.Task
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&tasks))
+
+		return tasks
+	}
+
+	tasks := list("/api/fetcher?sort=url&order=desc&offset=1&limit=1")
+	require.Len(t, tasks, 1)
+	assert.Equal(t, 1, tasks[0].Id)
+
+	resp := makeRequest(t, storage, nil, "POST", "/api/fetcher/2/pause", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	tasks = list("/api/fetcher")
+	require.Len(t, tasks, 3)
+	assert.True(t, tasks[1].Paused)
+	assert.Zero(t, tasks[1].NextRunAt)
+	assert.NotZero(t, tasks[0].NextRunAt)
+
+	resp = makeRequest(t, storage, nil, "GET", "/api/fetcher?state=paused", "")
+	assert.Equal(t, "1", resp.Header.Get("X-Total-Count"))
+
+	resp = makeRequest(t, storage, nil, "POST", "/api/fetcher/2/resume", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = makeRequest(t, storage, nil, "GET", "/api/fetcher?state=paused", "")
+	assert.Equal(t, "0", resp.Header.Get("X-Total-Count"))
+
+	resp = makeRequest(t, storage, nil, "POST", "/api/fetcher/9/pause", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	for _, path := range []string{"/api/fetcher?limit=0", "/api/fetcher?sort=name", "/api/fetcher?state=broken", "/api/fetcher?order=up"} {
+		resp = makeRequest(t, storage, nil, "GET", path, "")
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, path)
+	}
+}
+
+func TestLabelsAndGroups(t *testing.T) {
+	var headers []http.Header
+
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header.Clone())
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer target.Close()
+
+	storage := memory.NewMemory()
+
+	var next int64
+	idGen := func(_ int64) int64 {
+		next++
+		return next
+	}
+
+	payload := `{"url": "http://localhost", "group": "payments"}`
+	resp := makeRequest(t, storage, idGen, "POST", "/api/fetcher", payload)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = makeRequest(t, storage, idGen, "PUT", "/api/groups/payments", `{"interval": 60, "headers": {"X-Team": "payments", "Accept": "*/*"}, "retention": 2}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// the group has to provide the interval the task lacks
+	resp = makeRequest(t, storage, idGen, "PUT", "/api/groups/empty", `{}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = makeRequest(t, storage, idGen, "POST", "/api/fetcher", `{"url": "http://localhost", "group": "empty"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = makeRequest(t, storage, idGen, "DELETE", "/api/groups/empty", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = makeRequest(t, storage, idGen, "PUT", "/api/groups/payments", `{"retention": 1000}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	payload = fmt.Sprintf(`{"url": "%s", "group": "payments", "labels": {"team": "payments"}, "headers": {"Accept": "text/plain"}}`, target.URL)
+	resp = makeRequest(t, storage, idGen, "POST", "/api/fetcher", payload)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	payload = `{"url": "http://localhost", "interval": 10, "labels": {"team": "search"}}`
+	resp = makeRequest(t, storage, idGen, "POST", "/api/fetcher", payload)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	payload = `{"url": "http://localhost", "labels": {"team": "a,b"}}`
+	resp = makeRequest(t, storage, idGen, "POST", "/api/fetcher", payload)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = makeRequest(t, storage, idGen, "GET", "/api/fetcher?selector=team=payments", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var tasks []*model.Task
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&tasks))
+	require.Len(t, tasks, 1)
+	assert.Equal(t, 1, tasks[0].Id)
+	assert.NotZero(t, tasks[0].NextRunAt)
+
+	// the group's headers are sent unless the task sets them and its retention applies
+	for i := 0; i < 3; i++ {
+		resp = makeRequest(t, storage, idGen, "POST", "/api/fetcher/1/run?wait=true", "")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	require.Len(t, headers, 3)
+	assert.Equal(t, "payments", headers[0].Get("X-Team"))
+	assert.Equal(t, "text/plain", headers[0].Get("Accept"))
+
+	attempts, err := storage.ListAttempts(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Len(t, attempts, 2)
+
+	resp = makeRequest(t, storage, idGen, "POST", "/api/fetcher/bulk/pause", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = makeRequest(t, storage, idGen, "POST", "/api/fetcher/bulk/pause?selector=team=payments", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var results []*model.BulkResult
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&results))
+	assert.Equal(t, []*model.BulkResult{{Index: 0, Id: 1}}, results)
+
+	task, err := storage.Get(context.Background(), 1)
+	require.NoError(t, err)
+	assert.True(t, task.Paused)
+
+	resp = makeRequest(t, storage, idGen, "POST", "/api/fetcher/bulk/delete?selector=team!=payments", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	_, err = storage.Get(context.Background(), 2)
+	assert.Equal(t, util.ErrResourceNotFound, err)
+
+	resp = makeRequest(t, storage, idGen, "GET", "/api/groups", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var groups []*model.Group
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&groups))
+	require.Len(t, groups, 1)
+	assert.Equal(t, "payments", groups[0].Name)
+
+	// credentials in group headers are hidden and redacted values are not stored
+	resp = makeRequest(t, storage, idGen, "PUT", "/api/groups/payments", `{"interval": 60, "headers": {"Authorization": "Bearer secret"}}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = makeRequest(t, storage, idGen, "GET", "/api/groups/payments", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var group model.Group
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&group))
+	assert.Equal(t, model.Redacted, group.Headers["Authorization"])
+
+	resp = makeRequest(t, storage, idGen, "GET", "/api/groups", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	groups = nil
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&groups))
+	require.Len(t, groups, 1)
+	assert.Equal(t, model.Redacted, groups[0].Headers["Authorization"])
+
+	resp = makeRequest(t, storage, idGen, "PUT", "/api/groups/payments", `{"interval": 60, "headers": {"Authorization": "[REDACTED]"}}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// task 1 depends on the group's interval
+	resp = makeRequest(t, storage, idGen, "PUT", "/api/groups/payments", `{}`)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "tasks without an interval: 1\n", string(body))
+
+	resp = makeRequest(t, storage, idGen, "DELETE", "/api/groups/payments", "")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	resp = makeRequest(t, storage, idGen, "DELETE", "/api/fetcher/1", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = makeRequest(t, storage, idGen, "DELETE", "/api/groups/payments", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = makeRequest(t, storage, idGen, "GET", "/api/groups/payments", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestTenants(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, strings.Repeat("x", 100))
+	}))
+	defer target.Close()
+
+	storage := memory.NewMemory()
+	tenants := []model.Tenant{
+		{Id: "acme", MaxTasks: 1, MinIntervalMs: 10000, MaxHistoryBytes: 50},
+		{Id: "globex"},
+	}
+	require.NoError(t, ValidateTenants(tenants))
+
+	var next int64
+	idGen := func(_ int64) int64 {
+		next++
+		return next
+	}
+
+	fetcher := NewFetcher(storage, idGen, WithTenants(tenants))
+	ts := httptest.NewServer(NewChain(NewRouter(fetcher), NewTenantMW(tenants)))
+	defer ts.Close()
+
+	request := func(tenant, method, path, payload string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(payload))
+		require.NoError(t, err)
+		req.Header.Set(TenantHeader, tenant)
+
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+
+		return resp
+	}
+
+	resp := request("initech", "GET", "/api/fetcher", "")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	payload := fmt.Sprintf(`{"url": "%s", "interval": 1}`, target.URL)
+	resp = request("acme", "POST", "/api/fetcher", payload)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	payload = fmt.Sprintf(`{"url": "%s", "interval": 60}`, target.URL)
+	resp = request("acme", "POST", "/api/fetcher", payload)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = request("acme", "POST", "/api/fetcher", payload)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp = request("globex", "POST", "/api/fetcher", payload)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// tenants only see their own tasks
+	for _, tenant := range []string{"", "acme", "globex"} {
+		resp = request(tenant, "GET", "/api/fetcher", "")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var tasks []*model.Task
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&tasks))
+
+		if tenant == "" {
+			assert.Empty(t, tasks)
+		} else {
+			assert.Len(t, tasks, 1, tenant)
+		}
+	}
+
+	resp = request("globex", "POST", "/api/fetcher/1/run?wait=true", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// the second response exceeds the history quota and is not stored
+	for i := 0; i < 2; i++ {
+		resp = request("acme", "POST", "/api/fetcher/1/run?wait=true", "")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	attempts, err := storage.ListAttempts(util.WithTenant(context.Background(), "acme"), 1)
+	require.NoError(t, err)
+	require.Len(t, attempts, 2)
+	assert.NotEmpty(t, attempts[0].Response)
+	assert.Empty(t, attempts[1].Response)
+	assert.True(t, attempts[1].QuotaExceeded)
+
+	// acme's task just ran, globex's is due
+	due := fetcher.getTasks(context.Background())
+	require.Len(t, due, 1)
+	assert.Equal(t, "globex", due[0].tenant)
+}
+
+func TestTaskLimit(t *testing.T) {
+	storage := memory.NewMemory()
+	tenants := []model.Tenant{{Id: "acme", MaxTasks: 3}}
+
+	var next int64
+	idGen := func(_ int64) int64 {
+		return atomic.AddInt64(&next, 1)
+	}
+
+	fetcher := NewFetcher(storage, idGen, WithTenants(tenants))
+	ts := httptest.NewServer(NewChain(NewRouter(fetcher), NewTenantMW(tenants)))
+	defer ts.Close()
+
+	// concurrent creates do not exceed the limit together
+	var (
+		wg      sync.WaitGroup
+		created int64
+	)
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			req, err := http.NewRequest("POST", ts.URL+"/api/fetcher", strings.NewReader(`{"url": "http://localhost", "interval": 60}`))
+			if err != nil {
+				return
+			}
+
+			req.Header.Set(TenantHeader, "acme")
+
+			resp, err := ts.Client().Do(req)
+			if err != nil {
+				return
+			}
+
+			defer util.MustClose(resp.Body)
+
+			if resp.StatusCode == http.StatusOK {
+				atomic.AddInt64(&created, 1)
+			}
+		}()
+	}
+
+	wg.Wait()
+	assert.Equal(t, int64(3), created)
+
+	tasks, err := storage.ListTasks(util.WithTenant(context.Background(), "acme"))
+	require.NoError(t, err)
+	assert.Len(t, tasks, 3)
+}
+
+func TestAuth(t *testing.T) {
+	tenants := []model.Tenant{{Id: "acme"}}
+	authenticator := auth.NewAuthenticator(auth.WithKeys([]auth.Key{
+		auth.NewKey("reader", auth.Principal{Subject: "reader", Role: auth.RoleReadOnly}),
+		auth.NewKey("editor", auth.Principal{Subject: "editor", Role: auth.RoleEditor, Tenant: "acme"}),
+		auth.NewKey("admin", auth.Principal{Subject: "admin", Role: auth.RoleAdmin}),
+	}))
+
+	fetcher := NewFetcher(memory.NewMemory(), util.GenID, WithTenants(tenants))
+	ts := httptest.NewServer(NewChain(NewRouter(fetcher), NewAuthMW(authenticator), NewTenantMW(tenants)))
+	defer ts.Close()
+
+	request := func(key, tenant, method, path, payload string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(payload))
+		require.NoError(t, err)
+
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		req.Header.Set(TenantHeader, tenant)
+
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+
+		return resp
+	}
+
+	payload := `{"url": "https://example.com", "interval": 60}`
+
+	tests := []struct {
+		key, tenant, method, path, payload string
+		expectedStatusCode                 int
+	}{
+		{"", "", "GET", "/api/fetcher", "", http.StatusUnauthorized},
+		{"unknown", "", "GET", "/api/fetcher", "", http.StatusUnauthorized},
+		{"reader", "", "GET", "/api/fetcher", "", http.StatusOK},
+		{"reader", "", "POST", "/api/fetcher", payload, http.StatusForbidden},
+		{"reader", "acme", "GET", "/api/fetcher", "", http.StatusForbidden},
+		{"editor", "", "POST", "/api/fetcher", payload, http.StatusOK},
+		{"editor", "", "GET", "/api/scheduler", "", http.StatusForbidden},
+		{"editor", "other", "GET", "/api/fetcher", "", http.StatusForbidden},
+		{"admin", "", "GET", "/api/scheduler", "", http.StatusOK},
+		{"admin", "acme", "GET", "/api/fetcher", "", http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		resp := request(tc.key, tc.tenant, tc.method, tc.path, tc.payload)
+		assert.Equal(t, tc.expectedStatusCode, resp.StatusCode, "%s %s %s", tc.key, tc.method, tc.path)
+	}
+
+	// the editor's task was created in its tenant
+	resp := request("admin", "acme", "GET", "/api/fetcher", "")
+	var tasks []*model.Task
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&tasks))
+	assert.Len(t, tasks, 1)
+
+	resp = request("", "", "GET", "/api/fetcher", "")
+	assert.Equal(t, `Bearer realm="crawler"`, resp.Header.Get("WWW-Authenticate"))
+}
+
+func TestAudit(t *testing.T) {
+	authenticator := auth.NewAuthenticator(auth.WithKeys([]auth.Key{
+		auth.NewKey("editor", auth.Principal{Subject: "editor", Role: auth.RoleEditor}),
+		auth.NewKey("admin", auth.Principal{Subject: "admin", Role: auth.RoleAdmin}),
+	}))
+
+	fetcher := NewFetcher(memory.NewMemory(), util.GenID)
+	ts := httptest.NewServer(NewChain(NewRouter(fetcher), NewAuthMW(authenticator)))
+	defer ts.Close()
+
+	request := func(key, method, path, payload string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(payload))
+		require.NoError(t, err)
+		req.Header.Set(auth.KeyHeader, key)
+
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+
+		return resp
+	}
+
+	resp := request("editor", "POST", "/api/fetcher", `{"url": "https://example.com", "interval": 60, "headers": {"X-Token": "t"}}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	id := resp.Header.Get("Location")
+
+	resp = request("editor", "POST", "/api/fetcher/"+id+"/pause", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// pausing a paused task changes nothing
+	resp = request("editor", "POST", "/api/fetcher/"+id+"/pause", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = request("admin", "DELETE", "/api/fetcher/"+id, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = request("editor", "GET", "/api/audit", "")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp = request("admin", "GET", "/api/audit?action=bogus", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = request("admin", "GET", "/api/audit?task_id="+id, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var entries []*model.AuditEntry
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&entries))
+	require.Len(t, entries, 3)
+
+	assert.Equal(t, model.AuditDelete, entries[0].Action)
+	assert.Equal(t, "admin", entries[0].Actor)
+	assert.Nil(t, entries[0].After)
+	assert.True(t, entries[0].Before.Paused)
+
+	assert.Equal(t, model.AuditPause, entries[1].Action)
+	assert.False(t, entries[1].Before.Paused)
+	assert.True(t, entries[1].After.Paused)
+
+	assert.Equal(t, model.AuditCreate, entries[2].Action)
+	assert.Equal(t, "editor", entries[2].Actor)
+	assert.Nil(t, entries[2].Before)
+	assert.Equal(t, model.Redacted, entries[2].After.Headers["X-Token"])
+
+	resp = request("admin", "GET", "/api/audit?actor=admin", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	entries = nil
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&entries))
+	assert.Len(t, entries, 1)
+
+	// group changes alter the settings of their members
+	resp = request("admin", "PUT", "/api/groups/payments", `{"interval": 60}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = request("admin", "PUT", "/api/groups/payments", `{"interval": 30, "headers": {"Authorization": "secret"}}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = request("admin", "DELETE", "/api/groups/payments", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = request("admin", "GET", "/api/audit?group=payments", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	entries = nil
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&entries))
+	require.Len(t, entries, 3)
+
+	assert.Equal(t, model.AuditGroupDelete, entries[0].Action)
+	assert.Nil(t, entries[0].AfterGroup)
+	assert.Equal(t, 30, entries[0].BeforeGroup.Interval)
+
+	assert.Equal(t, model.AuditGroupUpdate, entries[1].Action)
+	assert.Equal(t, 60, entries[1].BeforeGroup.Interval)
+	assert.Equal(t, model.Redacted, entries[1].AfterGroup.Headers["Authorization"])
+
+	assert.Equal(t, model.AuditGroupCreate, entries[2].Action)
+	assert.Nil(t, entries[2].BeforeGroup)
+
+	// older entries are paged with the id of the last one
+	resp = request("admin", "GET", "/api/audit?limit=2", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	entries = nil
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&entries))
+	require.Len(t, entries, 2)
+
+	resp = request("admin", "GET", fmt.Sprintf("/api/audit?limit=10&before=%d", entries[1].Id), "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var older []*model.AuditEntry
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&older))
+	require.Len(t, older, 4)
+	assert.Equal(t, entries[1].Id-1, older[0].Id)
+
+	resp = request("admin", "GET", "/api/audit?before=0", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+
+	previous := logging.Default()
+	defer logging.SetDefault(previous)
+	logging.SetDefault(logging.New(&buf, logging.LevelInfo))
+
+	router := mux.NewRouter()
+	router.HandleFunc("/teapot", func(w http.ResponseWriter, r *http.Request) {
+		logging.FromContext(r.Context()).Info("brewing")
+		w.WriteHeader(http.StatusTeapot)
+		_, _ = io.WriteString(w, "short and stout")
+	})
+
+	ts := httptest.NewServer(NewChain(router, NewAccessLogMW()))
+	defer ts.Close()
+
+	req, err := http.NewRequest("GET", ts.URL+"/teapot", nil)
+	require.NoError(t, err)
+	req.Header.Set(RequestIdHeader, "req-1")
+
+	resp, err := ts.Client().Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, "req-1", resp.Header.Get(RequestIdHeader))
+
+	// invalid ids are replaced
+	req.Header.Set(RequestIdHeader, "has space")
+	resp, err = ts.Client().Do(req)
+	require.NoError(t, err)
+	assert.NotEqual(t, "has space", resp.Header.Get(RequestIdHeader))
+	assert.NotEmpty(t, resp.Header.Get(RequestIdHeader))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 4)
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "brewing", entry["msg"])
+	assert.Equal(t, "req-1", entry["request_id"])
+
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &entry))
+	assert.Equal(t, "request", entry["msg"])
+	assert.Equal(t, "req-1", entry["request_id"])
+	assert.Equal(t, "GET", entry["method"])
+	assert.Equal(t, "/teapot", entry["path"])
+	assert.Equal(t, float64(http.StatusTeapot), entry["status"])
+	assert.Equal(t, float64(len("short and stout")), entry["bytes"])
+	assert.Contains(t, entry, "latency_ms")
+}
+
+func TestMetrics(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "hello")
+	}))
+	defer target.Close()
+
+	registry := metrics.NewRegistry()
+	storage := store.NewObserved(memory.NewMemory(), NewStoreMetrics(registry))
+
+	fetcher := NewFetcher(storage, func(_ int64) int64 { return 1 }, WithMetrics(registry))
+	router := NewRouter(fetcher)
+	ts := httptest.NewServer(NewChain(router, NewMetricsMW(registry, router)))
+	defer ts.Close()
+
+	resp, err := ts.Client().Post(ts.URL+"/api/fetcher", "application/json", strings.NewReader(fmt.Sprintf(`{"url": "%s", "interval": 60}`, target.URL)))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = ts.Client().Post(ts.URL+"/api/fetcher/1/run?wait=true", "application/json", nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// dry runs do not count as fetches
+	resp, err = ts.Client().Post(ts.URL+"/api/fetcher/test", "application/json", strings.NewReader(fmt.Sprintf(`{"url": "%s", "interval": 60}`, target.URL)))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// a due task no worker picked up yet
+	planned := &assignment{task: &model.Task{Id: 2}, planned: time.Now().Add(-time.Second)}
+	require.True(t, fetcher.reserve(planned))
+
+	resp, err = ts.Client().Get(ts.URL + "/metrics")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, metrics.ContentType, resp.Header.Get("Content-Type"))
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	for _, line := range []string{
+		`crawler_fetch_attempts_total{outcome="success",status_class="2xx"} 1`,
+		`crawler_fetch_body_bytes_count 1`,
+		`crawler_fetch_duration_seconds_count{outcome="success"} 1`,
+		`crawler_http_requests_total{method="POST",route="/api/fetcher/{id}/run",status="200"} 1`,
+		`crawler_store_operation_duration_seconds_count{operation="create",result="ok"} 1`,
+		`crawler_queue_depth 1`,
+		`crawler_due_tasks_not_started 1`,
+		`crawler_workers_busy 0`,
+	} {
+		assert.Contains(t, string(body), line+"\n")
+	}
+}
+
+type spanRecorder struct {
+	spans []*tracing.SpanData
+	mutex sync.Mutex
+}
+
+func (r *spanRecorder) Export(span *tracing.SpanData) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.spans = append(r.spans, span)
+}
+
+func (r *spanRecorder) named(name string) *tracing.SpanData {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, s := range r.spans {
+		if s.Name == name {
+			return s
+		}
+	}
+
+	return nil
+}
+
+func TestTracing(t *testing.T) {
+	previous := global.TracerProvider()
+	defer global.SetTracerProvider(previous)
+
+	exported := &spanRecorder{}
+	tracing.Install(tracing.NewProvider(exported))
+
+	traceparents := make(chan string, 1)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents <- r.Header.Get("traceparent")
+	}))
+	defer target.Close()
+
+	storage := store.NewObserved(memory.NewMemory(), NewStoreTracing())
+	require.NoError(t, storage.Create(context.Background(), &model.Task{Id: 1, Url: target.URL, Interval: 60}))
+
+	fetcher := NewFetcher(storage, util.GenID)
+	router := NewRouter(fetcher)
+	ts := httptest.NewServer(NewChain(router, NewTracingMW(router)))
+	defer ts.Close()
+
+	req, err := http.NewRequest("POST", ts.URL+"/api/fetcher/1/run?wait=true", nil)
+	require.NoError(t, err)
+	req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+
+	resp, err := ts.Client().Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	request := exported.named("POST /api/fetcher/{id}/run")
+	require.NotNil(t, request)
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", request.TraceId)
+	assert.Equal(t, "b7ad6b7169203331", request.ParentId)
+	assert.Equal(t, int64(http.StatusOK), request.Attributes["http.status_code"])
+
+	fetch := exported.named("fetch task")
+	require.NotNil(t, fetch)
+	assert.Equal(t, request.SpanId, fetch.ParentId)
+	assert.Equal(t, "00-"+fetch.TraceId+"-"+fetch.SpanId+"-01", <-traceparents)
+
+	save := exported.named("save attempt")
+	require.NotNil(t, save)
+	assert.Equal(t, fetch.SpanId, save.ParentId)
+
+	add := exported.named("store add_attempt")
+	require.NotNil(t, add)
+	assert.Equal(t, save.SpanId, add.ParentId)
+	assert.Equal(t, request.TraceId, add.TraceId)
+}
+
+type unreachable struct {
+	store.Store
+}
+
+func (u *unreachable) Ping(_ context.Context) error {
+	return errors.New("connection refused")
+}
+
+func TestProbes(t *testing.T) {
+	fetcher := NewFetcher(memory.NewMemory(), func(_ int64) int64 { return 1 })
+	authenticator := auth.NewAuthenticator(auth.WithKeys([]auth.Key{
+		auth.NewKey("secret", auth.Principal{Subject: "ops", Role: auth.RoleAdmin}),
+		auth.NewKey("acme", auth.Principal{Subject: "acme-ops", Role: auth.RoleAdmin, Tenant: "acme"}),
+	}))
+	ts := httptest.NewServer(NewProbes(fetcher, NewChain(NewRouter(fetcher), NewAuthMW(authenticator))))
+	defer ts.Close()
+
+	readiness := func() (int, *model.Readiness) {
+		resp, err := ts.Client().Get(ts.URL + "/readyz")
+		require.NoError(t, err)
+
+		readiness := &model.Readiness{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(readiness))
+
+		return resp.StatusCode, readiness
+	}
+
+	resp, err := ts.Client().Get(ts.URL + "/healthz")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// not ready before the scheduler starts
+	status, ready := readiness()
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.False(t, ready.Ready)
+	assert.Equal(t, "not running", ready.Checks["scheduler"])
+	assert.Equal(t, checkOk, ready.Checks["store"])
+
+	stop := fetcher.Start()
+	defer stop()
+
+	status, ready = readiness()
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, ready.Ready)
+
+	// the debug status needs credentials, the probes do not
+	resp, err = ts.Client().Get(ts.URL + "/debug/status")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/debug/status", nil)
+	require.NoError(t, err)
+	req.Header.Set(auth.KeyHeader, "secret")
+
+	resp, err = ts.Client().Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// the workers of all tenants are not shown to admins of one
+	for _, path := range []string{"/debug/status", "/api/scheduler"} {
+		tenantReq, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		require.NoError(t, err)
+		tenantReq.Header.Set(auth.KeyHeader, "acme")
+
+		tenantResp, err := ts.Client().Do(tenantReq)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, tenantResp.StatusCode, path)
+	}
+
+	debug := &model.ServiceStatus{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(debug))
+	assert.True(t, debug.Running)
+	assert.Len(t, debug.Workers, defaultWorkers)
+	assert.Equal(t, model.WorkerIdle, debug.Workers[0].State)
+	assert.NotNil(t, debug.Scheduler)
+
+	// all workers stuck on a task for too long
+	now := time.Now()
+	for i := range debug.Workers {
+		fetcher.state.work(i, &assignment{task: &model.Task{Id: i + 1}})
+	}
+	ready = fetcher.readiness(context.Background(), now.Add(stallTimeout*2))
+	assert.False(t, ready.Ready)
+	assert.Equal(t, fmt.Sprintf("all %d workers stalled", defaultWorkers), ready.Checks["workers"])
+	assert.Contains(t, ready.Checks["scheduler"], "no tick since")
+
+	broken := NewFetcher(&unreachable{memory.NewMemory()}, func(_ int64) int64 { return 1 })
+	ready = broken.readiness(context.Background(), now)
+	assert.False(t, ready.Ready)
+	assert.Equal(t, "connection refused", ready.Checks["store"])
 }
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"crawler/pkg/metrics"
+	"crawler/pkg/model"
+	"crawler/pkg/store"
+)
+
+// fetcherMetrics are the instruments of the scheduler and the workers.
+type fetcherMetrics struct {
+	attempts *metrics.Counter
+	duration *metrics.Histogram
+	bodySize *metrics.Histogram
+	busyTime *metrics.Counter
+	busy     int64
+}
+
+// WithMetrics registers the fetcher's metrics, which are served at /metrics, with the registry.
+func WithMetrics(registry *metrics.Registry) FetcherOption {
+	return func(f *Fetcher) {
+		f.registry = registry
+	}
+}
+
+func newFetcherMetrics(registry *metrics.Registry, f *Fetcher) *fetcherMetrics {
+	m := &fetcherMetrics{
+		attempts: registry.Counter("crawler_fetch_attempts_total",
+			"Fetch attempts by outcome and response status class.", "outcome", "status_class"),
+		duration: registry.Histogram("crawler_fetch_duration_seconds",
+			"Duration of fetch attempts by outcome.", metrics.DurationBuckets, "outcome"),
+		bodySize: registry.Histogram("crawler_fetch_body_bytes",
+			"Size of fetched response bodies.", metrics.SizeBuckets),
+		busyTime: registry.Counter("crawler_worker_busy_seconds_total",
+			"Time workers spent processing tasks, divided by the number of workers it is their utilization."),
+	}
+
+	registry.Gauge("crawler_queue_depth", "Tasks planned by the scheduler which no worker started yet.", func() float64 {
+		queued, _ := f.queue(time.Now())
+		return float64(queued)
+	})
+	registry.Gauge("crawler_due_tasks_not_started", "Planned tasks whose time has come which no worker started yet.", func() float64 {
+		_, due := f.queue(time.Now())
+		return float64(due)
+	})
+	registry.Gauge("crawler_workers", "Number of workers.", func() float64 {
+		return defaultWorkers
+	})
+	registry.Gauge("crawler_workers_busy", "Number of workers processing a task.", func() float64 {
+		return float64(atomic.LoadInt64(&m.busy))
+	})
+
+	return m
+}
+
+// working marks a worker as busy until the returned function is called.
+func (m *fetcherMetrics) working() func() {
+	start := time.Now()
+	atomic.AddInt64(&m.busy, 1)
+
+	return func() {
+		atomic.AddInt64(&m.busy, -1)
+		m.busyTime.Add(time.Since(start).Seconds())
+	}
+}
+
+func (m *fetcherMetrics) observe(a *model.Attempt, res *response) {
+	class := "none"
+	if res != nil && res.statusCode > 0 {
+		class = strconv.Itoa(res.statusCode/100) + "xx"
+	}
+
+	m.attempts.Inc(a.Outcome, class)
+	m.duration.Observe(a.Duration, a.Outcome)
+
+	if res != nil {
+		m.bodySize.Observe(float64(len(res.body)))
+	}
+}
+
+// Metrics serves the metrics in the Prometheus text format.
+func (f *Fetcher) Metrics(w http.ResponseWriter, r *http.Request) {
+	f.registry.ServeHTTP(w, r)
+}
+
+// NewStoreMetrics returns an observer measuring the latency of store operations.
+func NewStoreMetrics(registry *metrics.Registry) store.Observer {
+	latency := registry.Histogram("crawler_store_operation_duration_seconds",
+		"Latency of store operations by operation and result.", metrics.DurationBuckets, "operation", "result")
+
+	return func(ctx context.Context, op string) (context.Context, func(error)) {
+		start := time.Now()
+
+		return ctx, func(err error) {
+			result := "ok"
+			if err != nil {
+				result = "error"
+			}
+
+			latency.Observe(time.Since(start).Seconds(), op, result)
+		}
+	}
+}
+
+// NewMetricsMW counts API requests and measures their latency by route template,
+// so that task ids do not create a series each.
+func NewMetricsMW(registry *metrics.Registry, router *mux.Router) func(http.Handler) http.Handler {
+	requests := registry.Counter("crawler_http_requests_total",
+		"API requests by method, route and status code.", "method", "route", "status")
+	latency := registry.Histogram("crawler_http_request_duration_seconds",
+		"Latency of API requests by method and route.", metrics.DurationBuckets, "method", "route")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				start := time.Now()
+
+				route := "unmatched"
+
+				var match mux.RouteMatch
+				if router.Match(r, &match) && match.Route != nil {
+					if template, err := match.Route.GetPathTemplate(); err == nil {
+						route = template
+					}
+				}
+
+				recorder := &statusRecorder{ResponseWriter: w}
+				next.ServeHTTP(recorder, r)
+
+				if recorder.status == 0 {
+					recorder.status = http.StatusOK
+				}
+
+				requests.Inc(r.Method, route, strconv.Itoa(recorder.status))
+				latency.Observe(time.Since(start).Seconds(), r.Method, route)
+			},
+		)
+	}
+}
@@ -1,9 +1,13 @@
 package handler
 
 import (
-	"log"
+	"math"
 	"net/http"
 	"strconv"
+	"time"
+
+	"crawler/pkg/logging"
+	"crawler/pkg/util"
 )
 
 func NewChain(f http.Handler, handlers ...func(http.Handler) http.Handler) http.Handler {
@@ -23,7 +27,7 @@ func NewSizeLimiter(limit int) func(http.Handler) http.Handler {
 				if r.Method == http.MethodPost {
 					contentLength, err := strconv.Atoi(r.Header.Get("Content-Length"))
 					if err != nil {
-						log.Println("checking incoming content size failed")
+						logging.FromContext(r.Context()).Error("checking incoming content size failed", "error", err)
 						http.Error(w, "internal error", http.StatusInternalServerError)
 						return
 					}
@@ -50,3 +54,92 @@ func NewContentTypeMW() func(http.Handler) http.Handler {
 		)
 	}
 }
+
+// RequestIdHeader carries the id of a request, it is generated unless the client sent one.
+const RequestIdHeader = "X-Request-ID"
+
+const maxRequestIdLength = 128
+
+// statusRecorder remembers the status code and the size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+
+	n, err := s.ResponseWriter.Write(p)
+	s.bytes += n
+
+	return n, err
+}
+
+// Flush keeps event streams working through the recorder.
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func validRequestId(id string) bool {
+	if id == "" || len(id) > maxRequestIdLength {
+		return false
+	}
+
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// NewAccessLogMW logs every request with its status, latency and response size. The
+// request id is taken from the X-Request-ID header or generated, returned in the same
+// header and added to the request's context, so that all its log entries carry it.
+func NewAccessLogMW() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				start := time.Now()
+
+				id := r.Header.Get(RequestIdHeader)
+				if !validRequestId(id) {
+					id = strconv.FormatInt(util.GenID(math.MaxInt64), 36)
+				}
+
+				w.Header().Set(RequestIdHeader, id)
+				ctx := logging.WithRequestId(r.Context(), id)
+
+				recorder := &statusRecorder{ResponseWriter: w}
+				next.ServeHTTP(recorder, r.WithContext(ctx))
+
+				if recorder.status == 0 {
+					recorder.status = http.StatusOK
+				}
+
+				logging.FromContext(ctx).Info("request",
+					"method", r.Method,
+					"path", r.URL.Path,
+					"status", recorder.status,
+					"latency_ms", time.Since(start),
+					"bytes", recorder.bytes,
+					"remote", r.RemoteAddr,
+				)
+			},
+		)
+	}
+}
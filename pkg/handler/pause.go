@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"net/http"
+
+	"crawler/pkg/util"
+)
+
+// Pause stops scheduling a task, its history is kept and it can still be run manually.
+func (f *Fetcher) Pause(w http.ResponseWriter, r *http.Request) {
+	f.setPaused(w, r, true)
+}
+
+// Resume schedules a paused task again.
+func (f *Fetcher) Resume(w http.ResponseWriter, r *http.Request) {
+	f.setPaused(w, r, false)
+}
+
+func (f *Fetcher) setPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	id, err := taskId(r)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	err = f.pauseTask(r.Context(), id, paused)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+}
@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"crawler/pkg/model"
+	"crawler/pkg/util"
+)
+
+const (
+	// stallTimeout is how long the scheduler may miss ticks and a worker may spend on a
+	// task before they count as stalled, well above defaultTimeout of a fetch
+	stallTimeout = time.Second * 30
+	pingTimeout  = time.Second * 2
+
+	checkOk = "ok"
+)
+
+type workerState struct {
+	busy  bool
+	task  taskRef
+	since time.Time
+}
+
+// runState tracks whether the scheduler ticks and what the workers do.
+type runState struct {
+	running   bool
+	startedAt time.Time
+	lastTick  time.Time
+	workers   []workerState
+	mutex     sync.Mutex
+}
+
+func (s *runState) start(now time.Time, workers int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.running = true
+	s.startedAt = now
+	s.workers = make([]workerState, workers)
+
+	for i := range s.workers {
+		s.workers[i].since = now
+	}
+}
+
+func (s *runState) stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.running = false
+}
+
+func (s *runState) tick(now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.lastTick = now
+}
+
+// work marks the worker busy with the assignment's task until the returned function is called.
+func (s *runState) work(id int, a *assignment) func() {
+	s.mutex.Lock()
+	s.workers[id] = workerState{busy: true, task: a.ref(), since: time.Now()}
+	s.mutex.Unlock()
+
+	return func() {
+		s.mutex.Lock()
+		s.workers[id] = workerState{since: time.Now()}
+		s.mutex.Unlock()
+	}
+}
+
+// status returns whether the scheduler runs, when it last ticked and the workers' states.
+func (s *runState) status(now time.Time) (*model.ServiceStatus, int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	status := &model.ServiceStatus{
+		Running:     s.running,
+		StartedAtMs: unixMsOrZero(s.startedAt),
+		LastTickMs:  unixMsOrZero(s.lastTick),
+		Workers:     make([]model.WorkerStatus, len(s.workers)),
+	}
+
+	stalled := 0
+
+	for i, w := range s.workers {
+		ws := model.WorkerStatus{Id: i, State: model.WorkerIdle, SinceMs: unixMs(w.since)}
+
+		if w.busy {
+			ws.State = model.WorkerBusy
+			ws.TaskId = w.task.id
+			ws.Tenant = w.task.tenant
+
+			if now.Sub(w.since) > stallTimeout {
+				ws.State = model.WorkerStalled
+				stalled++
+			}
+		}
+
+		status.Workers[i] = ws
+	}
+
+	return status, stalled
+}
+
+func unixMsOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return unixMs(t)
+}
+
+// Healthz tells that the process is alive.
+func (f *Fetcher) Healthz(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// Readyz tells whether the store is reachable, the scheduler ticks and not all workers stalled.
+func (f *Fetcher) Readyz(w http.ResponseWriter, r *http.Request) {
+	readiness := f.readiness(r.Context(), time.Now())
+
+	w.Header().Set("Content-Type", "application/json")
+	if !readiness.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	err := json.NewEncoder(w).Encode(readiness)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+}
+
+func (f *Fetcher) readiness(ctx context.Context, now time.Time) *model.Readiness {
+	readiness := &model.Readiness{Ready: true, Checks: make(map[string]string)}
+
+	fail := func(check, reason string) {
+		readiness.Ready = false
+		readiness.Checks[check] = reason
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	readiness.Checks["store"] = checkOk
+	if err := f.storage.Ping(ctx); err != nil {
+		fail("store", err.Error())
+	}
+
+	status, stalled := f.state.status(now)
+
+	// the first tick is due one interval after the start
+	lastTick := time.Unix(0, status.StartedAtMs*int64(time.Millisecond))
+	if status.LastTickMs > 0 {
+		lastTick = time.Unix(0, status.LastTickMs*int64(time.Millisecond))
+	}
+
+	readiness.Checks["scheduler"] = checkOk
+	switch {
+	case !status.Running:
+		fail("scheduler", "not running")
+	case now.Sub(lastTick) > stallTimeout:
+		fail("scheduler", fmt.Sprintf("no tick since %s", now.Sub(lastTick).Round(time.Second)))
+	}
+
+	readiness.Checks["workers"] = checkOk
+	if len(status.Workers) > 0 && stalled == len(status.Workers) {
+		fail("workers", fmt.Sprintf("all %d workers stalled", stalled))
+	}
+
+	return readiness
+}
+
+// DebugStatus returns the scheduler's queue, its last tick and the workers' states.
+func (f *Fetcher) DebugStatus(w http.ResponseWriter, _ *http.Request) {
+	now := time.Now()
+
+	status, _ := f.state.status(now)
+	status.QueueDepth, status.DueNotStarted = f.queue(now)
+	status.Scheduler = f.drift.snapshot()
+
+	err := json.NewEncoder(w).Encode(status)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+}
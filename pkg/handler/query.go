@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"net/url"
+	"strconv"
+
+	"crawler/pkg/labels"
+	"crawler/pkg/model"
+	"crawler/pkg/util"
+)
+
+const maxPageSize = 1000
+
+// parseTaskQuery reads the pagination, sorting and filter parameters of the task list.
+func parseTaskQuery(values url.Values) (*model.TaskQuery, error) {
+	q := &model.TaskQuery{
+		Sort:  model.SortId,
+		Url:   values.Get("url"),
+		Host:  values.Get("host"),
+		State: values.Get("state"),
+	}
+
+	var err error
+
+	if v := values.Get("offset"); v != "" {
+		q.Offset, err = strconv.Atoi(v)
+		if err != nil || q.Offset < 0 {
+			return nil, util.Wrap(util.ErrValidation, "offset must be a non-negative number")
+		}
+	}
+
+	if v := values.Get("limit"); v != "" {
+		q.Limit, err = strconv.Atoi(v)
+		if err != nil || q.Limit < 1 || q.Limit > maxPageSize {
+			return nil, util.Wrap(util.ErrValidation, "limit must be between 1 and "+strconv.Itoa(maxPageSize))
+		}
+	}
+
+	if v := values.Get("sort"); v != "" {
+		switch v {
+		case model.SortId, model.SortUrl, model.SortInterval, model.SortCreatedAt:
+			q.Sort = v
+		default:
+			return nil, util.Wrap(util.ErrValidation, "sort must be one of id, url, interval, created_at")
+		}
+	}
+
+	q.Selector, err = labels.Parse(values.Get("selector"))
+	if err != nil {
+		return nil, err
+	}
+
+	switch values.Get("order") {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return nil, util.Wrap(util.ErrValidation, "order must be asc or desc")
+	}
+
+	switch q.State {
+	case "", model.FilterPaused, model.FilterActive, model.FilterFailing:
+	default:
+		return nil, util.Wrap(util.ErrValidation, "state must be one of paused, active, failing")
+	}
+
+	return q, nil
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"crawler/pkg/model"
+)
+
+var (
+	sensitiveHeaders = map[string]bool{
+		"Authorization":       true,
+		"Proxy-Authorization": true,
+		"Cookie":              true,
+	}
+	sensitiveFragments = []string{"token", "secret", "password", "key", "auth"}
+)
+
+func sensitive(name string) bool {
+	if sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+		return true
+	}
+
+	name = strings.ToLower(name)
+	for _, fragment := range sensitiveFragments {
+		if strings.Contains(name, fragment) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func redactMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+
+	redacted := make(map[string]string, len(m))
+	for k, v := range m {
+		if sensitive(k) {
+			v = model.Redacted
+		}
+
+		redacted[k] = v
+	}
+
+	return redacted
+}
+
+// redacted tells whether a value of the map is the placeholder of a hidden credential,
+// so that redacted definitions are not stored as they are.
+func redacted(m map[string]string) bool {
+	for _, v := range m {
+		if v == model.Redacted {
+			return true
+		}
+	}
+
+	return false
+}
+
+// redact hides credentials that were put directly into headers or query parameters
+// instead of being referenced through task auth.
+func redact(task *model.Task) *model.Task {
+	redacted := *task
+	redacted.Headers = redactMap(task.Headers)
+	redacted.Query = redactMap(task.Query)
+
+	return &redacted
+}
+
+// redactGroup hides credentials put into the headers of a group.
+func redactGroup(g *model.Group) *model.Group {
+	redacted := *g
+	redacted.Headers = redactMap(g.Headers)
+
+	return &redacted
+}
@@ -4,14 +4,53 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+
+	"crawler/pkg/auth"
 )
 
+// NewRouter routes the API, reading needs the read-only role, changing tasks the
+// editor role and changes by selector, groups and the audit trail the admin role. The
+// scheduler internals span all tenants and need an admin bound to no tenant.
 func NewRouter(fetcher *Fetcher) *mux.Router {
 	router := mux.NewRouter()
-	router.Handle("/api/fetcher", http.HandlerFunc(fetcher.Create)).Methods("POST")
-	router.Handle("/api/fetcher", http.HandlerFunc(fetcher.List)).Methods("GET")
-	router.Handle("/api/fetcher/{id}", http.HandlerFunc(fetcher.Delete)).Methods("DELETE")
-	router.Handle("/api/fetcher/{id}/history", http.HandlerFunc(fetcher.History)).Methods("GET")
+	router.Handle("/api/fetcher", authorize(auth.RoleEditor, fetcher.Create)).Methods("POST")
+	router.Handle("/api/fetcher", authorize(auth.RoleReadOnly, fetcher.List)).Methods("GET")
+	router.Handle("/api/fetcher/test", authorize(auth.RoleEditor, fetcher.Test)).Methods("POST")
+	router.Handle("/api/fetcher/bulk", authorize(auth.RoleEditor, fetcher.Bulk)).Methods("POST")
+	router.Handle("/api/fetcher/bulk/{action}", authorize(auth.RoleAdmin, fetcher.BulkAction)).Methods("POST")
+	router.Handle("/api/fetcher/export", authorize(auth.RoleReadOnly, fetcher.Export)).Methods("GET")
+	router.Handle("/api/fetcher/{id}", authorize(auth.RoleEditor, fetcher.Delete)).Methods("DELETE")
+	router.Handle("/api/fetcher/{id}/pause", authorize(auth.RoleEditor, fetcher.Pause)).Methods("POST")
+	router.Handle("/api/fetcher/{id}/resume", authorize(auth.RoleEditor, fetcher.Resume)).Methods("POST")
+	router.Handle("/api/fetcher/{id}/run", authorize(auth.RoleEditor, fetcher.Run)).Methods("POST")
+	router.Handle("/api/fetcher/{id}/history", authorize(auth.RoleReadOnly, fetcher.History)).Methods("GET")
+	router.Handle("/api/fetcher/{id}/history/{a}/diff/{b}", authorize(auth.RoleReadOnly, fetcher.Diff)).Methods("GET")
+	router.Handle("/api/fetcher/{id}/status", authorize(auth.RoleReadOnly, fetcher.Status)).Methods("GET")
+	router.Handle("/api/fetcher/{id}/deliveries", authorize(auth.RoleReadOnly, fetcher.Deliveries)).Methods("GET")
+	router.Handle("/api/fetcher/{id}/cookies", authorize(auth.RoleReadOnly, fetcher.Cookies)).Methods("GET")
+	router.Handle("/api/fetcher/{id}/cookies", authorize(auth.RoleEditor, fetcher.ClearCookies)).Methods("DELETE")
+	router.Handle("/api/fetcher/{id}/events", authorize(auth.RoleReadOnly, fetcher.Events)).Methods("GET")
+	router.Handle("/api/groups", authorize(auth.RoleReadOnly, fetcher.Groups)).Methods("GET")
+	router.Handle("/api/groups/{name}", authorize(auth.RoleReadOnly, fetcher.Group)).Methods("GET")
+	router.Handle("/api/groups/{name}", authorize(auth.RoleAdmin, fetcher.SaveGroup)).Methods("PUT")
+	router.Handle("/api/groups/{name}", authorize(auth.RoleAdmin, fetcher.DeleteGroup)).Methods("DELETE")
+	router.Handle("/api/audit", authorize(auth.RoleAdmin, fetcher.Audit)).Methods("GET")
+	router.Handle("/api/events", authorize(auth.RoleReadOnly, fetcher.AllEvents)).Methods("GET")
+	router.Handle("/api/stats", authorize(auth.RoleReadOnly, fetcher.Stats)).Methods("GET")
+	router.Handle("/metrics", authorize(auth.RoleReadOnly, fetcher.Metrics)).Methods("GET")
+	router.Handle("/debug/status", authorizeOperator(fetcher.DebugStatus)).Methods("GET")
+	router.Handle("/api/scheduler", authorizeOperator(fetcher.SchedulerStats)).Methods("GET")
 
 	return router
 }
+
+// NewProbes serves /healthz and /readyz directly, so that they skip authentication and
+// logging, and everything else through api.
+func NewProbes(fetcher *Fetcher, api http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", fetcher.Healthz)
+	mux.HandleFunc("/readyz", fetcher.Readyz)
+	mux.Handle("/", api)
+
+	return mux
+}
@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"go.opentelemetry.io/otel/api/trace"
+
+	"crawler/pkg/logging"
+	"crawler/pkg/util"
+)
+
+var (
+	// errDeferred tells a manual run that the host's crawl delay did not pass yet.
+	errDeferred = errors.New("fetch deferred by crawl delay")
+	// errStopped tells a manual run that the scheduler stopped before its attempt was stored.
+	errStopped = errors.New("scheduler stopped")
+)
+
+// Run fetches a task right away, out of its schedule, through the workers. The fetch
+// happens in the background unless wait=true asks for the stored attempt in the response.
+// It is refused while a fetch of the task is planned or running.
+func (f *Fetcher) Run(w http.ResponseWriter, r *http.Request) {
+	id, err := taskId(r)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	task, err := f.storage.Get(r.Context(), id)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	attempts, err := f.storage.ListAttempts(r.Context(), id)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	a := newAssignment(r.Context(), f.resolve(r.Context(), task), attempts)
+	a.trace = trace.SpanFromContext(r.Context()).SpanContext()
+	a.done = make(chan error, 1)
+
+	// a planned or running fetch of the task would race the manual one on the history
+	if !f.reserve(a) {
+		http.Error(w, "", http.StatusConflict)
+		return
+	}
+
+	if r.URL.Query().Get("wait") != "true" {
+		// the run outlives the request
+		f.dispatch(context.Background(), a)
+		w.WriteHeader(http.StatusAccepted)
+
+		return
+	}
+
+	f.dispatch(r.Context(), a)
+
+	select {
+	case err = <-a.done:
+	case <-r.Context().Done():
+		return
+	}
+
+	if errors.Is(err, errDeferred) {
+		// the host's crawl delay did not pass yet
+		http.Error(w, "", http.StatusTooManyRequests)
+		return
+	}
+
+	if errors.Is(err, errStopped) {
+		http.Error(w, "", http.StatusServiceUnavailable)
+		return
+	}
+
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(a.result)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+}
+
+// dispatch hands a reserved manual run to the workers, so that it counts against their
+// limit. Without a started scheduler it runs on its own. The run is released when the
+// scheduler stops or the context ends before a worker picked it up.
+func (f *Fetcher) dispatch(ctx context.Context, a *assignment) {
+	f.pendingMutex.Lock()
+	assignments, finish := f.assignments, f.finish
+	f.pendingMutex.Unlock()
+
+	if assignments == nil {
+		go f.runNow(a)
+		return
+	}
+
+	go func() {
+		select {
+		case assignments <- a:
+		case <-finish:
+			f.release(a)
+			a.finish(errStopped)
+		case <-ctx.Done():
+			f.release(a)
+			a.finish(ctx.Err())
+		}
+	}()
+}
+
+func (f *Fetcher) runNow(a *assignment) {
+	defer f.release(a)
+
+	if !f.process(a) {
+		a.finish(errDeferred)
+		return
+	}
+
+	err := f.save(context.Background(), a)
+	if err != nil {
+		logging.FromContext(a.context()).Error("saving attempt failed", "task_id", a.task.Id, "error", err)
+	}
+
+	a.finish(err)
+}
+
+// Test fetches a task spec and returns the attempt without storing the task or the attempt.
+func (f *Fetcher) Test(w http.ResponseWriter, r *http.Request) {
+	task, err := decodeTask(r)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	err = f.checkGroup(r.Context(), task)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	// the task has no cookie jar to load or save
+	task.Cookies = false
+
+	a := &assignment{tenant: util.Tenant(r.Context()), task: f.resolve(r.Context(), task), dryRun: true}
+	if !f.process(a) {
+		http.Error(w, "", http.StatusTooManyRequests)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(a.result)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+}
@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"crawler/pkg/model"
+	"crawler/pkg/notify"
+	"crawler/pkg/util"
+)
+
+// driftStats aggregates how much later than planned the scheduler started attempts.
+type driftStats struct {
+	runs  int64
+	total int64
+	max   int64
+	last  int64
+	mutex sync.Mutex
+}
+
+func (d *driftStats) add(drift time.Duration) {
+	ms := drift.Milliseconds()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.runs++
+	d.total += ms
+	d.last = ms
+
+	if ms > d.max {
+		d.max = ms
+	}
+}
+
+func (d *driftStats) snapshot() *model.SchedulerStats {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	stats := &model.SchedulerStats{Runs: d.runs, MaxDriftMs: d.max, LastDriftMs: d.last}
+	if d.runs > 0 {
+		stats.MeanDriftMs = float64(d.total) / float64(d.runs)
+	}
+
+	return stats
+}
+
+func unixMs(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// taskRef identifies a task across tenants.
+type taskRef struct {
+	tenant string
+	id     int
+}
+
+func (a *assignment) ref() taskRef {
+	return taskRef{tenant: a.tenant, id: a.task.Id}
+}
+
+// context returns a context scoped to the assignment's tenant.
+func (a *assignment) context() context.Context {
+	return util.WithTenant(context.Background(), a.tenant)
+}
+
+// finish hands the outcome of a manual run to the waiting request.
+func (a *assignment) finish(err error) {
+	if a.done != nil {
+		a.done <- err
+	}
+}
+
+// reserve marks the task as planned, it returns false when it is planned or being fetched already.
+func (f *Fetcher) reserve(a *assignment) bool {
+	f.pendingMutex.Lock()
+	defer f.pendingMutex.Unlock()
+
+	if _, ok := f.pending[a.ref()]; ok {
+		return false
+	}
+
+	f.pending[a.ref()] = a
+
+	return true
+}
+
+func (f *Fetcher) reserved(tenant string, id int) bool {
+	f.pendingMutex.Lock()
+	defer f.pendingMutex.Unlock()
+
+	_, ok := f.pending[taskRef{tenant: tenant, id: id}]
+
+	return ok
+}
+
+// start marks the assignment as picked up by a worker.
+func (f *Fetcher) start(a *assignment) {
+	f.pendingMutex.Lock()
+	defer f.pendingMutex.Unlock()
+
+	a.started = true
+}
+
+// queue returns the number of planned assignments no worker started yet and how many of them are due.
+func (f *Fetcher) queue(now time.Time) (int, int) {
+	f.pendingMutex.Lock()
+	defer f.pendingMutex.Unlock()
+
+	queued, due := 0, 0
+
+	for _, a := range f.pending {
+		if a.started {
+			continue
+		}
+
+		queued++
+		if !a.planned.After(now) {
+			due++
+		}
+	}
+
+	return queued, due
+}
+
+func (f *Fetcher) release(a *assignment) {
+	f.pendingMutex.Lock()
+	defer f.pendingMutex.Unlock()
+
+	delete(f.pending, a.ref())
+}
+
+// plan hands the assignment to the workers at its planned time, it is dropped when the
+// scheduler stops first.
+func (f *Fetcher) plan(a *assignment) {
+	f.pendingMutex.Lock()
+	defer f.pendingMutex.Unlock()
+
+	assignments, finish := f.assignments, f.finish
+	if assignments == nil {
+		delete(f.pending, a.ref())
+		return
+	}
+
+	f.pending[a.ref()] = a
+	a.timer = time.AfterFunc(time.Until(a.planned), func() {
+		select {
+		case assignments <- a:
+		case <-finish:
+			f.release(a)
+		}
+	})
+}
+
+// drop releases the planned assignments whose timers did not fire yet, the others
+// release themselves once they see the scheduler stopped.
+func (f *Fetcher) drop() {
+	f.pendingMutex.Lock()
+	defer f.pendingMutex.Unlock()
+
+	for ref, a := range f.pending {
+		if a.timer != nil && a.timer.Stop() {
+			delete(f.pending, ref)
+		}
+	}
+}
+
+// followUp plans the next run of a task right after an attempt was stored when it is
+// due before the retriever's next tick, so that intervals below the tick stay precise.
+// Otherwise the task is released and planned by the retriever. The task is reloaded
+// so that it is not planned anymore once it was paused.
+func (f *Fetcher) followUp(ctx context.Context, a *assignment) {
+	ctx = util.WithTenant(ctx, a.tenant)
+
+	task, err := f.storage.Get(ctx, a.task.Id)
+	if err != nil {
+		f.release(a)
+		return
+	}
+
+	task = f.resolve(ctx, task)
+	now := time.Now()
+
+	next, err := nextRun(task, []*model.Attempt{a.result}, now)
+	if err != nil || next.IsZero() || next.After(now.Add(defaultTickerInterval)) {
+		f.release(a)
+		return
+	}
+
+	following := &assignment{tenant: a.tenant, task: task, previous: a.previous, failures: a.failures, planned: next}
+
+	switch {
+	case a.result.Outcome == model.OutcomeBlocked:
+	case notify.Failed(a.result):
+		following.failures++
+	default:
+		following.failures = 0
+	}
+
+	if a.result.Outcome == model.OutcomeSuccess {
+		following.previous = a.result
+	}
+
+	f.plan(following)
+}
@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"crawler/pkg/util"
+)
+
+func (f *Fetcher) Stats(w http.ResponseWriter, r *http.Request) {
+	stats, err := f.storage.Stats(r.Context())
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(stats)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+}
+
+func (f *Fetcher) SchedulerStats(w http.ResponseWriter, r *http.Request) {
+	err := json.NewEncoder(w).Encode(f.drift.snapshot())
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+}
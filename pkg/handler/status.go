@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"crawler/pkg/health"
+	"crawler/pkg/util"
+)
+
+func (f *Fetcher) Status(w http.ResponseWriter, r *http.Request) {
+	id, err := taskId(r)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	attempts, err := f.storage.ListAttempts(r.Context(), id)
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(health.Status(id, attempts))
+	if err != nil {
+		util.EmitHttpError(w, err)
+		return
+	}
+}
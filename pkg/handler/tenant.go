@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"crawler/pkg/auth"
+	"crawler/pkg/logging"
+	"crawler/pkg/model"
+	"crawler/pkg/util"
+)
+
+// TenantHeader names the tenant of a request.
+const TenantHeader = "X-Tenant-ID"
+
+// WithTenants sets the tenants whose tasks are scheduled besides the default tenant and their quotas.
+func WithTenants(tenants []model.Tenant) FetcherOption {
+	return func(f *Fetcher) {
+		f.tenants = make(map[string]*model.Tenant, len(tenants))
+		for i := range tenants {
+			f.tenants[tenants[i].Id] = &tenants[i]
+		}
+	}
+}
+
+// ValidateTenants checks the tenant configuration.
+func ValidateTenants(tenants []model.Tenant) error {
+	seen := make(map[string]bool, len(tenants))
+
+	for _, t := range tenants {
+		if !validGroupName(t.Id) {
+			return util.Wrap(util.ErrValidation, fmt.Sprintf("invalid tenant id '%s'", t.Id))
+		}
+
+		if seen[t.Id] {
+			return util.Wrap(util.ErrValidation, fmt.Sprintf("duplicate tenant id '%s'", t.Id))
+		}
+
+		seen[t.Id] = true
+
+		if t.MaxTasks < 0 || t.MinIntervalMs < 0 || t.MaxHistoryBytes < 0 {
+			return util.Wrap(util.ErrValidation, fmt.Sprintf("negative quota of tenant '%s'", t.Id))
+		}
+	}
+
+	return nil
+}
+
+// NewTenantMW scopes requests to the tenant named by the X-Tenant-ID header, requests
+// without it belong to the default tenant. Unknown tenants are rejected. Callers bound
+// to a tenant are scoped to it, only admins of the default tenant may choose one.
+func NewTenantMW(tenants []model.Tenant) func(http.Handler) http.Handler {
+	known := make(map[string]bool, len(tenants))
+	for _, t := range tenants {
+		known[t.Id] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				tenant := r.Header.Get(TenantHeader)
+
+				if principal := auth.FromContext(r.Context()); principal != nil {
+					switch {
+					case principal.Tenant != "" && (tenant == "" || tenant == principal.Tenant):
+						tenant = principal.Tenant
+					case tenant != "" && (principal.Tenant != "" || principal.Role != auth.RoleAdmin):
+						auditDenied(r, principal.Subject, "tenant "+tenant+" not allowed")
+						http.Error(w, "", http.StatusForbidden)
+						return
+					}
+				}
+
+				if tenant != "" && !known[tenant] {
+					http.Error(w, "", http.StatusForbidden)
+					return
+				}
+
+				next.ServeHTTP(w, r.WithContext(util.WithTenant(r.Context(), tenant)))
+			},
+		)
+	}
+}
+
+// maxTasks returns the task limit of the context's tenant, zero when it has none.
+func (f *Fetcher) maxTasks(ctx context.Context) int {
+	if tenant, ok := f.tenants[util.Tenant(ctx)]; ok {
+		return tenant.MaxTasks
+	}
+
+	return 0
+}
+
+// tenantIds returns the default tenant and all configured tenants.
+func (f *Fetcher) tenantIds() []string {
+	ids := []string{""}
+	for id := range f.tenants {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+// checkQuota makes sure the context's tenant may create the tasks with their intervals,
+// the store enforces the task limit as it creates them.
+func (f *Fetcher) checkQuota(ctx context.Context, tasks ...*model.Task) error {
+	tenant, ok := f.tenants[util.Tenant(ctx)]
+	if !ok {
+		return nil
+	}
+
+	for _, task := range tasks {
+		err := checkInterval(tenant, f.resolve(ctx, task).EffectiveIntervalMs(), task.Schedule)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func checkInterval(tenant *model.Tenant, intervalMs int64, s *model.Schedule) error {
+	if s != nil && s.Cron != "" {
+		return nil
+	}
+
+	if tenant.MinIntervalMs > 0 && intervalMs < tenant.MinIntervalMs {
+		return util.Wrap(util.ErrQuotaExceeded, fmt.Sprintf("interval must be at least %d ms", tenant.MinIntervalMs))
+	}
+
+	return nil
+}
+
+// enforceHistoryQuota drops the response of the assignment's attempt when the
+// tenant's stored responses reached its quota. The stores keep the byte usage as
+// counters updated with every stored and removed blob, so reading it stays cheap.
+func (f *Fetcher) enforceHistoryQuota(ctx context.Context, a *assignment) {
+	tenant, ok := f.tenants[a.tenant]
+	if !ok || tenant.MaxHistoryBytes == 0 || a.result.Response == "" {
+		return
+	}
+
+	stats, err := f.storage.Stats(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Error("checking history quota failed", "task_id", a.task.Id, "error", err)
+		return
+	}
+
+	if stats.StoredBytes >= tenant.MaxHistoryBytes {
+		a.result.Response = ""
+		a.result.QuotaExceeded = true
+	}
+}
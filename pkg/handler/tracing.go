@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/label"
+
+	"crawler/pkg/logging"
+	"crawler/pkg/store"
+	"crawler/pkg/tracing"
+)
+
+// NewTracingMW records a span of every API request, named by its route template.
+// Requests carrying a traceparent header continue the caller's trace.
+func NewTracingMW(router *mux.Router) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				route := "unmatched"
+
+				var match mux.RouteMatch
+				if router.Match(r, &match) && match.Route != nil {
+					if template, err := match.Route.GetPathTemplate(); err == nil {
+						route = template
+					}
+				}
+
+				ctx := tracing.Extract(r.Context(), r.Header)
+				ctx, span := tracing.Start(ctx, r.Method+" "+route,
+					label.String("http.method", r.Method),
+					label.String("http.route", route),
+					label.String("request_id", logging.RequestId(ctx)),
+				)
+				defer span.End()
+
+				recorder := &statusRecorder{ResponseWriter: w}
+				next.ServeHTTP(recorder, r.WithContext(ctx))
+
+				if recorder.status == 0 {
+					recorder.status = http.StatusOK
+				}
+
+				span.SetAttributes(label.Int("http.status_code", recorder.status))
+				if recorder.status >= http.StatusInternalServerError {
+					span.SetStatus(codes.Internal, http.StatusText(recorder.status))
+				}
+			},
+		)
+	}
+}
+
+// NewStoreTracing returns an observer recording a span of every store operation.
+func NewStoreTracing() store.Observer {
+	return func(ctx context.Context, op string) (context.Context, func(error)) {
+		ctx, span := tracing.Start(ctx, "store "+op, label.String("store.operation", op))
+
+		return ctx, func(err error) {
+			tracing.End(span, err)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"crawler/pkg/extract"
+	"crawler/pkg/health"
+	"crawler/pkg/labels"
+	"crawler/pkg/model"
+	"crawler/pkg/notify"
+	"crawler/pkg/schedule"
+	"crawler/pkg/util"
+)
+
+var allowedMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
+func validateTask(task *model.Task) error {
+	u, err := url.Parse(task.Url)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return util.Wrap(util.ErrValidation, "url must be an absolute http(s) url")
+	}
+
+	task.Method = strings.ToUpper(task.Method)
+	if task.Method != "" && !allowedMethods[task.Method] {
+		return util.Wrap(util.ErrValidation, "unsupported method")
+	}
+
+	if task.Body != "" && (task.Method == "" || task.Method == http.MethodGet || task.Method == http.MethodHead) {
+		return util.Wrap(util.ErrValidation, "request body requires a method that accepts one")
+	}
+
+	for k := range task.Headers {
+		if k == "" || strings.ContainsAny(k, " :\r\n") {
+			return util.Wrap(util.ErrValidation, "invalid header name")
+		}
+	}
+
+	// exports redact credentials, they have to be filled in again before an import
+	if redacted(task.Headers) || redacted(task.Query) {
+		return util.Wrap(util.ErrValidation, "redacted header or query value")
+	}
+
+	err = labels.Validate(task.Labels)
+	if err != nil {
+		return err
+	}
+
+	if task.Group != "" && !validGroupName(task.Group) {
+		return util.Wrap(util.ErrValidation, "invalid group name")
+	}
+
+	if task.Retention < 0 || task.Retention > maxRetention {
+		return util.Wrap(util.ErrValidation, fmt.Sprintf("retention must be between 0 and %d", maxRetention))
+	}
+
+	if task.ExtractOnly && len(task.Extractors) == 0 {
+		return util.Wrap(util.ErrValidation, "extract_only requires extractors")
+	}
+
+	err = extract.Validate(task.Extractors)
+	if err != nil {
+		return err
+	}
+
+	if task.HealthCheck && task.Assertions == nil {
+		return util.Wrap(util.ErrValidation, "health_check requires assertions")
+	}
+
+	err = health.Validate(task.Assertions)
+	if err != nil {
+		return err
+	}
+
+	err = notify.Validate(task.Webhooks)
+	if err != nil {
+		return err
+	}
+
+	// tasks of a group may inherit its interval, checkGroup makes sure it has one
+	_, err = schedule.New(task)
+	if err != nil && !(task.Group != "" && errors.Is(err, schedule.ErrNoInterval)) {
+		return err
+	}
+
+	if task.Auth != nil {
+		return validateAuth(task.Auth)
+	}
+
+	return nil
+}
+
+func validateAuth(auth *model.Auth) error {
+	switch auth.Type {
+	case model.AuthBasic:
+		if auth.Username == "" || auth.PasswordRef == "" {
+			return util.Wrap(util.ErrValidation, "basic auth requires username and password_ref")
+		}
+	case model.AuthBearer:
+		if auth.TokenRef == "" {
+			return util.Wrap(util.ErrValidation, "bearer auth requires token_ref")
+		}
+	case model.AuthOAuth2:
+		u, err := url.Parse(auth.TokenUrl)
+		if err != nil || u.Host == "" {
+			return util.Wrap(util.ErrValidation, "oauth2 auth requires an absolute token_url")
+		}
+
+		if auth.ClientId == "" || auth.ClientSecretRef == "" {
+			return util.Wrap(util.ErrValidation, "oauth2 auth requires client_id and client_secret_ref")
+		}
+	default:
+		return util.Wrap(util.ErrValidation, "unsupported auth type")
+	}
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package health
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"crawler/pkg/extract"
+	"crawler/pkg/model"
+	"crawler/pkg/util"
+)
+
+func Validate(a *model.Assertions) error {
+	if a == nil {
+		return nil
+	}
+
+	for _, code := range a.StatusCodes {
+		if code < 100 || code > 599 {
+			return util.Wrap(util.ErrValidation, "assertions: invalid status code")
+		}
+	}
+
+	if a.MaxLatencyMs < 0 {
+		return util.Wrap(util.ErrValidation, "assertions: max_latency_ms must not be negative")
+	}
+
+	if a.BodyRegex != "" {
+		if _, err := regexp.Compile(a.BodyRegex); err != nil {
+			return util.Wrap(util.ErrValidation, "assertions: invalid body_regex")
+		}
+	}
+
+	extractors := make([]model.Extractor, 0, len(a.JSONFields))
+	for path := range a.JSONFields {
+		extractors = append(extractors, model.Extractor{Name: path, Type: model.ExtractJSON, Expr: path})
+	}
+
+	err := extract.Validate(extractors)
+	if err != nil {
+		return util.Wrap(err, "assertions: invalid json_fields")
+	}
+
+	return nil
+}
+
+// Evaluate checks the attempt against the assertions. Blocked attempts are not checks
+// and return nil, failed fetches always fail.
+func Evaluate(a *model.Assertions, attempt *model.Attempt) *model.AssertionResult {
+	if a == nil || attempt.Outcome == model.OutcomeBlocked {
+		return nil
+	}
+
+	if attempt.Outcome != model.OutcomeSuccess {
+		return &model.AssertionResult{Passed: false, Failures: []string{"fetch failed"}}
+	}
+
+	var failures []string
+
+	if len(a.StatusCodes) > 0 && !containsCode(a.StatusCodes, attempt.StatusCode) {
+		failures = append(failures, fmt.Sprintf("status code %d not in %v", attempt.StatusCode, a.StatusCodes))
+	}
+
+	latency := time.Duration(attempt.Duration * float64(time.Second))
+	if a.MaxLatencyMs > 0 && latency > time.Duration(a.MaxLatencyMs)*time.Millisecond {
+		failures = append(failures, fmt.Sprintf("latency %dms exceeds %dms", latency.Milliseconds(), a.MaxLatencyMs))
+	}
+
+	if a.BodyContains != "" && !strings.Contains(attempt.Response, a.BodyContains) {
+		failures = append(failures, fmt.Sprintf("body does not contain %q", a.BodyContains))
+	}
+
+	if a.BodyRegex != "" {
+		re, err := regexp.Compile(a.BodyRegex)
+		if err != nil || !re.MatchString(attempt.Response) {
+			failures = append(failures, fmt.Sprintf("body does not match %q", a.BodyRegex))
+		}
+	}
+
+	// sorted for stable failure messages
+	paths := make([]string, 0, len(a.JSONFields))
+	for path := range a.JSONFields {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		expected := a.JSONFields[path]
+
+		v, ok := extract.Value(model.Extractor{Type: model.ExtractJSON, Expr: path}, attempt.Response)
+		if !ok {
+			failures = append(failures, fmt.Sprintf("json field %s missing", path))
+		} else if v != expected {
+			failures = append(failures, fmt.Sprintf("json field %s is %q, expected %q", path, v, expected))
+		}
+	}
+
+	return &model.AssertionResult{Passed: len(failures) == 0, Failures: failures}
+}
+
+func containsCode(codes []int, code int) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Status summarizes the checks in the attempts, which are ordered from the oldest.
+func Status(id int, attempts []*model.Attempt) *model.TaskStatus {
+	status := &model.TaskStatus{Id: id, State: model.StateUnknown}
+
+	for _, a := range attempts {
+		if a.Assertions == nil {
+			continue
+		}
+
+		state := model.StateDown
+		if a.Assertions.Passed {
+			state = model.StateUp
+			status.Passed++
+		}
+
+		if state != status.State {
+			status.State = state
+			status.Since = a.CreatedAt
+		}
+
+		status.Checks++
+		status.LastCheckedAt = a.CreatedAt
+		status.Failures = a.Assertions.Failures
+	}
+
+	if status.Checks > 0 {
+		status.Uptime = float64(status.Passed) * 100 / float64(status.Checks)
+	}
+
+	return status
+}
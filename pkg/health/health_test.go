@@ -0,0 +1,92 @@
+// +build unit !integration
+
+package health
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"crawler/pkg/model"
+	"crawler/pkg/util"
+)
+
+func TestEvaluate(t *testing.T) {
+	success := &model.Attempt{
+		Outcome:    model.OutcomeSuccess,
+		StatusCode: 200,
+		Duration:   0.25,
+		Response:   `{"status": "ok", "db": {"up": true}}`,
+	}
+
+	tests := []struct {
+		name       string
+		assertions *model.Assertions
+		attempt    *model.Attempt
+		expected   *model.AssertionResult
+	}{
+		{"no assertions", nil, success, nil},
+		{"blocked", &model.Assertions{}, &model.Attempt{Outcome: model.OutcomeBlocked}, nil},
+		{"fetch error", &model.Assertions{}, &model.Attempt{Outcome: model.OutcomeError},
+			&model.AssertionResult{Failures: []string{"fetch failed"}}},
+		{"all pass", &model.Assertions{
+			StatusCodes:  []int{200, 204},
+			MaxLatencyMs: 500,
+			BodyContains: `"ok"`,
+			BodyRegex:    `"up":\s*true`,
+			JSONFields:   map[string]string{"$.status": "ok", "$.db.up": "true"},
+		}, success, &model.AssertionResult{Passed: true}},
+		{"status code", &model.Assertions{StatusCodes: []int{204}}, success,
+			&model.AssertionResult{Failures: []string{"status code 200 not in [204]"}}},
+		{"latency", &model.Assertions{MaxLatencyMs: 100}, success,
+			&model.AssertionResult{Failures: []string{"latency 250ms exceeds 100ms"}}},
+		{"body", &model.Assertions{BodyContains: "error", BodyRegex: "^<html"}, success,
+			&model.AssertionResult{Failures: []string{`body does not contain "error"`, `body does not match "^<html"`}}},
+		{"json fields", &model.Assertions{JSONFields: map[string]string{"$.status": "down", "$.cache": "up"}}, success,
+			&model.AssertionResult{Failures: []string{"json field $.cache missing", `json field $.status is "ok", expected "down"`}}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Evaluate(tc.assertions, tc.attempt))
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate(nil))
+	assert.NoError(t, Validate(&model.Assertions{StatusCodes: []int{200}, JSONFields: map[string]string{"$.a": "b"}}))
+
+	for _, a := range []*model.Assertions{
+		{StatusCodes: []int{42}},
+		{MaxLatencyMs: -1},
+		{BodyRegex: "("},
+		{JSONFields: map[string]string{"$.items[": "ok"}},
+	} {
+		assert.True(t, errors.Is(Validate(a), util.ErrValidation))
+	}
+}
+
+func TestStatus(t *testing.T) {
+	status := Status(1, []*model.Attempt{{CreatedAt: 10}})
+	assert.Equal(t, &model.TaskStatus{Id: 1, State: model.StateUnknown}, status)
+
+	status = Status(1, []*model.Attempt{
+		{CreatedAt: 10, Assertions: &model.AssertionResult{Passed: false, Failures: []string{"x"}}},
+		{CreatedAt: 20, Assertions: &model.AssertionResult{Passed: true}},
+		{CreatedAt: 30},
+		{CreatedAt: 40, Assertions: &model.AssertionResult{Passed: true}},
+		{CreatedAt: 50, Assertions: &model.AssertionResult{Passed: true}},
+	})
+
+	assert.Equal(t, &model.TaskStatus{
+		Id:            1,
+		State:         model.StateUp,
+		Uptime:        75,
+		Checks:        4,
+		Passed:        3,
+		LastCheckedAt: 50,
+		Since:         20,
+	}, status)
+}
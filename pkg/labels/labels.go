@@ -0,0 +1,127 @@
+// Package labels parses label selectors and matches them against task labels.
+package labels
+
+import (
+	"strings"
+
+	"crawler/pkg/util"
+)
+
+const (
+	opEquals    = "="
+	opNotEquals = "!="
+	opExists    = "exists"
+	opMissing   = "!exists"
+)
+
+type requirement struct {
+	key   string
+	op    string
+	value string
+}
+
+// Selector is a conjunction of requirements like team=payments, env!=prod, canary or !canary.
+// The empty selector matches everything.
+type Selector []requirement
+
+// Parse reads a comma separated list of requirements.
+func Parse(s string) (Selector, error) {
+	var sel Selector
+
+	if strings.TrimSpace(s) == "" {
+		return sel, nil
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+
+		var r requirement
+
+		switch {
+		case strings.Contains(part, opNotEquals):
+			kv := strings.SplitN(part, opNotEquals, 2)
+			r = requirement{key: strings.TrimSpace(kv[0]), op: opNotEquals, value: strings.TrimSpace(kv[1])}
+		case strings.Contains(part, opEquals):
+			kv := strings.SplitN(strings.Replace(part, "==", "=", 1), opEquals, 2)
+			r = requirement{key: strings.TrimSpace(kv[0]), op: opEquals, value: strings.TrimSpace(kv[1])}
+		case strings.HasPrefix(part, "!"):
+			r = requirement{key: strings.TrimSpace(part[1:]), op: opMissing}
+		default:
+			r = requirement{key: part, op: opExists}
+		}
+
+		if ValidateKey(r.key) != nil || ValidateValue(r.value) != nil {
+			return nil, util.Wrap(util.ErrValidation, "invalid label selector "+part)
+		}
+
+		sel = append(sel, r)
+	}
+
+	return sel, nil
+}
+
+// Matches tells whether the labels satisfy all requirements.
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s {
+		v, ok := labels[r.key]
+
+		switch r.op {
+		case opEquals:
+			if !ok || v != r.value {
+				return false
+			}
+		case opNotEquals:
+			if ok && v == r.value {
+				return false
+			}
+		case opExists:
+			if !ok {
+				return false
+			}
+		case opMissing:
+			if ok {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Empty tells whether the selector has no requirements.
+func (s Selector) Empty() bool {
+	return len(s) == 0
+}
+
+// ValidateKey accepts non empty keys without spaces, commas, '=' and '!'.
+func ValidateKey(key string) error {
+	if key == "" || strings.ContainsAny(key, " \t\r\n,=!") {
+		return util.Wrap(util.ErrValidation, "invalid label key")
+	}
+
+	return nil
+}
+
+// ValidateValue accepts values without spaces, commas, '=' and '!'.
+func ValidateValue(value string) error {
+	if strings.ContainsAny(value, " \t\r\n,=!") {
+		return util.Wrap(util.ErrValidation, "invalid label value")
+	}
+
+	return nil
+}
+
+// Validate checks the keys and values of task labels.
+func Validate(labels map[string]string) error {
+	for k, v := range labels {
+		if err := ValidateKey(k); err != nil {
+			return err
+		}
+
+		if err := ValidateValue(v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
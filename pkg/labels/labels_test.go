@@ -0,0 +1,52 @@
+// +build unit !integration
+
+package labels
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelector(t *testing.T) {
+	labels := map[string]string{"team": "payments", "env": "prod"}
+
+	tests := []struct {
+		selector string
+		matches  bool
+	}{
+		{"", true},
+		{"team=payments", true},
+		{"team==payments", true},
+		{"team=search", false},
+		{"team=payments, env!=prod", false},
+		{"env!=staging", true},
+		{"owner!=me", true},
+		{"env", true},
+		{"canary", false},
+		{"!canary", true},
+		{"!env", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.selector, func(t *testing.T) {
+			sel, err := Parse(test.selector)
+			require.NoError(t, err)
+			assert.Equal(t, test.matches, sel.Matches(labels))
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, s := range []string{"=payments", "team=a=b", "a b", "team=payments,", "!"} {
+		_, err := Parse(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate(map[string]string{"team": "payments", "canary": ""}))
+	assert.Error(t, Validate(map[string]string{"": "payments"}))
+	assert.Error(t, Validate(map[string]string{"team": "a,b"}))
+}
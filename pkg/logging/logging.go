@@ -0,0 +1,212 @@
+// Package logging writes leveled logs as JSON lines. Messages are constant, the
+// details are added as key value pairs, so that logs can be searched by them.
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"crawler/pkg/util"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+
+	return levelNames[l]
+}
+
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+
+	return LevelInfo, util.Wrap(util.ErrValidation, fmt.Sprintf("unknown log level '%s'", s))
+}
+
+// output is shared by a logger and the loggers derived from it.
+type output struct {
+	w     io.Writer
+	level Level
+	now   func() time.Time
+	mutex sync.Mutex
+}
+
+type Logger struct {
+	out    *output
+	fields []interface{}
+}
+
+func New(w io.Writer, level Level) *Logger {
+	return &Logger{out: &output{w: w, level: level, now: time.Now}}
+}
+
+// With returns a logger adding the key value pairs to every entry.
+func (l *Logger) With(kv ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(kv))
+	fields = append(append(fields, l.fields...), kv...)
+
+	return &Logger{out: l.out, fields: fields}
+}
+
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.out.level
+}
+
+func (l *Logger) Debug(msg string, kv ...interface{}) {
+	l.log(LevelDebug, msg, kv)
+}
+
+func (l *Logger) Info(msg string, kv ...interface{}) {
+	l.log(LevelInfo, msg, kv)
+}
+
+func (l *Logger) Warn(msg string, kv ...interface{}) {
+	l.log(LevelWarn, msg, kv)
+}
+
+func (l *Logger) Error(msg string, kv ...interface{}) {
+	l.log(LevelError, msg, kv)
+}
+
+// Fatal logs an error and exits.
+func (l *Logger) Fatal(msg string, kv ...interface{}) {
+	l.log(LevelError, msg, kv)
+	os.Exit(1)
+}
+
+func (l *Logger) log(level Level, msg string, kv []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	entry := map[string]interface{}{
+		"time":  l.out.now().UTC().Format(time.RFC3339Nano),
+		"level": level.String(),
+		"msg":   msg,
+	}
+
+	addFields(entry, l.fields)
+	addFields(entry, kv)
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		data = []byte(fmt.Sprintf(`{"level":"error","msg":"encoding log entry failed","error":%q}`, err.Error()))
+	}
+
+	l.out.mutex.Lock()
+	defer l.out.mutex.Unlock()
+
+	_, _ = l.out.w.Write(append(data, '\n'))
+}
+
+// addFields adds key value pairs to the entry, errors are added by their message
+// and a key without value is kept with a null value.
+func addFields(entry map[string]interface{}, kv []interface{}) {
+	for i := 0; i < len(kv); i += 2 {
+		key := fmt.Sprint(kv[i])
+
+		var value interface{}
+		if i+1 < len(kv) {
+			value = kv[i+1]
+		}
+
+		switch v := value.(type) {
+		case error:
+			value = v.Error()
+		case time.Duration:
+			value = float64(v) / float64(time.Millisecond)
+		case fmt.Stringer:
+			value = v.String()
+		}
+
+		entry[key] = value
+	}
+}
+
+var (
+	std      = New(os.Stderr, LevelInfo)
+	stdMutex sync.RWMutex
+)
+
+// Default returns the logger used unless a component was given its own.
+func Default() *Logger {
+	stdMutex.RLock()
+	defer stdMutex.RUnlock()
+
+	return std
+}
+
+func SetDefault(l *Logger) {
+	stdMutex.Lock()
+	defer stdMutex.Unlock()
+
+	std = l
+}
+
+type requestIdKey struct{}
+
+func WithRequestId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, id)
+}
+
+func RequestId(ctx context.Context) string {
+	id, _ := ctx.Value(requestIdKey{}).(string)
+
+	return id
+}
+
+// FromContext returns the default logger adding the request id and the tenant of the context.
+func FromContext(ctx context.Context) *Logger {
+	l := Default()
+
+	var kv []interface{}
+	if id := RequestId(ctx); id != "" {
+		kv = append(kv, "request_id", id)
+	}
+
+	if tenant := util.Tenant(ctx); tenant != "" {
+		kv = append(kv, "tenant", tenant)
+	}
+
+	if kv == nil {
+		return l
+	}
+
+	return l.With(kv...)
+}
+
+// Writer returns a writer logging each write as a message of the level, so that
+// output of the standard log package ends up in the same format.
+func (l *Logger) Writer(level Level) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		l.log(level, strings.TrimSpace(string(p)), nil)
+		return len(p), nil
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
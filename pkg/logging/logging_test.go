@@ -0,0 +1,87 @@
+// +build unit !integration
+
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"crawler/pkg/util"
+)
+
+func entries(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var result []map[string]interface{}
+
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+
+		var e map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &e), line)
+		result = append(result, e)
+	}
+
+	return result
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+
+	l := New(&buf, LevelInfo)
+	l.out.now = func() time.Time { return time.Unix(0, 0) }
+
+	l.Debug("hidden")
+	l.With("task_id", 1).Error("saving failed", "error", errors.New("boom"), "took", time.Millisecond*1500, "dangling")
+
+	logged := entries(t, &buf)
+	require.Len(t, logged, 1)
+	assert.Equal(t, map[string]interface{}{
+		"time":     "1970-01-01T00:00:00Z",
+		"level":    "error",
+		"msg":      "saving failed",
+		"task_id":  float64(1),
+		"error":    "boom",
+		"took":     float64(1500),
+		"dangling": nil,
+	}, logged[0])
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("WARN")
+	require.NoError(t, err)
+	assert.Equal(t, LevelWarn, level)
+
+	_, err = ParseLevel("verbose")
+	assert.True(t, errors.Is(err, util.ErrValidation))
+}
+
+func TestFromContext(t *testing.T) {
+	var buf bytes.Buffer
+
+	previous := Default()
+	defer SetDefault(previous)
+	SetDefault(New(&buf, LevelDebug))
+
+	ctx := util.WithTenant(WithRequestId(context.Background(), "abc"), "acme")
+	FromContext(ctx).Debug("hello")
+
+	std := log.New(Default().Writer(LevelWarn), "", 0)
+	std.Printf("legacy %d", 1)
+
+	logged := entries(t, &buf)
+	require.Len(t, logged, 2)
+	assert.Equal(t, "abc", logged[0]["request_id"])
+	assert.Equal(t, "acme", logged[0]["tenant"])
+	assert.Equal(t, "legacy 1", logged[1]["msg"])
+	assert.Equal(t, "warn", logged[1]["level"])
+}
@@ -0,0 +1,58 @@
+// +build unit !integration
+
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+
+	c := r.Counter("requests_total", "Requests.", "route", "status")
+	c.Inc("/a", "200")
+	c.Add(2, "/a", "200")
+	c.Inc(`/"b"`, "500")
+	c.Add(-1, "/a", "200")
+
+	h := r.Histogram("latency_seconds", "Latency.", []float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(5)
+
+	r.Gauge("queue_depth", "Queued tasks.", func() float64 { return 3 })
+
+	assert.Equal(t, float64(3), c.Value("/a", "200"))
+	assert.Equal(t, uint64(3), h.Count())
+
+	var buf bytes.Buffer
+	require.NoError(t, r.Write(&buf))
+
+	assert.Equal(t, `# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{route="/\"b\"",status="500"} 1
+requests_total{route="/a",status="200"} 3
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 5.55
+latency_seconds_count 3
+# HELP queue_depth Queued tasks.
+# TYPE queue_depth gauge
+queue_depth 3
+`, buf.String())
+
+	assert.Panics(t, func() { c.Inc("/a") })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, ContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, buf.String(), w.Body.String())
+}
@@ -0,0 +1,62 @@
+package model
+
+const (
+	AuditCreate = "create"
+	AuditDelete = "delete"
+	AuditPause  = "pause"
+	AuditResume = "resume"
+
+	AuditGroupCreate = "group_create"
+	AuditGroupUpdate = "group_update"
+	AuditGroupDelete = "group_delete"
+)
+
+// AuditEntry records a change of a task or a group by an actor. Before is unset for
+// created tasks, After for deleted ones, likewise BeforeGroup and AfterGroup.
+type AuditEntry struct {
+	Id          int64  `json:"id"`
+	Action      string `json:"action"`
+	TaskId      int    `json:"task_id,omitempty"`
+	Group       string `json:"group,omitempty"`
+	Actor       string `json:"actor"`
+	CreatedAt   int64  `json:"created_at"`
+	Before      *Task  `json:"before,omitempty"`
+	After       *Task  `json:"after,omitempty"`
+	BeforeGroup *Group `json:"before_group,omitempty"`
+	AfterGroup  *Group `json:"after_group,omitempty"`
+}
+
+// AuditQuery selects audit entries, zero fields do not filter. Since and Until
+// are unix timestamps, both inclusive. Before selects the entries older than
+// the one with that id. A zero Limit means no limit.
+type AuditQuery struct {
+	TaskId int
+	Group  string
+	Actor  string
+	Action string
+	Since  int64
+	Until  int64
+	Before int64
+	Limit  int
+}
+
+func (q *AuditQuery) Matches(e *AuditEntry) bool {
+	switch {
+	case q.TaskId != 0 && e.TaskId != q.TaskId:
+		return false
+	case q.Group != "" && e.Group != q.Group:
+		return false
+	case q.Before != 0 && e.Id >= q.Before:
+		return false
+	case q.Actor != "" && e.Actor != q.Actor:
+		return false
+	case q.Action != "" && e.Action != q.Action:
+		return false
+	case q.Since != 0 && e.CreatedAt < q.Since:
+		return false
+	case q.Until != 0 && e.CreatedAt > q.Until:
+		return false
+	}
+
+	return true
+}
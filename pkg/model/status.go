@@ -0,0 +1,33 @@
+package model
+
+const (
+	WorkerIdle    = "idle"
+	WorkerBusy    = "busy"
+	WorkerStalled = "stalled"
+)
+
+// WorkerStatus is the state of a worker, SinceMs is when it entered the state.
+type WorkerStatus struct {
+	Id      int    `json:"id"`
+	State   string `json:"state"`
+	TaskId  int    `json:"task_id,omitempty"`
+	Tenant  string `json:"tenant,omitempty"`
+	SinceMs int64  `json:"since_ms"`
+}
+
+// ServiceStatus describes the scheduler and the workers for debugging. Times are unix milliseconds.
+type ServiceStatus struct {
+	Running       bool            `json:"running"`
+	StartedAtMs   int64           `json:"started_at_ms"`
+	LastTickMs    int64           `json:"last_tick_ms"`
+	QueueDepth    int             `json:"queue_depth"`
+	DueNotStarted int             `json:"due_not_started"`
+	Workers       []WorkerStatus  `json:"workers"`
+	Scheduler     *SchedulerStats `json:"scheduler"`
+}
+
+// Readiness tells whether the service can take traffic and the result of each check.
+type Readiness struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks"`
+}
@@ -1,13 +1,350 @@
 package model
 
+import (
+	"net/url"
+	"strings"
+
+	"crawler/pkg/labels"
+)
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+	OutcomeBlocked = "blocked_by_robots"
+
+	AuthBasic  = "basic"
+	AuthBearer = "bearer"
+	AuthOAuth2 = "oauth2"
+
+	Redacted = "[REDACTED]"
+
+	ExtractRegex = "regex"
+	ExtractJSON  = "json"
+	ExtractCSS   = "css"
+
+	StateUp      = "up"
+	StateDown    = "down"
+	StateUnknown = "unknown"
+
+	EventFetchFailed     = "fetch_failed"
+	EventRecovered       = "recovered"
+	EventContentChanged  = "content_changed"
+	EventAssertionFailed = "assertion_failed"
+
+	SortId        = "id"
+	SortUrl       = "url"
+	SortInterval  = "interval"
+	SortCreatedAt = "created_at"
+
+	FilterPaused  = "paused"
+	FilterActive  = "active"
+	FilterFailing = "failing"
+)
+
 type Task struct {
-	Id       int    `json:"id,omitempty"`
-	Url      string `json:"url,omitempty"`
-	Interval int    `json:"interval,omitempty"`
+	Id         int               `json:"id,omitempty"`
+	Url        string            `json:"url,omitempty"`
+	Interval   int               `json:"interval,omitempty"`
+	Method     string            `json:"method,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Query      map[string]string `json:"query,omitempty"`
+	Body       string            `json:"body,omitempty"`
+	UserAgent  string            `json:"user_agent,omitempty"`
+	Auth       *Auth             `json:"auth,omitempty"`
+	Cookies    bool              `json:"cookies,omitempty"`
+	Extractors []Extractor       `json:"extractors,omitempty"`
+	// ExtractOnly drops the response body and keeps only the extracted values.
+	ExtractOnly bool        `json:"extract_only,omitempty"`
+	Assertions  *Assertions `json:"assertions,omitempty"`
+	// HealthCheck tasks keep only the outcome of attempts, not the response body.
+	HealthCheck bool      `json:"health_check,omitempty"`
+	Webhooks    []Webhook `json:"webhooks,omitempty"`
+	Schedule    *Schedule `json:"schedule,omitempty"`
+	// IntervalMs takes precedence over Interval for intervals below a second.
+	IntervalMs int64 `json:"interval_ms,omitempty"`
+	// JitterMs randomly shifts runs to spread load, every interval is lengthened
+	// or shortened by up to half of it, cron runs are delayed by up to all of it.
+	JitterMs int64 `json:"jitter_ms,omitempty"`
+	// Paused tasks are not scheduled, they can still be run manually.
+	Paused    bool              `json:"paused,omitempty"`
+	CreatedAt int64             `json:"created_at,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	// Group names the group whose settings the task inherits where it sets none.
+	Group string `json:"group,omitempty"`
+	// Retention is the number of attempts kept, the store's limit when not set.
+	Retention int `json:"retention,omitempty"`
+	// NextRunAt is computed when listing tasks, it is not stored.
+	NextRunAt int64 `json:"next_run_at,omitempty"`
+}
+
+// EffectiveIntervalMs is the interval in milliseconds tasks are sorted by.
+func (t *Task) EffectiveIntervalMs() int64 {
+	if t.IntervalMs > 0 {
+		return t.IntervalMs
+	}
+
+	return int64(t.Interval) * 1000
+}
+
+// Group holds default settings of its member tasks.
+type Group struct {
+	Name      string            `json:"name"`
+	Interval  int               `json:"interval,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Retention int               `json:"retention,omitempty"`
+}
+
+// Apply returns the task with the settings it inherits from the group. Tasks
+// without an interval or a cron schedule inherit the interval, headers of the
+// group are sent unless the task sets the same header.
+func (g *Group) Apply(t *Task) *Task {
+	c := *t
+
+	if c.Interval == 0 && c.IntervalMs == 0 && (c.Schedule == nil || c.Schedule.Cron == "") {
+		c.Interval = g.Interval
+	}
+
+	if c.Retention == 0 {
+		c.Retention = g.Retention
+	}
+
+	if len(g.Headers) > 0 {
+		c.Headers = make(map[string]string, len(g.Headers)+len(t.Headers))
+		for k, v := range g.Headers {
+			c.Headers[k] = v
+		}
+
+		for k, v := range t.Headers {
+			c.Headers[k] = v
+		}
+	}
+
+	return &c
+}
+
+// TaskQuery selects a page of tasks. Url matches a substring of the task url, Host
+// the url's host, State is one of the Filter* constants. A zero Limit means no limit.
+type TaskQuery struct {
+	Offset   int
+	Limit    int
+	Sort     string
+	Desc     bool
+	Url      string
+	Host     string
+	State    string
+	Selector labels.Selector
+}
+
+// MatchesUrl tells whether the url passes the query's url and host filters.
+func (q *TaskQuery) MatchesUrl(rawUrl string) bool {
+	if q.Url != "" && !strings.Contains(rawUrl, q.Url) {
+		return false
+	}
+
+	if q.Host == "" {
+		return true
+	}
+
+	u, err := url.Parse(rawUrl)
+
+	return err == nil && strings.EqualFold(u.Hostname(), q.Host)
+}
+
+// Page returns the part of a filtered and sorted list of n tasks the query selects.
+func (q *TaskQuery) Page(n int) (int, int) {
+	start := q.Offset
+	if start > n {
+		start = n
+	}
+
+	end := n
+	if q.Limit > 0 && start+q.Limit < n {
+		end = start + q.Limit
+	}
+
+	return start, end
+}
+
+// Tenant limits the tasks of a tenant, zero values mean no limit.
+type Tenant struct {
+	Id       string `json:"id"`
+	MaxTasks int    `json:"max_tasks,omitempty"`
+	// MinIntervalMs applies to fixed intervals, cron schedules run at most once a minute.
+	MinIntervalMs int64 `json:"min_interval_ms,omitempty"`
+	// MaxHistoryBytes limits the stored (compressed) response bodies, attempts
+	// beyond it are stored without their response.
+	MaxHistoryBytes int64 `json:"max_history_bytes,omitempty"`
+}
+
+// BulkResult reports the outcome of one task of a bulk import.
+type BulkResult struct {
+	Index int    `json:"index"`
+	Id    int    `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Schedule replaces the fixed interval with a cron expression and limits when a task runs.
+type Schedule struct {
+	// Cron has five fields: minute hour day-of-month month day-of-week.
+	// Without it the task runs every Interval seconds within the limits.
+	Cron     string `json:"cron,omitempty"`
+	TimeZone string `json:"time_zone,omitempty"`
+	// Start and End are RFC 3339 timestamps.
+	Start     string   `json:"start,omitempty"`
+	End       string   `json:"end,omitempty"`
+	Blackouts []Window `json:"blackouts,omitempty"`
+}
+
+// Window is a period between two RFC 3339 timestamps or between two clock
+// times (15:04) recurring every day in the schedule's time zone.
+type Window struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// Webhook subscribes an url to events of a task. Payloads are signed with the
+// secret referenced by SecretRef.
+type Webhook struct {
+	Url       string   `json:"url"`
+	Events    []string `json:"events"`
+	SecretRef string   `json:"secret_ref,omitempty"`
+	// FailureThreshold is the number of consecutive failed attempts which
+	// trigger a failure event, 1 when not set.
+	FailureThreshold int `json:"failure_threshold,omitempty"`
+}
+
+type Event struct {
+	Type      string `json:"type"`
+	Tenant    string `json:"tenant,omitempty"`
+	TaskId    int    `json:"task_id"`
+	Url       string `json:"url"`
+	AttemptId int64  `json:"attempt_id"`
+	CreatedAt int64  `json:"created_at"`
+	// Failures is the number of consecutive failed attempts including this one.
+	Failures int      `json:"failures,omitempty"`
+	Reasons  []string `json:"reasons,omitempty"`
+}
+
+// Delivery records the result of sending an event to a webhook.
+type Delivery struct {
+	Event      string `json:"event"`
+	Url        string `json:"url"`
+	AttemptId  int64  `json:"attempt_id"`
+	CreatedAt  int64  `json:"created_at"`
+	Tries      int    `json:"tries"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Delivered  bool   `json:"delivered"`
+}
+
+// Assertions are evaluated on every attempt, an attempt passes when all set checks pass.
+type Assertions struct {
+	StatusCodes  []int             `json:"status_codes,omitempty"`
+	MaxLatencyMs int64             `json:"max_latency_ms,omitempty"`
+	BodyContains string            `json:"body_contains,omitempty"`
+	BodyRegex    string            `json:"body_regex,omitempty"`
+	JSONFields   map[string]string `json:"json_fields,omitempty"`
+}
+
+type AssertionResult struct {
+	Passed   bool     `json:"passed"`
+	Failures []string `json:"failures,omitempty"`
+}
+
+type TaskStatus struct {
+	Id    int    `json:"id"`
+	State string `json:"state"`
+	// Uptime is the percentage of passed checks in the stored history.
+	Uptime        float64  `json:"uptime"`
+	Checks        int      `json:"checks"`
+	Passed        int      `json:"passed"`
+	LastCheckedAt int64    `json:"last_checked_at,omitempty"`
+	Since         int64    `json:"since,omitempty"`
+	Failures      []string `json:"failures,omitempty"`
+}
+
+type Extractor struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Expr string `json:"expr"`
+}
+
+// Auth holds credentials of the fetched target. Secret values are never stored,
+// the *Ref fields name secrets resolved by the secrets provider at fetch time.
+type Auth struct {
+	Type            string   `json:"type,omitempty"`
+	Username        string   `json:"username,omitempty"`
+	PasswordRef     string   `json:"password_ref,omitempty"`
+	TokenRef        string   `json:"token_ref,omitempty"`
+	TokenUrl        string   `json:"token_url,omitempty"`
+	ClientId        string   `json:"client_id,omitempty"`
+	ClientSecretRef string   `json:"client_secret_ref,omitempty"`
+	Scopes          []string `json:"scopes,omitempty"`
 }
 
 type Attempt struct {
-	Response  string  `json:"response,omitempty"`
-	CreatedAt int64   `json:"created_at,omitempty"`
-	Duration  float64 `json:"duration,omitempty"`
+	Id           int64   `json:"id,omitempty"`
+	Response     string  `json:"response,omitempty"`
+	CreatedAt    int64   `json:"created_at,omitempty"`
+	Duration     float64 `json:"duration,omitempty"`
+	Outcome      string  `json:"outcome,omitempty"`
+	StatusCode   int     `json:"status_code,omitempty"`
+	ETag         string  `json:"etag,omitempty"`
+	LastModified string  `json:"last_modified,omitempty"`
+	// NotModified attempts got a 304 and store no body, BodyRef is the id
+	// of the attempt holding it.
+	NotModified bool  `json:"not_modified,omitempty"`
+	BodyRef     int64 `json:"body_ref,omitempty"`
+	// Hash is the sha256 of the response, Changed tells whether it differs
+	// from the previous successful attempt.
+	Hash       string            `json:"hash,omitempty"`
+	Changed    bool              `json:"changed,omitempty"`
+	Extracted  map[string]string `json:"extracted,omitempty"`
+	Assertions *AssertionResult  `json:"assertions,omitempty"`
+	// PlannedAtMs is when the scheduler planned the attempt to start (unix milliseconds),
+	// DriftMs how much later it actually started. Both are missing for manual runs.
+	PlannedAtMs int64 `json:"planned_at_ms,omitempty"`
+	DriftMs     int64 `json:"drift_ms,omitempty"`
+	// QuotaExceeded attempts were stored without their response because the
+	// tenant's history quota was used up.
+	QuotaExceeded bool `json:"quota_exceeded,omitempty"`
+}
+
+// Failed tells whether the fetch failed or the response did not pass the assertions.
+func (a *Attempt) Failed() bool {
+	return a.Outcome == OutcomeError || a.Assertions != nil && !a.Assertions.Passed
+}
+
+// SchedulerStats describes how precisely the scheduler started attempts since the service started.
+type SchedulerStats struct {
+	Runs        int64   `json:"runs"`
+	MeanDriftMs float64 `json:"mean_drift_ms"`
+	MaxDriftMs  int64   `json:"max_drift_ms"`
+	LastDriftMs int64   `json:"last_drift_ms"`
+}
+
+type Cookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Domain   string `json:"domain"`
+	Path     string `json:"path"`
+	HostOnly bool   `json:"host_only,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+	HttpOnly bool   `json:"http_only,omitempty"`
+	Expires  int64  `json:"expires,omitempty"`
+}
+
+type StorageStats struct {
+	Blobs       int64 `json:"blobs"`
+	RawBytes    int64 `json:"raw_bytes"`
+	StoredBytes int64 `json:"stored_bytes"`
+	// CompressionRatio is RawBytes / StoredBytes, 1 when nothing is stored.
+	CompressionRatio float64 `json:"compression_ratio"`
+}
+
+func (s *StorageStats) UpdateRatio() {
+	s.CompressionRatio = 1
+	if s.StoredBytes > 0 {
+		s.CompressionRatio = float64(s.RawBytes) / float64(s.StoredBytes)
+	}
 }
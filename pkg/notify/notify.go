@@ -0,0 +1,332 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"crawler/pkg/logging"
+	"crawler/pkg/model"
+	"crawler/pkg/secrets"
+	"crawler/pkg/store"
+	"crawler/pkg/util"
+)
+
+const (
+	SignatureHeader = "X-Crawler-Signature"
+	EventHeader     = "X-Crawler-Event"
+
+	DefaultRetries = 3
+	DefaultBackoff = time.Second
+
+	deliveryTimeout = time.Second * 5
+)
+
+var knownEvents = map[string]bool{
+	model.EventFetchFailed:     true,
+	model.EventRecovered:       true,
+	model.EventContentChanged:  true,
+	model.EventAssertionFailed: true,
+}
+
+// Notifier sends events of attempts to the webhooks subscribed by their task and
+// to the global webhooks. Deliveries run in the background and are logged to the store.
+type Notifier struct {
+	storage store.Store
+	secrets secrets.Provider
+	global  []model.Webhook
+	client  *http.Client
+	retries int
+	backoff time.Duration
+	sleep   func(time.Duration)
+
+	pending sync.WaitGroup
+}
+
+type Option func(*Notifier)
+
+// WithWebhooks subscribes webhooks to events of all tasks.
+func WithWebhooks(webhooks []model.Webhook) Option {
+	return func(n *Notifier) {
+		n.global = webhooks
+	}
+}
+
+// WithSecrets resolves the secrets payloads are signed with.
+func WithSecrets(provider secrets.Provider) Option {
+	return func(n *Notifier) {
+		n.secrets = provider
+	}
+}
+
+// WithRetries sets how often a failed delivery is retried, the backoff doubles with each retry.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(n *Notifier) {
+		n.retries = retries
+		n.backoff = backoff
+	}
+}
+
+func NewNotifier(storage store.Store, opts ...Option) *Notifier {
+	n := &Notifier{
+		storage: storage,
+		client:  &http.Client{Timeout: deliveryTimeout},
+		retries: DefaultRetries,
+		backoff: DefaultBackoff,
+		sleep:   time.Sleep,
+	}
+
+	for _, opt := range opts {
+		opt(n)
+	}
+
+	return n
+}
+
+func Validate(webhooks []model.Webhook) error {
+	for _, w := range webhooks {
+		u, err := url.Parse(w.Url)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return util.Wrap(util.ErrValidation, "webhook url must be an absolute http(s) url")
+		}
+
+		if len(w.Events) == 0 {
+			return util.Wrap(util.ErrValidation, "webhook requires events")
+		}
+
+		for _, e := range w.Events {
+			if !knownEvents[e] {
+				return util.Wrap(util.ErrValidation, fmt.Sprintf("unknown webhook event '%s'", e))
+			}
+		}
+
+		if w.FailureThreshold < 0 {
+			return util.Wrap(util.ErrValidation, "webhook failure_threshold must not be negative")
+		}
+	}
+
+	return nil
+}
+
+// Failed tells whether the attempt counts as a failure, which is a failed
+// fetch or a failed assertion.
+func Failed(a *model.Attempt) bool {
+	return a.Failed()
+}
+
+// Failures returns the number of consecutive failed attempts at the end of the
+// history. Attempts blocked by robots.txt neither fail nor end a failure streak.
+func Failures(attempts []*model.Attempt) int {
+	failures := 0
+
+	for i := len(attempts) - 1; i >= 0; i-- {
+		switch {
+		case attempts[i].Outcome == model.OutcomeBlocked:
+			continue
+		case Failed(attempts[i]):
+			failures++
+		default:
+			return failures
+		}
+	}
+
+	return failures
+}
+
+// events returns the event types of the attempt for a webhook. failures is the number of
+// consecutive failed attempts before it, previous the last successful attempt.
+func events(w model.Webhook, attempt, previous *model.Attempt, failures int) []string {
+	threshold := w.FailureThreshold
+	if threshold <= 0 {
+		threshold = 1
+	}
+
+	var types []string
+
+	switch {
+	case attempt.Outcome == model.OutcomeBlocked:
+		return nil
+	case attempt.Outcome == model.OutcomeError:
+		// only the attempt reaching the threshold notifies, not the whole streak
+		if failures+1 == threshold {
+			types = append(types, model.EventFetchFailed)
+		}
+	case Failed(attempt):
+		if failures+1 == threshold {
+			types = append(types, model.EventAssertionFailed)
+		}
+	case failures >= threshold:
+		types = append(types, model.EventRecovered)
+	}
+
+	// the first response of a task is not a change
+	if attempt.Changed && previous != nil {
+		types = append(types, model.EventContentChanged)
+	}
+
+	subscribed := types[:0]
+	for _, t := range types {
+		for _, e := range w.Events {
+			if t == e {
+				subscribed = append(subscribed, t)
+				break
+			}
+		}
+	}
+
+	return subscribed
+}
+
+// Notify sends the events of a stored attempt to all subscribed webhooks. The context
+// only tells the tenant of the task, deliveries outlive it. The secrets of the task's
+// webhooks are resolved among those of the tenant.
+func (n *Notifier) Notify(ctx context.Context, task *model.Task, attempt, previous *model.Attempt, failures int) {
+	tenant := util.Tenant(ctx)
+	webhooks := append(append([]model.Webhook(nil), task.Webhooks...), n.global...)
+
+	for i, w := range webhooks {
+		provider := n.secrets
+		if i < len(task.Webhooks) && provider != nil {
+			provider = secrets.Scope(provider, tenant)
+		}
+
+		for _, t := range events(w, attempt, previous, failures) {
+			event := &model.Event{
+				Type:      t,
+				Tenant:    tenant,
+				TaskId:    task.Id,
+				Url:       task.Url,
+				AttemptId: attempt.Id,
+				CreatedAt: attempt.CreatedAt,
+			}
+
+			if Failed(attempt) {
+				event.Failures = failures + 1
+				if attempt.Assertions != nil {
+					event.Reasons = attempt.Assertions.Failures
+				}
+			}
+
+			n.pending.Add(1)
+
+			go func(w model.Webhook, provider secrets.Provider) {
+				defer n.pending.Done()
+
+				n.deliver(util.WithTenant(context.Background(), tenant), w, event, provider)
+			}(w, provider)
+		}
+	}
+}
+
+// Wait blocks until all pending deliveries finished.
+func (n *Notifier) Wait() {
+	n.pending.Wait()
+}
+
+func (n *Notifier) deliver(ctx context.Context, w model.Webhook, event *model.Event, provider secrets.Provider) {
+	d := &model.Delivery{
+		Event:     event.Type,
+		Url:       w.Url,
+		AttemptId: event.AttemptId,
+		CreatedAt: util.NowFunc().Unix(),
+	}
+
+	err := n.send(ctx, w, event, d, provider)
+	if err != nil {
+		d.Error = err.Error()
+		logging.FromContext(ctx).Warn("delivering event failed", "task_id", event.TaskId, "event", event.Type, "url", w.Url, "error", err)
+	}
+
+	err = n.storage.AddDelivery(ctx, event.TaskId, d)
+	if err != nil {
+		logging.FromContext(ctx).Error("saving delivery failed", "task_id", event.TaskId, "error", err)
+	}
+}
+
+// send posts the event until the webhook accepts it or the retries are used up.
+func (n *Notifier) send(ctx context.Context, w model.Webhook, event *model.Event, d *model.Delivery, provider secrets.Provider) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return util.Wrap(err, "event encoding failed")
+	}
+
+	var signature string
+	if w.SecretRef != "" {
+		if provider == nil {
+			return secrets.ErrSecretNotFound
+		}
+
+		secret, err := provider.Secret(w.SecretRef)
+		if err != nil {
+			return err
+		}
+
+		signature = Sign(secret, payload)
+	}
+
+	backoff := n.backoff
+
+	for {
+		d.Tries++
+
+		d.StatusCode, err = n.post(ctx, w.Url, event.Type, payload, signature)
+		if err == nil {
+			d.Delivered = true
+			return nil
+		}
+
+		if d.Tries > n.retries {
+			return err
+		}
+
+		n.sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (n *Notifier) post(ctx context.Context, rawUrl, eventType string, payload []byte, signature string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawUrl, bytes.NewReader(payload))
+	if err != nil {
+		return 0, util.Wrap(err, "creating request failed")
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, eventType)
+	if signature != "" {
+		req.Header.Set(SignatureHeader, signature)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	defer util.MustClose(resp.Body)
+
+	// drain the body so that the connection can be reused
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// Sign returns the signature header value of the payload, a hex encoded HMAC-SHA256.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,219 @@
+// +build unit !integration
+
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"crawler/pkg/model"
+	"crawler/pkg/store/memory"
+	"crawler/pkg/util"
+)
+
+type secretsMap map[string]string
+
+func (m secretsMap) Secret(name string) (string, error) {
+	return m[name], nil
+}
+
+type receiver struct {
+	mutex    sync.Mutex
+	statuses []int
+	events   []*model.Event
+	headers  []http.Header
+	payloads [][]byte
+}
+
+// handler answers with the queued status codes, then with 200.
+func (r *receiver) handler(w http.ResponseWriter, req *http.Request) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	payload, _ := ioutil.ReadAll(req.Body)
+
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+
+	if status == http.StatusOK {
+		var event model.Event
+		_ = json.Unmarshal(payload, &event)
+
+		r.events = append(r.events, &event)
+		r.headers = append(r.headers, req.Header)
+		r.payloads = append(r.payloads, payload)
+	}
+
+	w.WriteHeader(status)
+}
+
+func TestFailures(t *testing.T) {
+	failed := &model.Attempt{Outcome: model.OutcomeError}
+	success := &model.Attempt{Outcome: model.OutcomeSuccess}
+	assertionFailed := &model.Attempt{Outcome: model.OutcomeSuccess, Assertions: &model.AssertionResult{}}
+	blocked := &model.Attempt{Outcome: model.OutcomeBlocked}
+
+	assert.Equal(t, 0, Failures(nil))
+	assert.Equal(t, 0, Failures([]*model.Attempt{failed, success}))
+	assert.Equal(t, 3, Failures([]*model.Attempt{success, failed, assertionFailed, blocked, failed}))
+}
+
+func TestEvents(t *testing.T) {
+	all := []string{model.EventFetchFailed, model.EventRecovered, model.EventContentChanged, model.EventAssertionFailed}
+	previous := &model.Attempt{Outcome: model.OutcomeSuccess}
+
+	tests := []struct {
+		name     string
+		webhook  model.Webhook
+		attempt  *model.Attempt
+		previous *model.Attempt
+		failures int
+		expected []string
+	}{
+		{"first failure", model.Webhook{Events: all}, &model.Attempt{Outcome: model.OutcomeError}, previous, 0,
+			[]string{model.EventFetchFailed}},
+		{"failure below threshold", model.Webhook{Events: all, FailureThreshold: 3}, &model.Attempt{Outcome: model.OutcomeError}, previous, 1,
+			nil},
+		{"failure reaching threshold", model.Webhook{Events: all, FailureThreshold: 3}, &model.Attempt{Outcome: model.OutcomeError}, previous, 2,
+			[]string{model.EventFetchFailed}},
+		{"failure above threshold", model.Webhook{Events: all, FailureThreshold: 3}, &model.Attempt{Outcome: model.OutcomeError}, previous, 3,
+			nil},
+		{"assertion failure", model.Webhook{Events: all}, &model.Attempt{Outcome: model.OutcomeSuccess, Assertions: &model.AssertionResult{}}, previous, 0,
+			[]string{model.EventAssertionFailed}},
+		{"recovery", model.Webhook{Events: all, FailureThreshold: 2}, &model.Attempt{Outcome: model.OutcomeSuccess}, previous, 2,
+			[]string{model.EventRecovered}},
+		{"no recovery below threshold", model.Webhook{Events: all, FailureThreshold: 2}, &model.Attempt{Outcome: model.OutcomeSuccess}, previous, 1,
+			nil},
+		{"change", model.Webhook{Events: all}, &model.Attempt{Outcome: model.OutcomeSuccess, Changed: true}, previous, 0,
+			[]string{model.EventContentChanged}},
+		{"first response", model.Webhook{Events: all}, &model.Attempt{Outcome: model.OutcomeSuccess, Changed: true}, nil, 0,
+			nil},
+		{"not subscribed", model.Webhook{Events: []string{model.EventRecovered}}, &model.Attempt{Outcome: model.OutcomeError}, previous, 0,
+			nil},
+		{"blocked", model.Webhook{Events: all}, &model.Attempt{Outcome: model.OutcomeBlocked}, previous, 1,
+			nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, nilIfEmpty(events(tc.webhook, tc.attempt, tc.previous, tc.failures)))
+		})
+	}
+}
+
+func nilIfEmpty(s []string) []string {
+	if len(s) == 0 {
+		return nil
+	}
+
+	return s
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate([]model.Webhook{{Url: "https://hooks.example.com/x", Events: []string{model.EventRecovered}}}))
+
+	for _, w := range []model.Webhook{
+		{Url: "/relative", Events: []string{model.EventRecovered}},
+		{Url: "https://hooks.example.com"},
+		{Url: "https://hooks.example.com", Events: []string{"exploded"}},
+		{Url: "https://hooks.example.com", Events: []string{model.EventRecovered}, FailureThreshold: -1},
+	} {
+		assert.True(t, errors.Is(Validate([]model.Webhook{w}), util.ErrValidation))
+	}
+}
+
+func TestNotify(t *testing.T) {
+	r := &receiver{statuses: []int{http.StatusInternalServerError, http.StatusBadGateway}}
+	ts := httptest.NewServer(http.HandlerFunc(r.handler))
+	defer ts.Close()
+
+	storage := memory.NewMemory()
+	task := &model.Task{
+		Id:  1,
+		Url: "http://localhost/health",
+		Webhooks: []model.Webhook{
+			{Url: ts.URL + "/task", Events: []string{model.EventAssertionFailed}, SecretRef: "hook"},
+		},
+	}
+
+	err := storage.Create(context.Background(), task)
+	require.NoError(t, err)
+
+	var (
+		backoffs []time.Duration
+		mutex    sync.Mutex
+	)
+
+	n := NewNotifier(storage,
+		WithSecrets(secretsMap{"hook": "s3cr3t"}),
+		WithWebhooks([]model.Webhook{{Url: "http://127.0.0.1:0/global", Events: []string{model.EventAssertionFailed}}}),
+		WithRetries(2, time.Second),
+	)
+	n.sleep = func(d time.Duration) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		backoffs = append(backoffs, d)
+	}
+
+	attempt := &model.Attempt{
+		Id:         7,
+		Outcome:    model.OutcomeSuccess,
+		CreatedAt:  1000,
+		Assertions: &model.AssertionResult{Failures: []string{"status code 500 not in [200]"}},
+	}
+
+	n.Notify(context.Background(), task, attempt, nil, 0)
+	n.Wait()
+
+	// the task's webhook failed twice before it accepted the event
+	require.Len(t, r.events, 1)
+	assert.Equal(t, &model.Event{
+		Type:      model.EventAssertionFailed,
+		TaskId:    1,
+		Url:       "http://localhost/health",
+		AttemptId: 7,
+		CreatedAt: 1000,
+		Failures:  1,
+		Reasons:   []string{"status code 500 not in [200]"},
+	}, r.events[0])
+	assert.Equal(t, model.EventAssertionFailed, r.headers[0].Get(EventHeader))
+	assert.Equal(t, Sign("s3cr3t", r.payloads[0]), r.headers[0].Get(SignatureHeader))
+
+	deliveries, err := storage.ListDeliveries(context.Background(), 1)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+
+	byUrl := make(map[string]*model.Delivery)
+	for _, d := range deliveries {
+		byUrl[d.Url] = d
+	}
+
+	delivered := byUrl[ts.URL+"/task"]
+	require.NotNil(t, delivered)
+	assert.True(t, delivered.Delivered)
+	assert.Equal(t, 3, delivered.Tries)
+	assert.Equal(t, http.StatusOK, delivered.StatusCode)
+	assert.Equal(t, int64(7), delivered.AttemptId)
+
+	// the global webhook is unreachable and gives up after the retries
+	failed := byUrl["http://127.0.0.1:0/global"]
+	require.NotNil(t, failed)
+	assert.False(t, failed.Delivered)
+	assert.Equal(t, 3, failed.Tries)
+	assert.NotEmpty(t, failed.Error)
+
+	assert.ElementsMatch(t, []time.Duration{time.Second, 2 * time.Second, time.Second, 2 * time.Second}, backoffs)
+}
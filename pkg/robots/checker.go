@@ -0,0 +1,154 @@
+package robots
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"crawler/pkg/logging"
+	"crawler/pkg/util"
+)
+
+const (
+	DefaultTTL = time.Hour
+	// RetryTTL is how long the answer to a failed robots.txt fetch is kept, it is
+	// fetched again sooner than an answer of the host.
+	RetryTTL = time.Minute
+
+	fetchTimeout = time.Second * 5
+	sizeLimit    = 1024 * 512
+)
+
+type Decision struct {
+	Allowed bool
+	// Wait is set when the host's Crawl-delay did not elapse since the previous fetch.
+	Wait time.Duration
+}
+
+type entry struct {
+	rules     *Rules
+	expiresAt time.Time
+	nextFetch time.Time
+}
+
+type Checker struct {
+	agent  string
+	ttl    time.Duration
+	client *http.Client
+	now    func() time.Time
+
+	hosts map[string]*entry
+	mutex sync.Mutex
+}
+
+func NewChecker(agent string, ttl time.Duration) *Checker {
+	return &Checker{
+		agent:  agent,
+		ttl:    ttl,
+		client: http.DefaultClient,
+		now:    util.NowFunc,
+		hosts:  make(map[string]*entry),
+	}
+}
+
+// Check decides whether the url may be fetched now and, if so, reserves
+// the host's next Crawl-delay slot.
+func (c *Checker) Check(ctx context.Context, u *url.URL) Decision {
+	host := u.Scheme + "://" + u.Host
+
+	e := c.entry(ctx, host)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// rules like "Disallow: /*?session=" apply to the query as well
+	path := u.EscapedPath()
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	if !e.rules.Allowed(c.agent, path) {
+		return Decision{Allowed: false}
+	}
+
+	now := c.now()
+	if now.Before(e.nextFetch) {
+		return Decision{Allowed: true, Wait: e.nextFetch.Sub(now)}
+	}
+
+	e.nextFetch = now.Add(e.rules.CrawlDelay(c.agent))
+
+	return Decision{Allowed: true}
+}
+
+func (c *Checker) entry(ctx context.Context, host string) *entry {
+	c.mutex.Lock()
+	e, found := c.hosts[host]
+	c.mutex.Unlock()
+
+	if found && c.now().Before(e.expiresAt) {
+		return e
+	}
+
+	rules, failed := c.fetch(ctx, host)
+
+	ttl := c.ttl
+	if failed && RetryTTL < ttl {
+		ttl = RetryTTL
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if e == nil {
+		e = &entry{}
+		c.hosts[host] = e
+	}
+
+	e.rules = rules
+	e.expiresAt = c.now().Add(ttl)
+
+	return e
+}
+
+// fetch downloads robots.txt for the host. A missing file (4xx) allows everything,
+// a server error disallows everything, and an unreachable host is treated as having
+// no robots.txt so that the fetch itself reports the error. It reports whether the
+// fetch failed, so that the answer is not kept as long as one of the host.
+func (c *Checker) fetch(ctx context.Context, host string) (*Rules, bool) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, host+"/robots.txt", nil)
+	if err != nil {
+		logging.FromContext(ctx).Warn("creating robots.txt request failed", "host", host, "error", err)
+		return AllowAll(), true
+	}
+
+	req.Header.Set("User-Agent", c.agent)
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		logging.FromContext(ctx).Warn("fetching robots.txt failed", "host", host, "error", err)
+		return AllowAll(), true
+	}
+	defer util.MustClose(res.Body)
+
+	switch {
+	case res.StatusCode >= http.StatusInternalServerError:
+		return DisallowAll(), true
+	case res.StatusCode >= http.StatusBadRequest:
+		return AllowAll(), false
+	}
+
+	rules, err := Parse(io.LimitReader(res.Body, sizeLimit))
+	if err != nil {
+		logging.FromContext(ctx).Warn("parsing robots.txt failed", "host", host, "error", err)
+		return AllowAll(), true
+	}
+
+	return rules, false
+}
@@ -0,0 +1,201 @@
+package robots
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const wildcardAgent = "*"
+
+type rule struct {
+	allow   bool
+	pattern string
+}
+
+type group struct {
+	agents     []string
+	rules      []rule
+	crawlDelay time.Duration
+}
+
+type Rules struct {
+	groups []*group
+}
+
+func AllowAll() *Rules {
+	return &Rules{}
+}
+
+func DisallowAll() *Rules {
+	return &Rules{
+		groups: []*group{{
+			agents: []string{wildcardAgent},
+			rules:  []rule{{allow: false, pattern: "/"}},
+		}},
+	}
+}
+
+func Parse(r io.Reader) (*Rules, error) {
+	rules := &Rules{}
+
+	var current *group
+	inAgents := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			continue
+		}
+
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+
+		if key == "user-agent" {
+			if !inAgents {
+				current = &group{}
+				rules.groups = append(rules.groups, current)
+				inAgents = true
+			}
+
+			current.agents = append(current.agents, productToken(value))
+			continue
+		}
+
+		inAgents = false
+		if current == nil {
+			continue
+		}
+
+		switch key {
+		case "allow", "disallow":
+			// an empty disallow means "allow everything" and adds no rule
+			if value == "" {
+				continue
+			}
+
+			current.rules = append(current.rules, rule{allow: key == "allow", pattern: value})
+		case "crawl-delay":
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil || seconds < 0 {
+				continue
+			}
+
+			current.crawlDelay = time.Duration(seconds * float64(time.Second))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// productToken returns the lower case name of a user agent like "crawler/1.0",
+// groups apply to the agents whose name is their user-agent line (RFC 9309).
+func productToken(agent string) string {
+	if i := strings.IndexAny(agent, "/ "); i >= 0 {
+		agent = agent[:i]
+	}
+
+	return strings.ToLower(agent)
+}
+
+// group picks the first group naming the agent, falling back to the wildcard group.
+func (r *Rules) group(agent string) *group {
+	token := productToken(agent)
+
+	var wildcard *group
+
+	for _, g := range r.groups {
+		for _, a := range g.agents {
+			switch {
+			case a == token:
+				return g
+			case a == wildcardAgent && wildcard == nil:
+				wildcard = g
+			}
+		}
+	}
+
+	return wildcard
+}
+
+// Allowed tells whether the agent may fetch the path, which includes the query if there is one.
+func (r *Rules) Allowed(agent, path string) bool {
+	g := r.group(agent)
+	if g == nil {
+		return true
+	}
+
+	if path == "" {
+		path = "/"
+	}
+
+	allowed := true
+	matchLength := -1
+
+	for _, rl := range g.rules {
+		if !match(rl.pattern, path) {
+			continue
+		}
+
+		// the most specific rule wins, allow wins over disallow of the same length
+		if len(rl.pattern) > matchLength || (len(rl.pattern) == matchLength && rl.allow) {
+			allowed = rl.allow
+			matchLength = len(rl.pattern)
+		}
+	}
+
+	return allowed
+}
+
+func (r *Rules) CrawlDelay(agent string) time.Duration {
+	g := r.group(agent)
+	if g == nil {
+		return 0
+	}
+
+	return g.crawlDelay
+}
+
+// match reports whether the path matches the robots.txt pattern, supporting
+// the '*' wildcard and the '$' end anchor.
+func match(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = strings.TrimSuffix(pattern, "$")
+	}
+
+	parts := strings.Split(pattern, "*")
+
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+
+	rest := path[len(parts[0]):]
+
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(rest, part)
+		}
+
+		j := strings.Index(rest, part)
+		if j < 0 {
+			return false
+		}
+
+		rest = rest[j+len(part):]
+	}
+
+	return !anchored || rest == ""
+}
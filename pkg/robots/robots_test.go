@@ -0,0 +1,148 @@
+// +build unit !integration
+
+package robots
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const robotsTxt = `
+# comment
+User-agent: *
+Disallow: /private
+Allow: /private/public
+Disallow: /*.pdf$
+Disallow: /*?session=
+
+User-agent: bot
+Disallow: /bot-only
+
+User-agent: crawler
+User-agent: other
+Disallow: /crawler-only
+Disallow: /*?session=
+Crawl-delay: 2
+`
+
+func TestAllowed(t *testing.T) {
+	rules, err := Parse(strings.NewReader(robotsTxt))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		agent    string
+		path     string
+		expected bool
+	}{
+		{name: "root", agent: "anybody", path: "/", expected: true},
+		{name: "disallowed prefix", agent: "anybody", path: "/private/data", expected: false},
+		{name: "longer allow wins", agent: "anybody", path: "/private/public/index.html", expected: true},
+		{name: "wildcard with anchor", agent: "anybody", path: "/docs/file.pdf", expected: false},
+		{name: "anchor not matching", agent: "anybody", path: "/docs/file.pdf.html", expected: true},
+		{name: "specific group", agent: "Crawler/1.0", path: "/crawler-only", expected: false},
+		{name: "specific group ignores wildcard group", agent: "Crawler/1.0", path: "/private", expected: true},
+		{name: "group of another agent", agent: "crawlerbot/1.0", path: "/bot-only", expected: true},
+		{name: "agent containing a group's name", agent: "Another/2.0", path: "/private", expected: false},
+		{name: "query", agent: "anybody", path: "/page?session=1", expected: false},
+		{name: "other query", agent: "anybody", path: "/page?id=1", expected: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, rules.Allowed(tc.agent, tc.path))
+		})
+	}
+
+	assert.Equal(t, 2*time.Second, rules.CrawlDelay("crawler/1.0"))
+	assert.Equal(t, time.Duration(0), rules.CrawlDelay("anybody"))
+}
+
+func TestChecker(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte(robotsTxt))
+	}))
+	defer ts.Close()
+
+	now := time.Unix(1000, 0)
+
+	checker := NewChecker("crawler/1.0", time.Minute)
+	checker.now = func() time.Time { return now }
+
+	allowed, err := url.Parse(ts.URL + "/page")
+	require.NoError(t, err)
+
+	disallowed, err := url.Parse(ts.URL + "/crawler-only/page")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	assert.Equal(t, Decision{Allowed: true}, checker.Check(ctx, allowed))
+	assert.Equal(t, Decision{Allowed: false}, checker.Check(ctx, disallowed))
+	assert.Equal(t, Decision{Allowed: true, Wait: 2 * time.Second}, checker.Check(ctx, allowed))
+
+	now = now.Add(2 * time.Second)
+	assert.Equal(t, Decision{Allowed: true}, checker.Check(ctx, allowed))
+	assert.Equal(t, 1, requests)
+
+	now = now.Add(time.Minute)
+	checker.Check(ctx, allowed)
+	assert.Equal(t, 2, requests)
+
+	withQuery, err := url.Parse(ts.URL + "/page?session=abc")
+	require.NoError(t, err)
+	assert.Equal(t, Decision{Allowed: false}, checker.Check(ctx, withQuery))
+}
+
+func TestCheckerFailures(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	requests := 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	now := time.Unix(1000, 0)
+
+	checker := NewChecker("crawler/1.0", DefaultTTL)
+	checker.now = func() time.Time { return now }
+
+	page, err := url.Parse(ts.URL + "/page")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	// a server error disallows fetching only until robots.txt is fetched again shortly after
+	assert.False(t, checker.Check(ctx, page).Allowed)
+
+	status = http.StatusNotFound
+	now = now.Add(RetryTTL)
+	assert.True(t, checker.Check(ctx, page).Allowed)
+	assert.Equal(t, 2, requests)
+
+	// a missing robots.txt is an answer of the host and kept for the full TTL
+	now = now.Add(RetryTTL)
+	checker.Check(ctx, page)
+	assert.Equal(t, 2, requests)
+
+	// an unreachable host is asked again shortly after as well
+	ts.Close()
+
+	unreachable := NewChecker("crawler/1.0", DefaultTTL)
+	unreachable.now = checker.now
+
+	assert.True(t, unreachable.Check(ctx, page).Allowed)
+	assert.True(t, unreachable.hosts[page.Scheme+"://"+page.Host].expiresAt.Equal(now.Add(RetryTTL)))
+}
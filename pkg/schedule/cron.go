@@ -0,0 +1,212 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// searchLimit bounds the search for the next match of expressions like "0 0 30 2 *" which never match.
+const searchLimit = 5
+
+var (
+	errCron = errors.New("invalid cron expression")
+
+	macros = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@hourly":   "0 * * * *",
+	}
+
+	monthNames = map[string]int{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}
+
+	dayNames = map[string]int{
+		"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+	}
+)
+
+type field struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minutes     = field{0, 59, nil}
+	hours       = field{0, 23, nil}
+	daysOfMonth = field{1, 31, nil}
+	months      = field{1, 12, monthNames}
+	// 7 is accepted for Sunday as well
+	daysOfWeek = field{0, 7, dayNames}
+)
+
+// Cron is a parsed five field cron expression: minute hour day-of-month month day-of-week.
+// Every field is a bit set of the values it matches.
+type Cron struct {
+	minute, hour, dom, month, dow uint64
+	// when both day fields are restricted a day matching either of them matches
+	domStar, dowStar bool
+}
+
+func ParseCron(expr string) (*Cron, error) {
+	if macro, ok := macros[strings.ToLower(strings.TrimSpace(expr))]; ok {
+		expr = macro
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: expected 5 fields, got %d", errCron, len(fields))
+	}
+
+	c := &Cron{
+		domStar: fields[2] == "*" || fields[2] == "?",
+		dowStar: fields[4] == "*" || fields[4] == "?",
+	}
+
+	var err error
+
+	for i, target := range []struct {
+		bits *uint64
+		f    field
+	}{
+		{&c.minute, minutes},
+		{&c.hour, hours},
+		{&c.dom, daysOfMonth},
+		{&c.month, months},
+		{&c.dow, daysOfWeek},
+	} {
+		*target.bits, err = parseField(fields[i], target.f)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+
+	return c, nil
+}
+
+// parseField parses a comma separated list of *, values and ranges, each with an optional /step.
+func parseField(s string, f field) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(s, ",") {
+		rng, step := part, 1
+
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			var err error
+
+			rng = part[:i]
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("%w: invalid step in '%s'", errCron, part)
+			}
+		}
+
+		var from, to int
+
+		switch {
+		case rng == "*" || rng == "?":
+			from, to = f.min, f.max
+		case strings.Contains(rng, "-"):
+			bounds := strings.SplitN(rng, "-", 2)
+
+			var err error
+
+			from, err = parseValue(bounds[0], f)
+			if err != nil {
+				return 0, err
+			}
+
+			to, err = parseValue(bounds[1], f)
+			if err != nil {
+				return 0, err
+			}
+
+			if from > to {
+				return 0, fmt.Errorf("%w: invalid range '%s'", errCron, rng)
+			}
+		default:
+			var err error
+
+			from, err = parseValue(rng, f)
+			if err != nil {
+				return 0, err
+			}
+
+			// "5/15" means every 15 starting at 5
+			to = from
+			if step > 1 {
+				to = f.max
+			}
+		}
+
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+func parseValue(s string, f field) (int, error) {
+	if v, ok := f.names[strings.ToUpper(s)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%w: invalid value '%s'", errCron, s)
+	}
+
+	return v, nil
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+
+	return dom || dow
+}
+
+// Next returns the first matching minute after t in t's location, the zero time
+// when the expression does not match within the next years.
+func (c *Cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+
+	// the start of the next minute, computed on the absolute time to move
+	// forward through daylight saving changes
+	t = t.Add(time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	limit := t.AddDate(searchLimit, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Add(time.Hour - time.Duration(t.Minute())*time.Minute)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
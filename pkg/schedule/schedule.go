@@ -0,0 +1,281 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"crawler/pkg/model"
+	"crawler/pkg/util"
+)
+
+const (
+	clockLayout = "15:04"
+	day         = time.Hour * 24
+
+	// maxSkips bounds moving the next run out of blackout windows
+	maxSkips = 1000
+
+	// cron jitter must not delay a run past the next minute it could match
+	maxCronJitter = time.Minute
+
+	// cronGrace is how late a missed cron run may still start
+	cronGrace = time.Minute
+)
+
+// ErrNoInterval tells that a schedule without cron has no positive interval, it would run continuously.
+var ErrNoInterval = util.Wrap(util.ErrValidation, "interval or interval_ms must be positive without a cron schedule")
+
+// window is either an absolute period or a daily one given as offsets from midnight.
+type window struct {
+	start, end time.Time
+	daily      bool
+	from, to   time.Duration
+}
+
+// Schedule tells when a task runs next.
+type Schedule struct {
+	cron      *Cron
+	interval  time.Duration
+	jitter    time.Duration
+	seed      int
+	location  *time.Location
+	start     time.Time
+	end       time.Time
+	blackouts []window
+}
+
+func New(task *model.Task) (*Schedule, error) {
+	s := &Schedule{
+		interval: time.Duration(task.Interval) * time.Second,
+		jitter:   time.Duration(task.JitterMs) * time.Millisecond,
+		seed:     task.Id,
+		location: time.UTC,
+	}
+
+	if task.IntervalMs > 0 {
+		s.interval = time.Duration(task.IntervalMs) * time.Millisecond
+	}
+
+	if task.IntervalMs < 0 || task.JitterMs < 0 {
+		return nil, util.Wrap(util.ErrValidation, "interval_ms and jitter_ms must not be negative")
+	}
+
+	spec := task.Schedule
+	if spec == nil {
+		spec = &model.Schedule{}
+	}
+
+	var err error
+
+	if spec.Cron != "" {
+		s.cron, err = ParseCron(spec.Cron)
+		if err != nil {
+			return nil, util.Wrap(util.ErrValidation, err.Error())
+		}
+	}
+
+	if s.cron == nil && s.interval <= 0 {
+		return nil, ErrNoInterval
+	}
+
+	if s.cron == nil && s.jitter > 0 && s.jitter > s.interval {
+		return nil, util.Wrap(util.ErrValidation, "jitter_ms must not exceed the interval")
+	}
+
+	if s.cron != nil && s.jitter >= maxCronJitter {
+		return nil, util.Wrap(util.ErrValidation, "jitter_ms of cron schedules must be below a minute")
+	}
+
+	if spec.TimeZone != "" {
+		s.location, err = time.LoadLocation(spec.TimeZone)
+		if err != nil {
+			return nil, util.Wrap(util.ErrValidation, "unknown time zone")
+		}
+	}
+
+	// expressions like "0 0 30 2 *" would never run the task
+	if s.cron != nil && s.cron.Next(time.Now().In(s.location)).IsZero() {
+		return nil, util.Wrap(util.ErrValidation, "cron expression never matches")
+	}
+
+	s.start, err = parseTime(spec.Start)
+	if err != nil {
+		return nil, util.Wrap(util.ErrValidation, "schedule start must be a RFC 3339 timestamp")
+	}
+
+	s.end, err = parseTime(spec.End)
+	if err != nil {
+		return nil, util.Wrap(util.ErrValidation, "schedule end must be a RFC 3339 timestamp")
+	}
+
+	if !s.start.IsZero() && !s.end.IsZero() && !s.end.After(s.start) {
+		return nil, util.Wrap(util.ErrValidation, "schedule end must be after its start")
+	}
+
+	for _, b := range spec.Blackouts {
+		w, err := parseWindow(b)
+		if err != nil {
+			return nil, util.Wrap(util.ErrValidation, fmt.Sprintf("invalid blackout window: %s", err))
+		}
+
+		s.blackouts = append(s.blackouts, w)
+	}
+
+	return s, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
+
+func parseWindow(w model.Window) (window, error) {
+	// clock times have no date part
+	if !strings.Contains(w.Start, "T") {
+		from, err := time.Parse(clockLayout, w.Start)
+		if err != nil {
+			return window{}, err
+		}
+
+		to, err := time.Parse(clockLayout, w.End)
+		if err != nil {
+			return window{}, err
+		}
+
+		return window{
+			daily: true,
+			from:  time.Duration(from.Hour())*time.Hour + time.Duration(from.Minute())*time.Minute,
+			to:    time.Duration(to.Hour())*time.Hour + time.Duration(to.Minute())*time.Minute,
+		}, nil
+	}
+
+	start, err := time.Parse(time.RFC3339, w.Start)
+	if err != nil {
+		return window{}, err
+	}
+
+	end, err := time.Parse(time.RFC3339, w.End)
+	if err != nil {
+		return window{}, err
+	}
+
+	if !end.After(start) {
+		return window{}, errors.New("end before start")
+	}
+
+	return window{start: start, end: end}, nil
+}
+
+// blackoutEnd returns the end of the blackout window t falls into, the zero time if there is none.
+func (s *Schedule) blackoutEnd(t time.Time) time.Time {
+	for _, w := range s.blackouts {
+		if !w.daily {
+			if !t.Before(w.start) && t.Before(w.end) {
+				return w.end
+			}
+
+			continue
+		}
+
+		local := t.In(s.location)
+		midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, s.location)
+		offset := local.Sub(midnight)
+
+		switch {
+		case w.from <= w.to && offset >= w.from && offset < w.to:
+			return midnight.Add(w.to)
+		// windows like 22:00-06:00 wrap around midnight
+		case w.from > w.to && offset >= w.from:
+			return midnight.Add(day + w.to)
+		case w.from > w.to && offset < w.to:
+			return midnight.Add(w.to)
+		}
+	}
+
+	return time.Time{}
+}
+
+// jitterAt returns a pseudo random duration in [0, jitter) derived from the task and t,
+// so that a run gets the same jitter however often it is planned.
+func (s *Schedule) jitterAt(t time.Time) time.Duration {
+	if s.jitter <= 0 {
+		return 0
+	}
+
+	h := fnv.New64a()
+	_, _ = fmt.Fprintf(h, "%d:%d", s.seed, t.UnixNano())
+
+	return time.Duration(h.Sum64() % uint64(s.jitter))
+}
+
+// after returns the first run time at or after t.
+func (s *Schedule) after(t time.Time) time.Time {
+	if s.cron == nil {
+		return t
+	}
+
+	return s.cron.Next(t.In(s.location).Add(-time.Nanosecond))
+}
+
+// Next returns when the task runs after the run planned at last, or after now when
+// it has no attempts. It is the zero time when the task does not run anymore.
+func (s *Schedule) Next(last time.Time, now time.Time) time.Time {
+	var next time.Time
+
+	switch {
+	case s.cron != nil && last.IsZero():
+		// a new task runs in the current minute if that matches
+		next = s.after(now.Truncate(time.Minute))
+		if !next.IsZero() {
+			next = next.Add(s.jitterAt(next))
+		}
+	case s.cron != nil:
+		// runs missed while the service was down are skipped, except one within the last minute
+		from := last
+		if grace := now.Add(-cronGrace); from.Before(grace) {
+			from = grace
+		}
+
+		next = s.cron.Next(from.In(s.location))
+		if !next.IsZero() {
+			next = next.Add(s.jitterAt(next))
+		}
+	case last.IsZero():
+		// spreads tasks created at the same time
+		next = now.Add(s.jitterAt(time.Time{}))
+	default:
+		// the jitter is centered on the interval, so the average rate stays the same
+		next = last.Add(s.interval - s.jitter/2 + s.jitterAt(last))
+
+		// runs missed by more than an interval, i.e. while the service was down, are skipped
+		if now.Sub(next) > s.interval {
+			next = now
+		}
+	}
+
+	for i := 0; i < maxSkips && !next.IsZero(); i++ {
+		if !s.start.IsZero() && next.Before(s.start) {
+			next = s.after(s.start)
+			continue
+		}
+
+		if !s.end.IsZero() && next.After(s.end) {
+			return time.Time{}
+		}
+
+		end := s.blackoutEnd(next)
+		if end.IsZero() {
+			return next
+		}
+
+		next = s.after(end)
+	}
+
+	return time.Time{}
+}
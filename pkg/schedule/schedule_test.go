@@ -0,0 +1,188 @@
+// +build unit !integration
+
+package schedule
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"crawler/pkg/model"
+	"crawler/pkg/util"
+)
+
+func mustTime(t *testing.T, s string) time.Time {
+	v, err := time.Parse(time.RFC3339, s)
+	require.NoError(t, err)
+
+	return v
+}
+
+func TestCronNext(t *testing.T) {
+	tests := []struct {
+		expr     string
+		after    string
+		expected string
+	}{
+		{"*/5 9-17 * * MON-FRI", "2026-10-16T09:02:00Z", "2026-10-16T09:05:00Z"},
+		{"*/5 9-17 * * MON-FRI", "2026-10-16T17:55:00Z", "2026-10-19T09:00:00Z"},
+		{"0 0 1 * *", "2026-10-16T12:00:00Z", "2026-11-01T00:00:00Z"},
+		{"30 4 1,15 * 5", "2026-10-02T00:00:00Z", "2026-10-02T04:30:00Z"},
+		{"@hourly", "2026-10-16T12:00:00Z", "2026-10-16T13:00:00Z"},
+		{"15/20 * * * *", "2026-10-16T12:40:00Z", "2026-10-16T12:55:00Z"},
+		{"0 12 * * 7", "2026-10-16T12:00:00Z", "2026-10-18T12:00:00Z"},
+		{"0 0 29 2 *", "2026-03-01T00:00:00Z", "2028-02-29T00:00:00Z"},
+		{"0 0 30 2 *", "2026-03-01T00:00:00Z", "0001-01-01T00:00:00Z"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.expr, func(t *testing.T) {
+			c, err := ParseCron(tc.expr)
+			require.NoError(t, err)
+
+			assert.Equal(t, mustTime(t, tc.expected).UTC(), c.Next(mustTime(t, tc.after)).UTC())
+		})
+	}
+}
+
+func TestCronNextDaylightSaving(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	c, err := ParseCron("30 2 * * *")
+	require.NoError(t, err)
+
+	// 02:30 does not exist on the day clocks jump from 02:00 to 03:00
+	next := c.Next(time.Date(2026, 3, 28, 12, 0, 0, 0, loc))
+	assert.Equal(t, time.Date(2026, 3, 30, 2, 30, 0, 0, loc), next)
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * * FOO *", "5-1 * * * *", "*/0 * * * *", "a * * * *"} {
+		_, err := ParseCron(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestNext(t *testing.T) {
+	now := mustTime(t, "2026-10-16T10:00:30Z")
+
+	tests := []struct {
+		name     string
+		task     *model.Task
+		last     string
+		expected string
+	}{
+		{"interval without attempts", &model.Task{Interval: 60}, "", "2026-10-16T10:00:30Z"},
+		{"interval", &model.Task{Interval: 60}, "2026-10-16T09:59:50Z", "2026-10-16T10:00:50Z"},
+		{"milliseconds", &model.Task{Interval: 60, IntervalMs: 250}, "2026-10-16T10:00:30Z", "2026-10-16T10:00:30.25Z"},
+		{"missed runs", &model.Task{Interval: 60}, "2026-10-16T09:00:00Z", "2026-10-16T10:00:30Z"},
+		{"cron matching the current minute", &model.Task{Schedule: &model.Schedule{Cron: "0 10 * * *"}}, "", "2026-10-16T10:00:00Z"},
+		{"cron", &model.Task{Schedule: &model.Schedule{Cron: "0 10 * * *"}}, "2026-10-16T10:00:02Z", "2026-10-17T10:00:00Z"},
+		{"missed cron runs", &model.Task{Schedule: &model.Schedule{Cron: "*/15 * * * *"}}, "2026-10-15T10:00:00Z", "2026-10-16T10:00:00Z"},
+		{"long missed cron runs", &model.Task{Schedule: &model.Schedule{Cron: "0 8 * * *"}}, "2026-10-10T08:00:00Z", "2026-10-17T08:00:00Z"},
+		{"time zone", &model.Task{Schedule: &model.Schedule{Cron: "0 10 * * *", TimeZone: "America/New_York"}}, "2026-10-16T10:00:02Z", "2026-10-16T14:00:00Z"},
+		{"start", &model.Task{Interval: 60, Schedule: &model.Schedule{Start: "2026-11-01T00:00:00Z"}}, "", "2026-11-01T00:00:00Z"},
+		{"cron after start", &model.Task{Schedule: &model.Schedule{Cron: "0 10 * * *", Start: "2026-11-01T12:00:00Z"}}, "", "2026-11-02T10:00:00Z"},
+		{"end", &model.Task{Interval: 60, Schedule: &model.Schedule{End: "2026-10-16T10:00:00Z"}}, "2026-10-16T09:59:50Z", "0001-01-01T00:00:00Z"},
+		{"blackout", &model.Task{Interval: 60, Schedule: &model.Schedule{
+			Blackouts: []model.Window{{Start: "2026-10-16T10:00:00Z", End: "2026-10-16T11:00:00Z"}},
+		}}, "2026-10-16T09:59:50Z", "2026-10-16T11:00:00Z"},
+		{"daily blackout", &model.Task{Schedule: &model.Schedule{
+			Cron:      "*/15 * * * *",
+			Blackouts: []model.Window{{Start: "10:00", End: "10:30"}},
+		}}, "2026-10-16T09:50:00Z", "2026-10-16T10:30:00Z"},
+		{"daily blackout around midnight", &model.Task{Schedule: &model.Schedule{
+			Cron:      "0 * * * *",
+			TimeZone:  "Europe/Berlin",
+			Blackouts: []model.Window{{Start: "22:00", End: "06:00"}},
+		}}, "2026-10-16T19:30:00Z", "2026-10-17T04:00:00Z"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := New(tc.task)
+			require.NoError(t, err)
+
+			var last time.Time
+			if tc.last != "" {
+				last = mustTime(t, tc.last)
+			}
+
+			assert.Equal(t, mustTime(t, tc.expected).UTC(), s.Next(last, now).UTC())
+		})
+	}
+}
+
+func TestJitter(t *testing.T) {
+	last := mustTime(t, "2026-10-16T10:00:00Z")
+	now := last
+
+	s, err := New(&model.Task{Id: 1, IntervalMs: 1000, JitterMs: 400})
+	require.NoError(t, err)
+
+	// the same run is always planned at the same time
+	assert.Equal(t, s.Next(last, now), s.Next(last, now.Add(time.Second)))
+
+	var total time.Duration
+
+	for i := 0; i < 1000; i++ {
+		next := s.Next(last, now)
+		interval := next.Sub(last)
+
+		assert.True(t, interval >= 800*time.Millisecond && interval < 1200*time.Millisecond, interval)
+
+		total += interval
+		last = next
+		now = next
+	}
+
+	// the average interval is kept
+	assert.InDelta(t, float64(time.Second), float64(total/1000), float64(20*time.Millisecond))
+
+	// tasks created at the same time are spread
+	first, err := New(&model.Task{Id: 1, Interval: 10, JitterMs: 10000})
+	require.NoError(t, err)
+
+	second, err := New(&model.Task{Id: 2, Interval: 10, JitterMs: 10000})
+	require.NoError(t, err)
+
+	assert.NotEqual(t, first.Next(time.Time{}, now), second.Next(time.Time{}, now))
+
+	// jitter does not turn a cron which never matches into a run
+	c, err := ParseCron("0 0 30 2 *")
+	require.NoError(t, err)
+
+	never := &Schedule{cron: c, jitter: time.Second * 30, seed: 1, location: time.UTC}
+	assert.True(t, never.Next(time.Time{}, now).IsZero())
+	assert.True(t, never.Next(last, now).IsZero())
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, task := range []*model.Task{
+		{},
+		{Interval: -5},
+		{IntervalMs: -1},
+		{Interval: 1, JitterMs: 2000},
+		{JitterMs: 60000, Schedule: &model.Schedule{Cron: "* * * * *"}},
+		{Schedule: &model.Schedule{Cron: "0 0 30 2 *"}},
+	} {
+		_, err := New(task)
+		assert.True(t, errors.Is(err, util.ErrValidation))
+	}
+
+	for _, spec := range []*model.Schedule{
+		{Cron: "* * *"},
+		{TimeZone: "Mars/Olympus"},
+		{Start: "tomorrow"},
+		{Start: "2026-11-01T00:00:00Z", End: "2026-10-01T00:00:00Z"},
+		{Blackouts: []model.Window{{Start: "25:00", End: "26:00"}}},
+		{Blackouts: []model.Window{{Start: "2026-11-01T00:00:00Z", End: "2026-10-01T00:00:00Z"}}},
+	} {
+		_, err := New(&model.Task{Interval: 60, Schedule: spec})
+		assert.True(t, errors.Is(err, util.ErrValidation))
+	}
+}
@@ -0,0 +1,130 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrSecretNotFound = errors.New("secret not found")
+
+type Provider interface {
+	Secret(name string) (string, error)
+}
+
+// scoper is implemented by providers which can keep secrets in separate namespaces.
+type scoper interface {
+	scope(namespace string) (Provider, error)
+}
+
+// Scope returns the provider of a namespace's secrets, i.e. a tenant's. Names resolved
+// through it cannot reach secrets outside the namespace and names resolved through p
+// cannot reach into it. The empty namespace is p itself, providers without namespaces
+// resolve no secrets in others.
+func Scope(p Provider, namespace string) Provider {
+	if namespace == "" {
+		return p
+	}
+
+	s, ok := p.(scoper)
+	if !ok {
+		return none{}
+	}
+
+	scoped, err := s.scope(namespace)
+	if err != nil {
+		return none{}
+	}
+
+	return scoped
+}
+
+// none resolves no secrets.
+type none struct{}
+
+func (none) Secret(name string) (string, error) {
+	return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+}
+
+// Env resolves secrets from environment variables, the secret name is upper-cased,
+// dashes and dots become underscores and the prefix is prepended. The secrets of a
+// namespace have the namespace and a double underscore prepended, so names must not
+// contain double underscores or start or end with one.
+type Env struct {
+	prefix string
+}
+
+func NewEnv(prefix string) *Env {
+	return &Env{prefix: prefix}
+}
+
+func envKey(name string) (string, bool) {
+	key := strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+
+	return key, key != "" && !strings.Contains(key, "__") && !strings.HasPrefix(key, "_") && !strings.HasSuffix(key, "_")
+}
+
+func (e *Env) scope(namespace string) (Provider, error) {
+	key, ok := envKey(namespace)
+	if !ok {
+		return nil, fmt.Errorf("invalid namespace '%s'", namespace)
+	}
+
+	return &Env{prefix: e.prefix + key + "__"}, nil
+}
+
+func (e *Env) Secret(name string) (string, error) {
+	key, ok := envKey(name)
+	if !ok {
+		return "", fmt.Errorf("%w: invalid name '%s'", ErrSecretNotFound, name)
+	}
+
+	key = e.prefix + key
+
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+
+	return value, nil
+}
+
+// Dir resolves secrets from files named after the secret, i.e. mounted kubernetes secrets.
+// The secrets of a namespace are in the directory tenants/<namespace>.
+type Dir struct {
+	dir string
+}
+
+func NewDir(dir string) *Dir {
+	return &Dir{dir: dir}
+}
+
+func validFileName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, `/\`) && name != "." && name != ".."
+}
+
+func (d *Dir) scope(namespace string) (Provider, error) {
+	if !validFileName(namespace) {
+		return nil, fmt.Errorf("invalid namespace '%s'", namespace)
+	}
+
+	return &Dir{dir: filepath.Join(d.dir, "tenants", namespace)}, nil
+}
+
+func (d *Dir) Secret(name string) (string, error) {
+	if !validFileName(name) {
+		return "", fmt.Errorf("%w: invalid name '%s'", ErrSecretNotFound, name)
+	}
+
+	value, err := ioutil.ReadFile(filepath.Join(d.dir, name))
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	} else if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(value), "\r\n"), nil
+}
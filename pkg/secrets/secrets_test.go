@@ -0,0 +1,51 @@
+// +build unit !integration
+
+package secrets
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvScope(t *testing.T) {
+	for k, v := range map[string]string{
+		"TEST_SECRET_TOKEN":           "default",
+		"TEST_SECRET_ACME__TOKEN":     "acme",
+		"TEST_SECRET_ACME__API_TOKEN": "acme api",
+	} {
+		require.NoError(t, os.Setenv(k, v))
+		defer func(k string) { _ = os.Unsetenv(k) }(k)
+	}
+
+	env := NewEnv("TEST_SECRET_")
+
+	value, err := env.Secret("token")
+	require.NoError(t, err)
+	assert.Equal(t, "default", value)
+
+	acme := Scope(env, "acme")
+
+	value, err = acme.Secret("token")
+	require.NoError(t, err)
+	assert.Equal(t, "acme", value)
+
+	value, err = acme.Secret("api-token")
+	require.NoError(t, err)
+	assert.Equal(t, "acme api", value)
+
+	// names cannot reach across namespaces
+	for _, name := range []string{"acme--token", "acme__token", "_token", "token_"} {
+		_, err = env.Secret(name)
+		assert.True(t, errors.Is(err, ErrSecretNotFound), name)
+	}
+
+	_, err = Scope(env, "globex").Secret("token")
+	assert.True(t, errors.Is(err, ErrSecretNotFound))
+
+	_, err = Scope(env, "ac__me").Secret("token")
+	assert.True(t, errors.Is(err, ErrSecretNotFound))
+}
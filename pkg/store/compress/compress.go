@@ -0,0 +1,67 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"crawler/pkg/util"
+)
+
+const (
+	None = ""
+	Gzip = "gzip"
+
+	DefaultThreshold = 1024
+)
+
+// Codec compresses bodies of at least Threshold bytes, a zero Threshold disables compression.
+type Codec struct {
+	Threshold int
+}
+
+// Encode returns the data to store together with its encoding. Bodies which
+// do not shrink are stored verbatim.
+func (c Codec) Encode(body string) (string, string) {
+	if c.Threshold <= 0 || len(body) < c.Threshold {
+		return body, None
+	}
+
+	var buf bytes.Buffer
+
+	w := gzip.NewWriter(&buf)
+
+	_, err := w.Write([]byte(body))
+	if err == nil {
+		err = w.Close()
+	}
+
+	if err != nil || buf.Len() >= len(body) {
+		return body, None
+	}
+
+	return buf.String(), Gzip
+}
+
+func Decode(data, encoding string) (string, error) {
+	switch encoding {
+	case None:
+		return data, nil
+	case Gzip:
+		r, err := gzip.NewReader(strings.NewReader(data))
+		if err != nil {
+			return "", util.Wrap(err, "opening gzip stream failed")
+		}
+
+		body, err := ioutil.ReadAll(r)
+		if err != nil {
+			return "", util.Wrap(err, "decompressing body failed")
+		}
+
+		return string(body), nil
+	default:
+		return "", fmt.Errorf("unknown encoding '%s'", encoding)
+	}
+}
@@ -0,0 +1,39 @@
+// +build unit !integration
+
+package compress
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodec(t *testing.T) {
+	tests := []struct {
+		name             string
+		threshold        int
+		body             string
+		expectedEncoding string
+	}{
+		{name: "disabled", threshold: 0, body: strings.Repeat("a", 2048), expectedEncoding: None},
+		{name: "below threshold", threshold: 1024, body: strings.Repeat("a", 100), expectedEncoding: None},
+		{name: "compressed", threshold: 1024, body: strings.Repeat("a", 2048), expectedEncoding: Gzip},
+		{name: "incompressible", threshold: 1, body: "ab", expectedEncoding: None},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			data, encoding := Codec{Threshold: tc.threshold}.Encode(tc.body)
+			assert.Equal(t, tc.expectedEncoding, encoding)
+
+			body, err := Decode(data, encoding)
+			require.NoError(t, err)
+			assert.Equal(t, tc.body, body)
+		})
+	}
+
+	_, err := Decode("data", "zstd")
+	assert.Error(t, err)
+}
@@ -0,0 +1,52 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+
+	"crawler/pkg/model"
+	"crawler/pkg/util"
+)
+
+// audit entries are kept encoded so that the stored tasks cannot be changed through them
+
+func (m *Memory) AddAuditEntry(ctx context.Context, e *model.AuditEntry) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sp := m.space(ctx)
+	e.Id = int64(len(sp.audit) + 1)
+
+	encoded, err := json.Marshal(e)
+	if err != nil {
+		return util.Wrap(err, "audit entry encoding failed")
+	}
+
+	sp.audit = append(sp.audit, encoded)
+
+	return nil
+}
+
+func (m *Memory) ListAuditEntries(ctx context.Context, q *model.AuditQuery) ([]*model.AuditEntry, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sp := m.space(ctx)
+
+	var entries []*model.AuditEntry
+
+	for i := len(sp.audit) - 1; i >= 0 && (q.Limit == 0 || len(entries) < q.Limit); i-- {
+		var e model.AuditEntry
+
+		err := json.Unmarshal(sp.audit[i], &e)
+		if err != nil {
+			return nil, util.Wrap(err, "audit entry conversion failed")
+		}
+
+		if q.Matches(&e) {
+			entries = append(entries, &e)
+		}
+	}
+
+	return entries, nil
+}
@@ -2,46 +2,338 @@ package memory
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
 	"sync"
 
 	"crawler/pkg/model"
+	"crawler/pkg/store/compress"
 	"crawler/pkg/util"
 )
 
+const (
+	// historyLimit is the number of attempts kept per task, like in the redis store
+	historyLimit = 100
+	// deliveryLimit is the number of webhook deliveries kept per task
+	deliveryLimit = 100
+)
+
 type task struct {
-	Id       int
-	Url      string
-	Interval int
-	Attempts []*attempt
+	Id          int
+	Url         string
+	Interval    int
+	Method      string
+	Headers     map[string]string
+	Query       map[string]string
+	Body        string
+	UserAgent   string
+	Auth        *model.Auth
+	Cookies     bool
+	Extractors  []model.Extractor
+	ExtractOnly bool
+	Assertions  *model.Assertions
+	HealthCheck bool
+	Attempts    []*attempt
+	Webhooks    []model.Webhook
+	Schedule    *model.Schedule
+	IntervalMs  int64
+	JitterMs    int64
+	Paused      bool
+	CreatedAt   int64
+	Labels      map[string]string
+	Group       string
+	Retention   int
+	Jar         []*model.Cookie
+	Deliveries  []*model.Delivery
+	LastId      int64
 }
 
 type attempt struct {
-	Response  string
-	CreatedAt int64
-	Duration  float64
+	Id            int64
+	Blob          string
+	CreatedAt     int64
+	Duration      float64
+	Outcome       string
+	StatusCode    int
+	ETag          string
+	LastModified  string
+	NotModified   bool
+	BodyRef       int64
+	Hash          string
+	Changed       bool
+	Extracted     map[string]string
+	Assertions    *model.AssertionResult
+	PlannedAtMs   int64
+	DriftMs       int64
+	QuotaExceeded bool
+}
+
+func newAttempt(a *model.Attempt, blob string) *attempt {
+	return &attempt{
+		Id:            a.Id,
+		Blob:          blob,
+		CreatedAt:     a.CreatedAt,
+		Duration:      a.Duration,
+		Outcome:       a.Outcome,
+		StatusCode:    a.StatusCode,
+		ETag:          a.ETag,
+		LastModified:  a.LastModified,
+		NotModified:   a.NotModified,
+		BodyRef:       a.BodyRef,
+		Hash:          a.Hash,
+		Changed:       a.Changed,
+		Extracted:     copyMap(a.Extracted),
+		Assertions:    copyAssertionResult(a.Assertions),
+		PlannedAtMs:   a.PlannedAtMs,
+		DriftMs:       a.DriftMs,
+		QuotaExceeded: a.QuotaExceeded,
+	}
+}
+
+func (a *attempt) toModel(response string) *model.Attempt {
+	return &model.Attempt{
+		Id:            a.Id,
+		Response:      response,
+		CreatedAt:     a.CreatedAt,
+		Duration:      a.Duration,
+		Outcome:       a.Outcome,
+		StatusCode:    a.StatusCode,
+		ETag:          a.ETag,
+		LastModified:  a.LastModified,
+		NotModified:   a.NotModified,
+		BodyRef:       a.BodyRef,
+		Hash:          a.Hash,
+		Changed:       a.Changed,
+		Extracted:     copyMap(a.Extracted),
+		Assertions:    copyAssertionResult(a.Assertions),
+		PlannedAtMs:   a.PlannedAtMs,
+		DriftMs:       a.DriftMs,
+		QuotaExceeded: a.QuotaExceeded,
+	}
+}
+
+// blob is a response body shared by all attempts with the same content.
+type blob struct {
+	data     string
+	encoding string
+	size     int
+	refs     int
+}
+
+// space holds the data of a tenant.
+type space struct {
+	tasks  map[int]*task
+	groups map[string]*model.Group
+	blobs  map[string]*blob
+	// rawBytes and storedBytes sum up the sizes of the blobs as they are added and removed
+	rawBytes    int64
+	storedBytes int64
+	// audit holds the JSON encoded audit entries, oldest first
+	audit [][]byte
 }
 
 type Memory struct {
-	tasks map[int]*task
-	mutex sync.Mutex
+	spaces map[string]*space
+	codec  compress.Codec
+	mutex  sync.Mutex
+}
+
+type Option func(*Memory)
+
+// WithCompression compresses stored bodies of at least threshold bytes.
+func WithCompression(threshold int) Option {
+	return func(m *Memory) {
+		m.codec.Threshold = threshold
+	}
+}
+
+func newTask(t *model.Task) *task {
+	return &task{
+		Id:          t.Id,
+		Url:         t.Url,
+		Interval:    t.Interval,
+		Method:      t.Method,
+		Headers:     copyMap(t.Headers),
+		Query:       copyMap(t.Query),
+		Body:        t.Body,
+		UserAgent:   t.UserAgent,
+		Auth:        copyAuth(t.Auth),
+		Cookies:     t.Cookies,
+		Extractors:  copyExtractors(t.Extractors),
+		ExtractOnly: t.ExtractOnly,
+		Assertions:  copyAssertions(t.Assertions),
+		HealthCheck: t.HealthCheck,
+		Webhooks:    copyWebhooks(t.Webhooks),
+		Schedule:    copySchedule(t.Schedule),
+		IntervalMs:  t.IntervalMs,
+		JitterMs:    t.JitterMs,
+		Paused:      t.Paused,
+		CreatedAt:   t.CreatedAt,
+		Labels:      copyMap(t.Labels),
+		Group:       t.Group,
+		Retention:   t.Retention,
+	}
+}
+
+func (t *task) toModel() *model.Task {
+	return &model.Task{
+		Id:          t.Id,
+		Url:         t.Url,
+		Interval:    t.Interval,
+		Method:      t.Method,
+		Headers:     copyMap(t.Headers),
+		Query:       copyMap(t.Query),
+		Body:        t.Body,
+		UserAgent:   t.UserAgent,
+		Auth:        copyAuth(t.Auth),
+		Cookies:     t.Cookies,
+		Extractors:  copyExtractors(t.Extractors),
+		ExtractOnly: t.ExtractOnly,
+		Assertions:  copyAssertions(t.Assertions),
+		HealthCheck: t.HealthCheck,
+		Webhooks:    copyWebhooks(t.Webhooks),
+		Schedule:    copySchedule(t.Schedule),
+		IntervalMs:  t.IntervalMs,
+		JitterMs:    t.JitterMs,
+		Paused:      t.Paused,
+		CreatedAt:   t.CreatedAt,
+		Labels:      copyMap(t.Labels),
+		Group:       t.Group,
+		Retention:   t.Retention,
+	}
+}
+
+func copyMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+
+	return c
 }
 
-func NewMemory() *Memory {
-	return &Memory{
-		tasks: make(map[int]*task),
+func copyExtractors(e []model.Extractor) []model.Extractor {
+	if e == nil {
+		return nil
 	}
+
+	return append([]model.Extractor(nil), e...)
+}
+
+func copySchedule(s *model.Schedule) *model.Schedule {
+	if s == nil {
+		return nil
+	}
+
+	c := *s
+	c.Blackouts = append([]model.Window(nil), s.Blackouts...)
+
+	return &c
+}
+
+func copyWebhooks(w []model.Webhook) []model.Webhook {
+	if w == nil {
+		return nil
+	}
+
+	c := make([]model.Webhook, len(w))
+	for i := range w {
+		c[i] = w[i]
+		c[i].Events = append([]string(nil), w[i].Events...)
+	}
+
+	return c
+}
+
+func copyAssertions(a *model.Assertions) *model.Assertions {
+	if a == nil {
+		return nil
+	}
+
+	c := *a
+	c.StatusCodes = append([]int(nil), a.StatusCodes...)
+	c.JSONFields = copyMap(a.JSONFields)
+
+	return &c
+}
+
+func copyAssertionResult(r *model.AssertionResult) *model.AssertionResult {
+	if r == nil {
+		return nil
+	}
+
+	c := *r
+	c.Failures = append([]string(nil), r.Failures...)
+
+	return &c
+}
+
+func copyAuth(a *model.Auth) *model.Auth {
+	if a == nil {
+		return nil
+	}
+
+	c := *a
+	c.Scopes = append([]string(nil), a.Scopes...)
+
+	return &c
+}
+
+func NewMemory(opts ...Option) *Memory {
+	m := &Memory{
+		spaces: make(map[string]*space),
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// space returns the data of the context's tenant, the caller holds the mutex.
+func (m *Memory) space(ctx context.Context) *space {
+	tenant := util.Tenant(ctx)
+
+	sp, found := m.spaces[tenant]
+	if !found {
+		sp = &space{
+			tasks:  make(map[int]*task),
+			groups: make(map[string]*model.Group),
+			blobs:  make(map[string]*blob),
+		}
+		m.spaces[tenant] = sp
+	}
+
+	return sp
 }
 
 func (m *Memory) Create(ctx context.Context, t *model.Task) error {
+	return m.CreateLimited(ctx, t, 0)
+}
+
+func (m *Memory) CreateLimited(ctx context.Context, t *model.Task, maxTasks int) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	m.tasks[t.Id] = &task{
-		Id:       t.Id,
-		Url:      t.Url,
-		Interval: t.Interval,
+	sp := m.space(ctx)
+
+	if _, found := sp.tasks[t.Id]; found {
+		return util.Wrap(util.ErrConflict, "task id is taken")
 	}
 
+	if maxTasks > 0 && len(sp.tasks) >= maxTasks {
+		return util.Wrap(util.ErrQuotaExceeded, fmt.Sprintf("at most %d tasks allowed", maxTasks))
+	}
+
+	sp.tasks[t.Id] = newTask(t)
+
 	return nil
 }
 
@@ -49,23 +341,32 @@ func (m *Memory) Get(ctx context.Context, id int) (*model.Task, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	t, found := m.tasks[id]
+	sp := m.space(ctx)
+
+	t, found := sp.tasks[id]
 	if !found {
 		return nil, util.ErrResourceNotFound
 	}
 
-	return &model.Task{
-		Id:       t.Id,
-		Url:      t.Url,
-		Interval: t.Interval,
-	}, nil
+	return t.toModel(), nil
 }
 
 func (m *Memory) Delete(ctx context.Context, id int) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	delete(m.tasks, id)
+	sp := m.space(ctx)
+
+	t, found := sp.tasks[id]
+	if !found {
+		return nil
+	}
+
+	for _, a := range t.Attempts {
+		m.releaseBlob(sp, a.Blob)
+	}
+
+	delete(sp.tasks, id)
 
 	return nil
 }
@@ -74,34 +375,232 @@ func (m *Memory) ListTasks(ctx context.Context) ([]*model.Task, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	tasks := make([]*model.Task, 0, len(m.tasks))
+	sp := m.space(ctx)
 
-	for _, v := range m.tasks {
-		tasks = append(tasks, &model.Task{
-			Id:       v.Id,
-			Url:      v.Url,
-			Interval: v.Interval,
-		})
+	tasks := make([]*model.Task, 0, len(sp.tasks))
+
+	for _, v := range sp.tasks {
+		tasks = append(tasks, v.toModel())
 	}
 
 	return tasks, nil
 }
 
-func (m *Memory) AddAttempt(ctx context.Context, id int, a *model.Attempt) error {
+// failing tells whether the latest attempt not blocked by robots.txt failed.
+func (t *task) failing() bool {
+	for i := len(t.Attempts) - 1; i >= 0; i-- {
+		a := t.Attempts[i]
+		if a.Outcome == model.OutcomeBlocked {
+			continue
+		}
+
+		return a.toModel("").Failed()
+	}
+
+	return false
+}
+
+func (t *task) matches(q *model.TaskQuery) bool {
+	switch q.State {
+	case model.FilterPaused:
+		if !t.Paused {
+			return false
+		}
+	case model.FilterActive:
+		if t.Paused {
+			return false
+		}
+	case model.FilterFailing:
+		if !t.failing() {
+			return false
+		}
+	}
+
+	return q.Selector.Matches(t.Labels) && q.MatchesUrl(t.Url)
+}
+
+func less(a, b *task, sortBy string) bool {
+	switch sortBy {
+	case model.SortUrl:
+		if a.Url != b.Url {
+			return a.Url < b.Url
+		}
+	case model.SortInterval:
+		ai, bi := a.toModel().EffectiveIntervalMs(), b.toModel().EffectiveIntervalMs()
+		if ai != bi {
+			return ai < bi
+		}
+	case model.SortCreatedAt:
+		if a.CreatedAt != b.CreatedAt {
+			return a.CreatedAt < b.CreatedAt
+		}
+	}
+
+	return a.Id < b.Id
+}
+
+func (m *Memory) QueryTasks(ctx context.Context, q *model.TaskQuery) ([]*model.Task, int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sp := m.space(ctx)
+
+	var matching []*task
+
+	for _, t := range sp.tasks {
+		if t.matches(q) {
+			matching = append(matching, t)
+		}
+	}
+
+	sort.Slice(matching, func(i, j int) bool {
+		if q.Desc {
+			return less(matching[j], matching[i], q.Sort)
+		}
+
+		return less(matching[i], matching[j], q.Sort)
+	})
+
+	start, end := q.Page(len(matching))
+
+	tasks := make([]*model.Task, 0, end-start)
+	for _, t := range matching[start:end] {
+		tasks = append(tasks, t.toModel())
+	}
+
+	return tasks, len(matching), nil
+}
+
+func (m *Memory) SetPaused(ctx context.Context, id int, paused bool) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	t, found := m.tasks[id]
+	sp := m.space(ctx)
+
+	t, found := sp.tasks[id]
 	if !found {
 		return util.ErrResourceNotFound
 	}
 
-	t.Attempts = append(t.Attempts, &attempt{
-		Response:  a.Response,
-		CreatedAt: a.CreatedAt,
-		Duration:  a.Duration,
+	t.Paused = paused
+
+	return nil
+}
+
+// TrimAttempts removes all but the last keep attempts of a task.
+func (m *Memory) TrimAttempts(ctx context.Context, id int, keep int) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sp := m.space(ctx)
+
+	t, found := sp.tasks[id]
+	if !found {
+		return util.ErrResourceNotFound
+	}
+
+	m.trim(sp, t, keep)
+
+	return nil
+}
+
+func (m *Memory) trim(sp *space, t *task, keep int) {
+	if len(t.Attempts) <= keep {
+		return
+	}
+
+	old := t.Attempts[:len(t.Attempts)-keep]
+	for _, a := range old {
+		m.releaseBlob(sp, a.Blob)
+	}
+
+	t.Attempts = append([]*attempt(nil), t.Attempts[len(old):]...)
+}
+
+func copyGroup(g *model.Group) *model.Group {
+	c := *g
+	c.Headers = copyMap(g.Headers)
+
+	return &c
+}
+
+func (m *Memory) SaveGroup(ctx context.Context, g *model.Group) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sp := m.space(ctx)
+
+	sp.groups[g.Name] = copyGroup(g)
+
+	return nil
+}
+
+func (m *Memory) GetGroup(ctx context.Context, name string) (*model.Group, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sp := m.space(ctx)
+
+	g, found := sp.groups[name]
+	if !found {
+		return nil, util.ErrResourceNotFound
+	}
+
+	return copyGroup(g), nil
+}
+
+func (m *Memory) ListGroups(ctx context.Context) ([]*model.Group, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sp := m.space(ctx)
+
+	groups := make([]*model.Group, 0, len(sp.groups))
+	for _, g := range sp.groups {
+		groups = append(groups, copyGroup(g))
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
 	})
 
+	return groups, nil
+}
+
+func (m *Memory) DeleteGroup(ctx context.Context, name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sp := m.space(ctx)
+
+	if _, found := sp.groups[name]; !found {
+		return util.ErrResourceNotFound
+	}
+
+	delete(sp.groups, name)
+
+	return nil
+}
+
+func (m *Memory) AddAttempt(ctx context.Context, id int, a *model.Attempt) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sp := m.space(ctx)
+
+	t, found := sp.tasks[id]
+	if !found {
+		return util.ErrResourceNotFound
+	}
+
+	t.LastId++
+	a.Id = t.LastId
+
+	// the blob is retained before older attempts are dropped, so that a 304 keeps
+	// the body of the attempt it replaces
+	t.Attempts = append(t.Attempts, newAttempt(a, m.retainBlob(sp, a)))
+	m.trim(sp, t, historyLimit)
+
 	return nil
 }
 
@@ -109,19 +608,188 @@ func (m *Memory) ListAttempts(ctx context.Context, id int) ([]*model.Attempt, er
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	t, found := m.tasks[id]
+	sp := m.space(ctx)
+
+	t, found := sp.tasks[id]
 	if !found {
 		return nil, util.ErrResourceNotFound
 	}
 
 	attempts := make([]*model.Attempt, 0, len(t.Attempts))
 	for _, a := range t.Attempts {
-		attempts = append(attempts, &model.Attempt{
-			Response:  a.Response,
-			CreatedAt: a.CreatedAt,
-			Duration:  a.Duration,
-		})
+		var response string
+		if b, found := sp.blobs[a.Blob]; found {
+			var err error
+
+			response, err = compress.Decode(b.data, b.encoding)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		attempts = append(attempts, a.toModel(response))
 	}
 
 	return attempts, nil
 }
+
+func (m *Memory) LastAttempt(ctx context.Context, id int) (*model.Attempt, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	t, found := m.space(ctx).tasks[id]
+	if !found {
+		return nil, util.ErrResourceNotFound
+	}
+
+	if len(t.Attempts) == 0 {
+		return nil, nil
+	}
+
+	return t.Attempts[len(t.Attempts)-1].toModel(""), nil
+}
+
+// retainBlob stores the attempt's response under its content address and returns
+// the address. Attempts answered with 304 reference the unchanged body by hash.
+func (m *Memory) retainBlob(sp *space, a *model.Attempt) string {
+	var key string
+
+	switch {
+	case a.Response != "":
+		sum := sha256.Sum256([]byte(a.Response))
+		key = hex.EncodeToString(sum[:])
+	case a.NotModified:
+		key = a.Hash
+	}
+
+	b, found := sp.blobs[key]
+	if !found {
+		if a.Response == "" {
+			return ""
+		}
+
+		data, encoding := m.codec.Encode(a.Response)
+
+		b = &blob{data: data, encoding: encoding, size: len(a.Response)}
+		sp.blobs[key] = b
+		sp.rawBytes += int64(b.size)
+		sp.storedBytes += int64(len(b.data))
+	}
+
+	b.refs++
+
+	return key
+}
+
+func (m *Memory) releaseBlob(sp *space, key string) {
+	b, found := sp.blobs[key]
+	if !found {
+		return
+	}
+
+	b.refs--
+	if b.refs <= 0 {
+		delete(sp.blobs, key)
+		sp.rawBytes -= int64(b.size)
+		sp.storedBytes -= int64(len(b.data))
+	}
+}
+
+func copyCookies(cookies []*model.Cookie) []*model.Cookie {
+	ret := make([]*model.Cookie, 0, len(cookies))
+	for _, c := range cookies {
+		cp := *c
+		ret = append(ret, &cp)
+	}
+
+	return ret
+}
+
+func (m *Memory) SaveCookies(ctx context.Context, id int, cookies []*model.Cookie) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sp := m.space(ctx)
+
+	t, found := sp.tasks[id]
+	if !found {
+		return util.ErrResourceNotFound
+	}
+
+	t.Jar = copyCookies(cookies)
+
+	return nil
+}
+
+func (m *Memory) ListCookies(ctx context.Context, id int) ([]*model.Cookie, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sp := m.space(ctx)
+
+	t, found := sp.tasks[id]
+	if !found {
+		return nil, util.ErrResourceNotFound
+	}
+
+	return copyCookies(t.Jar), nil
+}
+
+func (m *Memory) AddDelivery(ctx context.Context, id int, d *model.Delivery) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sp := m.space(ctx)
+
+	t, found := sp.tasks[id]
+	if !found {
+		return util.ErrResourceNotFound
+	}
+
+	cp := *d
+	t.Deliveries = append(t.Deliveries, &cp)
+
+	if len(t.Deliveries) > deliveryLimit {
+		t.Deliveries = t.Deliveries[len(t.Deliveries)-deliveryLimit:]
+	}
+
+	return nil
+}
+
+func (m *Memory) ListDeliveries(ctx context.Context, id int) ([]*model.Delivery, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sp := m.space(ctx)
+
+	t, found := sp.tasks[id]
+	if !found {
+		return nil, util.ErrResourceNotFound
+	}
+
+	deliveries := make([]*model.Delivery, 0, len(t.Deliveries))
+	for _, d := range t.Deliveries {
+		cp := *d
+		deliveries = append(deliveries, &cp)
+	}
+
+	return deliveries, nil
+}
+
+// Ping never fails, the memory store is always reachable.
+func (m *Memory) Ping(_ context.Context) error {
+	return nil
+}
+
+func (m *Memory) Stats(ctx context.Context) (*model.StorageStats, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sp := m.space(ctx)
+
+	stats := &model.StorageStats{Blobs: int64(len(sp.blobs)), RawBytes: sp.rawBytes, StoredBytes: sp.storedBytes}
+
+	stats.UpdateRatio()
+
+	return stats, nil
+}
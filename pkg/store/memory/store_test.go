@@ -4,14 +4,18 @@ package memory
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"math"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"crawler/pkg/model"
+	"crawler/pkg/store/storetest"
 	"crawler/pkg/util"
 )
 
@@ -27,17 +31,29 @@ func TestCreate(t *testing.T) {
 
 	ctx := context.Background()
 
-	create(t, ctx, store, &model.Task{Id: int(util.GenID(maxId))})
-	create(t, ctx, store, &model.Task{Id: int(util.GenID(maxId))})
+	create(t, ctx, store, &model.Task{Id: 1, Url: "http://example.com"})
+
+	// a taken id does not overwrite the task
+	err := store.Create(ctx, &model.Task{Id: 1, Url: "http://dummy.com"})
+	assert.True(t, errors.Is(err, util.ErrConflict))
+
+	task, err := store.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com", task.Url)
 }
 
 func TestGetExisting(t *testing.T) {
 	store := NewMemory()
 
 	newTask := &model.Task{
-		Id:       int(util.GenID(maxId)),
-		Url:      "http://example.com",
-		Interval: 60,
+		Id:        int(util.GenID(maxId)),
+		Url:       "http://example.com",
+		Interval:  60,
+		Method:    "POST",
+		Headers:   map[string]string{"Accept": "application/json"},
+		Query:     map[string]string{"page": "1"},
+		Body:      "{}",
+		UserAgent: "test/1.0",
 	}
 
 	ctx := context.Background()
@@ -158,7 +174,9 @@ func TestGetAttempts(t *testing.T) {
 	err = store.AddAttempt(ctx, task1.Id, attempt2)
 	require.NoError(t, err)
 
-	err = store.AddAttempt(ctx, task2.Id, attempt2)
+	// AddAttempt assigns the id, so every task gets its own copy
+	attempt3 := *attempt2
+	err = store.AddAttempt(ctx, task2.Id, &attempt3)
 	require.NoError(t, err)
 
 	task1Attempts, err := store.ListAttempts(ctx, task1.Id)
@@ -167,5 +185,266 @@ func TestGetAttempts(t *testing.T) {
 
 	task2Attempts, err := store.ListAttempts(ctx, task2.Id)
 	require.NoError(t, err)
-	assert.Equal(t, []*model.Attempt{attempt2}, task2Attempts)
+	assert.Equal(t, []*model.Attempt{&attempt3}, task2Attempts)
+
+	// the last attempt comes without its body
+	last, err := store.LastAttempt(ctx, task1.Id)
+	require.NoError(t, err)
+	assert.Equal(t, attempt2.Id, last.Id)
+	assert.Equal(t, attempt2.CreatedAt, last.CreatedAt)
+	assert.Empty(t, last.Response)
+
+	task3 := &model.Task{Id: maxId + 2, Url: "http://example.org", Interval: 10}
+	create(t, ctx, store, task3)
+
+	last, err = store.LastAttempt(ctx, task3.Id)
+	require.NoError(t, err)
+	assert.Nil(t, last)
+
+	_, err = store.LastAttempt(ctx, maxId+1)
+	assert.Equal(t, util.ErrResourceNotFound, err)
+}
+
+func TestNotModifiedAttempts(t *testing.T) {
+	store := NewMemory()
+
+	ctx := context.Background()
+
+	task := &model.Task{Id: int(util.GenID(maxId))}
+	create(t, ctx, store, task)
+
+	full := &model.Attempt{Response: "body", Hash: hash("body"), ETag: `"v1"`, Outcome: model.OutcomeSuccess}
+	err := store.AddAttempt(ctx, task.Id, full)
+	require.NoError(t, err)
+
+	err = store.AddAttempt(ctx, task.Id, &model.Attempt{NotModified: true, BodyRef: full.Id, Hash: full.Hash, ETag: `"v1"`})
+	require.NoError(t, err)
+
+	attempts, err := store.ListAttempts(ctx, task.Id)
+	require.NoError(t, err)
+	require.Len(t, attempts, 2)
+
+	assert.Equal(t, int64(1), attempts[0].Id)
+	assert.Equal(t, int64(2), attempts[1].Id)
+	assert.Equal(t, "body", attempts[1].Response)
+	assert.True(t, attempts[1].NotModified)
+	assert.Len(t, store.space(ctx).blobs, 1)
+}
+
+func TestNotModifiedHistory(t *testing.T) {
+	storetest.NotModified(t, NewMemory())
+}
+
+func TestBlobDeduplication(t *testing.T) {
+	store := NewMemory()
+
+	ctx := context.Background()
+
+	task1 := &model.Task{Id: 1}
+	task2 := &model.Task{Id: 2}
+	create(t, ctx, store, task1)
+	create(t, ctx, store, task2)
+
+	for _, body := range []string{"same", "same", "other"} {
+		err := store.AddAttempt(ctx, task1.Id, &model.Attempt{Response: body})
+		require.NoError(t, err)
+	}
+
+	err := store.AddAttempt(ctx, task2.Id, &model.Attempt{Response: "same"})
+	require.NoError(t, err)
+
+	require.Len(t, store.space(ctx).blobs, 2)
+	assert.Equal(t, 3, store.space(ctx).blobs[hash("same")].refs)
+
+	attempts, err := store.ListAttempts(ctx, task1.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "same", attempts[1].Response)
+	assert.Equal(t, "other", attempts[2].Response)
+
+	err = store.Delete(ctx, task1.Id)
+	require.NoError(t, err)
+
+	require.Len(t, store.space(ctx).blobs, 1)
+	assert.Equal(t, 1, store.space(ctx).blobs[hash("same")].refs)
+
+	err = store.Delete(ctx, task2.Id)
+	require.NoError(t, err)
+	assert.Len(t, store.space(ctx).blobs, 0)
+}
+
+func hash(body string) string {
+	sum := sha256.Sum256([]byte(body))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func TestCompression(t *testing.T) {
+	store := NewMemory(WithCompression(16))
+
+	ctx := context.Background()
+
+	task := &model.Task{Id: 1}
+	create(t, ctx, store, task)
+
+	body := strings.Repeat("compressible ", 100)
+
+	err := store.AddAttempt(ctx, task.Id, &model.Attempt{Response: body})
+	require.NoError(t, err)
+
+	err = store.AddAttempt(ctx, task.Id, &model.Attempt{Response: "short"})
+	require.NoError(t, err)
+
+	attempts, err := store.ListAttempts(ctx, task.Id)
+	require.NoError(t, err)
+	assert.Equal(t, body, attempts[0].Response)
+	assert.Equal(t, "short", attempts[1].Response)
+
+	stats, err := store.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Blobs)
+	assert.Equal(t, int64(len(body)+len("short")), stats.RawBytes)
+	assert.Less(t, stats.StoredBytes, stats.RawBytes)
+	assert.Greater(t, stats.CompressionRatio, 1.0)
+}
+
+func TestQueryTasks(t *testing.T) {
+	store := NewMemory()
+
+	ctx := context.Background()
+
+	create(t, ctx, store, &model.Task{Id: 1, Url: "http://b.example.com/x", Interval: 60, CreatedAt: 30})
+	create(t, ctx, store, &model.Task{Id: 2, Url: "http://a.example.com/y", IntervalMs: 500, CreatedAt: 20})
+	create(t, ctx, store, &model.Task{Id: 3, Url: "http://A.example.com/x", Interval: 10, CreatedAt: 10})
+
+	ids := func(q *model.TaskQuery) []int {
+		tasks, _, err := store.QueryTasks(ctx, q)
+		require.NoError(t, err)
+
+		var ids []int
+		for _, task := range tasks {
+			ids = append(ids, task.Id)
+		}
+
+		return ids
+	}
+
+	assert.Equal(t, []int{1, 2, 3}, ids(&model.TaskQuery{}))
+	assert.Equal(t, []int{3, 2, 1}, ids(&model.TaskQuery{Sort: model.SortCreatedAt}))
+	assert.Equal(t, []int{1, 3, 2}, ids(&model.TaskQuery{Sort: model.SortInterval, Desc: true}))
+	assert.Equal(t, []int{3, 2, 1}, ids(&model.TaskQuery{Sort: model.SortUrl}))
+	assert.Equal(t, []int{1, 3}, ids(&model.TaskQuery{Url: "/x"}))
+	assert.Equal(t, []int{2, 3}, ids(&model.TaskQuery{Host: "a.example.com"}))
+
+	tasks, total, err := store.QueryTasks(ctx, &model.TaskQuery{Offset: 1, Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 3, total)
+	require.Len(t, tasks, 1)
+	assert.Equal(t, 2, tasks[0].Id)
+
+	tasks, total, err = store.QueryTasks(ctx, &model.TaskQuery{Offset: 5})
+	require.NoError(t, err)
+	assert.Equal(t, 3, total)
+	assert.Empty(t, tasks)
+
+	require.NoError(t, store.SetPaused(ctx, 2, true))
+	assert.Equal(t, []int{2}, ids(&model.TaskQuery{State: model.FilterPaused}))
+	assert.Equal(t, []int{1, 3}, ids(&model.TaskQuery{State: model.FilterActive}))
+
+	require.NoError(t, store.AddAttempt(ctx, 1, &model.Attempt{Outcome: model.OutcomeError}))
+	require.NoError(t, store.AddAttempt(ctx, 1, &model.Attempt{Outcome: model.OutcomeBlocked}))
+	require.NoError(t, store.AddAttempt(ctx, 3, &model.Attempt{Outcome: model.OutcomeError}))
+	require.NoError(t, store.AddAttempt(ctx, 3, &model.Attempt{Outcome: model.OutcomeSuccess}))
+	assert.Equal(t, []int{1}, ids(&model.TaskQuery{State: model.FilterFailing}))
+
+	err = store.SetPaused(ctx, 4, true)
+	assert.True(t, errors.Is(err, util.ErrResourceNotFound))
+}
+
+func TestTrimAttempts(t *testing.T) {
+	store := NewMemory()
+
+	ctx := context.Background()
+
+	create(t, ctx, store, &model.Task{Id: 1})
+
+	for _, body := range []string{"a", "b", "c"} {
+		err := store.AddAttempt(ctx, 1, &model.Attempt{Response: body})
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, store.TrimAttempts(ctx, 1, 2))
+
+	attempts, err := store.ListAttempts(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, attempts, 2)
+	assert.Equal(t, "b", attempts[0].Response)
+
+	stats, err := store.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Blobs)
+
+	assert.True(t, errors.Is(store.TrimAttempts(ctx, 2, 1), util.ErrResourceNotFound))
+}
+
+func TestGroups(t *testing.T) {
+	store := NewMemory()
+
+	ctx := context.Background()
+
+	require.NoError(t, store.SaveGroup(ctx, &model.Group{Name: "b", Interval: 60}))
+	require.NoError(t, store.SaveGroup(ctx, &model.Group{Name: "a", Headers: map[string]string{"X": "1"}}))
+
+	g, err := store.GetGroup(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, &model.Group{Name: "a", Headers: map[string]string{"X": "1"}}, g)
+
+	groups, err := store.ListGroups(ctx)
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	assert.Equal(t, "a", groups[0].Name)
+
+	require.NoError(t, store.DeleteGroup(ctx, "a"))
+	_, err = store.GetGroup(ctx, "a")
+	assert.True(t, errors.Is(err, util.ErrResourceNotFound))
+	assert.True(t, errors.Is(store.DeleteGroup(ctx, "a"), util.ErrResourceNotFound))
+}
+
+func TestAuditEntries(t *testing.T) {
+	store := NewMemory()
+
+	ctx := context.Background()
+	task := &model.Task{Id: 1, Url: "https://example.com", Labels: map[string]string{"env": "prod"}}
+
+	require.NoError(t, store.AddAuditEntry(ctx, &model.AuditEntry{Action: model.AuditCreate, TaskId: 1, Actor: "alice", CreatedAt: 10, After: task}))
+	require.NoError(t, store.AddAuditEntry(ctx, &model.AuditEntry{Action: model.AuditPause, TaskId: 1, Actor: "bob", CreatedAt: 20}))
+	require.NoError(t, store.AddAuditEntry(ctx, &model.AuditEntry{Action: model.AuditDelete, TaskId: 2, Actor: "bob", CreatedAt: 30}))
+
+	// the stored task is a copy
+	task.Labels["env"] = "dev"
+
+	entries, err := store.ListAuditEntries(ctx, &model.AuditQuery{})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, int64(3), entries[0].Id)
+	assert.Equal(t, "prod", entries[2].After.Labels["env"])
+
+	entries, err = store.ListAuditEntries(ctx, &model.AuditQuery{Actor: "bob", TaskId: 1})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, model.AuditPause, entries[0].Action)
+
+	entries, err = store.ListAuditEntries(ctx, &model.AuditQuery{Since: 15, Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, int64(3), entries[0].Id)
+
+	entries, err = store.ListAuditEntries(ctx, &model.AuditQuery{Before: 3, Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, int64(2), entries[0].Id)
+
+	// tenants have their own audit trail
+	entries, err = store.ListAuditEntries(util.WithTenant(ctx, "acme"), &model.AuditQuery{})
+	require.NoError(t, err)
+	assert.Empty(t, entries)
 }
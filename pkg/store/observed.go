@@ -0,0 +1,205 @@
+package store
+
+import (
+	"context"
+
+	"crawler/pkg/model"
+)
+
+// Observer is called when a store operation starts, the returned function when it
+// finished. The returned context is passed to the store.
+type Observer func(ctx context.Context, op string) (context.Context, func(err error))
+
+type observed struct {
+	store   Store
+	observe Observer
+}
+
+// NewObserved reports every operation of the store to the observer.
+func NewObserved(s Store, observe Observer) Store {
+	return &observed{store: s, observe: observe}
+}
+
+func (o *observed) Create(ctx context.Context, task *model.Task) error {
+	ctx, done := o.observe(ctx, "create")
+	err := o.store.Create(ctx, task)
+	done(err)
+
+	return err
+}
+
+func (o *observed) CreateLimited(ctx context.Context, task *model.Task, maxTasks int) error {
+	ctx, done := o.observe(ctx, "create")
+	err := o.store.CreateLimited(ctx, task, maxTasks)
+	done(err)
+
+	return err
+}
+
+func (o *observed) Get(ctx context.Context, id int) (*model.Task, error) {
+	ctx, done := o.observe(ctx, "get")
+	task, err := o.store.Get(ctx, id)
+	done(err)
+
+	return task, err
+}
+
+func (o *observed) Delete(ctx context.Context, id int) error {
+	ctx, done := o.observe(ctx, "delete")
+	err := o.store.Delete(ctx, id)
+	done(err)
+
+	return err
+}
+
+func (o *observed) ListTasks(ctx context.Context) ([]*model.Task, error) {
+	ctx, done := o.observe(ctx, "list_tasks")
+	tasks, err := o.store.ListTasks(ctx)
+	done(err)
+
+	return tasks, err
+}
+
+func (o *observed) QueryTasks(ctx context.Context, q *model.TaskQuery) ([]*model.Task, int, error) {
+	ctx, done := o.observe(ctx, "query_tasks")
+	tasks, total, err := o.store.QueryTasks(ctx, q)
+	done(err)
+
+	return tasks, total, err
+}
+
+func (o *observed) SetPaused(ctx context.Context, id int, paused bool) error {
+	ctx, done := o.observe(ctx, "set_paused")
+	err := o.store.SetPaused(ctx, id, paused)
+	done(err)
+
+	return err
+}
+
+func (o *observed) AddAttempt(ctx context.Context, id int, attempt *model.Attempt) error {
+	ctx, done := o.observe(ctx, "add_attempt")
+	err := o.store.AddAttempt(ctx, id, attempt)
+	done(err)
+
+	return err
+}
+
+func (o *observed) ListAttempts(ctx context.Context, id int) ([]*model.Attempt, error) {
+	ctx, done := o.observe(ctx, "list_attempts")
+	attempts, err := o.store.ListAttempts(ctx, id)
+	done(err)
+
+	return attempts, err
+}
+
+func (o *observed) LastAttempt(ctx context.Context, id int) (*model.Attempt, error) {
+	ctx, done := o.observe(ctx, "last_attempt")
+	attempt, err := o.store.LastAttempt(ctx, id)
+	done(err)
+
+	return attempt, err
+}
+
+func (o *observed) TrimAttempts(ctx context.Context, id int, keep int) error {
+	ctx, done := o.observe(ctx, "trim_attempts")
+	err := o.store.TrimAttempts(ctx, id, keep)
+	done(err)
+
+	return err
+}
+
+func (o *observed) SaveCookies(ctx context.Context, id int, cookies []*model.Cookie) error {
+	ctx, done := o.observe(ctx, "save_cookies")
+	err := o.store.SaveCookies(ctx, id, cookies)
+	done(err)
+
+	return err
+}
+
+func (o *observed) ListCookies(ctx context.Context, id int) ([]*model.Cookie, error) {
+	ctx, done := o.observe(ctx, "list_cookies")
+	cookies, err := o.store.ListCookies(ctx, id)
+	done(err)
+
+	return cookies, err
+}
+
+func (o *observed) AddDelivery(ctx context.Context, id int, delivery *model.Delivery) error {
+	ctx, done := o.observe(ctx, "add_delivery")
+	err := o.store.AddDelivery(ctx, id, delivery)
+	done(err)
+
+	return err
+}
+
+func (o *observed) ListDeliveries(ctx context.Context, id int) ([]*model.Delivery, error) {
+	ctx, done := o.observe(ctx, "list_deliveries")
+	deliveries, err := o.store.ListDeliveries(ctx, id)
+	done(err)
+
+	return deliveries, err
+}
+
+func (o *observed) SaveGroup(ctx context.Context, group *model.Group) error {
+	ctx, done := o.observe(ctx, "save_group")
+	err := o.store.SaveGroup(ctx, group)
+	done(err)
+
+	return err
+}
+
+func (o *observed) GetGroup(ctx context.Context, name string) (*model.Group, error) {
+	ctx, done := o.observe(ctx, "get_group")
+	group, err := o.store.GetGroup(ctx, name)
+	done(err)
+
+	return group, err
+}
+
+func (o *observed) ListGroups(ctx context.Context) ([]*model.Group, error) {
+	ctx, done := o.observe(ctx, "list_groups")
+	groups, err := o.store.ListGroups(ctx)
+	done(err)
+
+	return groups, err
+}
+
+func (o *observed) DeleteGroup(ctx context.Context, name string) error {
+	ctx, done := o.observe(ctx, "delete_group")
+	err := o.store.DeleteGroup(ctx, name)
+	done(err)
+
+	return err
+}
+
+func (o *observed) AddAuditEntry(ctx context.Context, entry *model.AuditEntry) error {
+	ctx, done := o.observe(ctx, "add_audit_entry")
+	err := o.store.AddAuditEntry(ctx, entry)
+	done(err)
+
+	return err
+}
+
+func (o *observed) ListAuditEntries(ctx context.Context, q *model.AuditQuery) ([]*model.AuditEntry, error) {
+	ctx, done := o.observe(ctx, "list_audit_entries")
+	entries, err := o.store.ListAuditEntries(ctx, q)
+	done(err)
+
+	return entries, err
+}
+
+func (o *observed) Stats(ctx context.Context) (*model.StorageStats, error) {
+	ctx, done := o.observe(ctx, "stats")
+	stats, err := o.store.Stats(ctx)
+	done(err)
+
+	return stats, err
+}
+
+func (o *observed) Ping(ctx context.Context) error {
+	ctx, done := o.observe(ctx, "ping")
+	err := o.store.Ping(ctx)
+	done(err)
+
+	return err
+}
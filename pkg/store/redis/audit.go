@@ -0,0 +1,70 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+
+	"crawler/pkg/model"
+	"crawler/pkg/util"
+)
+
+const (
+	// auditKey is a list of JSON encoded audit entries, oldest first
+	auditKey    = "audit"
+	auditSeqKey = "audit:seq"
+
+	// auditChunk is how many entries are read at once walking the trail backwards
+	auditChunk = 100
+)
+
+func (s *Store) AddAuditEntry(ctx context.Context, e *model.AuditEntry) error {
+	id, err := s.client.Incr(ctx, namespace(ctx, auditSeqKey)).Result()
+	if err != nil {
+		return util.Wrap(err, "generating audit entry id failed")
+	}
+
+	e.Id = id
+
+	encoded, err := json.Marshal(e)
+	if err != nil {
+		return util.Wrap(err, "audit entry encoding failed")
+	}
+
+	err = s.client.RPush(ctx, namespace(ctx, auditKey), encoded).Err()
+	if err != nil {
+		return util.Wrap(err, "saving audit entry failed")
+	}
+
+	return nil
+}
+
+// ListAuditEntries walks the trail from its end in chunks until the limit is reached.
+func (s *Store) ListAuditEntries(ctx context.Context, q *model.AuditQuery) ([]*model.AuditEntry, error) {
+	var entries []*model.AuditEntry
+
+	for end := int64(-1); q.Limit == 0 || len(entries) < q.Limit; end -= auditChunk {
+		encoded, err := s.client.LRange(ctx, namespace(ctx, auditKey), end-auditChunk+1, end).Result()
+		if err != nil {
+			return nil, util.Wrap(err, "getting audit entries failed")
+		}
+
+		for i := len(encoded) - 1; i >= 0 && (q.Limit == 0 || len(entries) < q.Limit); i-- {
+			var e model.AuditEntry
+
+			err = json.Unmarshal([]byte(encoded[i]), &e)
+			if err != nil {
+				return nil, util.Wrap(err, "audit entry conversion failed")
+			}
+
+			if q.Matches(&e) {
+				entries = append(entries, &e)
+			}
+		}
+
+		if len(encoded) < auditChunk {
+			break
+		}
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,208 @@
+package redis
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+
+	"crawler/pkg/model"
+	"crawler/pkg/store/compress"
+	"crawler/pkg/util"
+)
+
+const (
+	blobPrefix  = "blob:"
+	statsKey    = "stats:blobs"
+	encodingKey = "encoding"
+
+	blobsStat       = "blobs"
+	rawBytesStat    = "rawBytes"
+	storedBytesStat = "storedBytes"
+)
+
+// scripts are sent with EVAL, EVALSHA can not fall back to EVAL inside a pipeline
+const (
+	// retainScript stores the blob unless it exists already and takes a reference to it.
+	// Without a body only an existing blob is referenced, it returns 0 otherwise.
+	// Storage statistics only count each blob once.
+	retainScript = `
+if ARGV[1] == '' and redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+if ARGV[1] ~= '' and redis.call('HSETNX', KEYS[1], 'body', ARGV[1]) == 1 then
+	redis.call('HSET', KEYS[1], 'encoding', ARGV[2], 'size', ARGV[3])
+	redis.call('HINCRBY', KEYS[2], 'blobs', 1)
+	redis.call('HINCRBY', KEYS[2], 'rawBytes', ARGV[3])
+	redis.call('HINCRBY', KEYS[2], 'storedBytes', string.len(ARGV[1]))
+end
+return redis.call('HINCRBY', KEYS[1], 'refs', 1)
+`
+
+	// releaseScript drops a reference to a blob and removes the blob with its last reference.
+	releaseScript = `
+local refs = redis.call('HINCRBY', KEYS[1], 'refs', -1)
+if refs <= 0 then
+	local size = tonumber(redis.call('HGET', KEYS[1], 'size') or '0')
+	local stored = redis.call('HSTRLEN', KEYS[1], 'body')
+	if stored > 0 then
+		redis.call('HINCRBY', KEYS[2], 'blobs', -1)
+		redis.call('HINCRBY', KEYS[2], 'rawBytes', -size)
+		redis.call('HINCRBY', KEYS[2], 'storedBytes', -stored)
+	end
+	redis.call('DEL', KEYS[1])
+end
+return refs
+`
+)
+
+// blobKey returns the content address the attempt's response is stored under.
+// Attempts answered with 304 carry no body but reference the blob of the
+// unchanged response through its hash.
+func blobKey(a *model.Attempt) string {
+	if a.Response != "" {
+		sum := sha256.Sum256([]byte(a.Response))
+
+		return hex.EncodeToString(sum[:])
+	}
+
+	if a.NotModified {
+		return a.Hash
+	}
+
+	return ""
+}
+
+// retainBlob stores the body (unless it is already stored) and takes a reference to it.
+// It returns false when there is no body and the blob does not exist (anymore).
+func (s *Store) retainBlob(ctx context.Context, blob string, body string) (bool, error) {
+	data, encoding := s.codec.Encode(body)
+
+	refs, err := s.client.Eval(ctx, retainScript, []string{namespace(ctx, blobPrefix+blob), namespace(ctx, statsKey)}, data, encoding, len(body)).Int64()
+	if err != nil {
+		return false, util.Wrap(err, "retaining blob failed")
+	}
+
+	return refs > 0, nil
+}
+
+func (s *Store) releaseBlobs(ctx context.Context, blobs []string) error {
+	if len(blobs) == 0 {
+		return nil
+	}
+
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, blob := range blobs {
+			pipe.Eval(ctx, releaseScript, []string{namespace(ctx, blobPrefix+blob), namespace(ctx, statsKey)})
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return util.Wrap(err, "releasing blobs failed")
+	}
+
+	return nil
+}
+
+// blobsOf returns the blob keys referenced by the given responses.
+func (s *Store) blobsOf(ctx context.Context, responses []string) ([]string, error) {
+	if len(responses) == 0 {
+		return nil, nil
+	}
+
+	results, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, response := range responses {
+			pipe.HGet(ctx, response, blobKeyField)
+		}
+
+		return nil
+	})
+
+	// responses without a blob make HGET report redis.Nil
+	if err != nil && err != redis.Nil {
+		return nil, util.Wrap(err, "getting blobs of responses failed")
+	}
+
+	blobs := make([]string, 0, len(results))
+	for _, result := range results {
+		blob, err := result.(*redis.StringCmd).Result()
+		if err == nil && blob != "" {
+			blobs = append(blobs, blob)
+		}
+	}
+
+	return blobs, nil
+}
+
+func (s *Store) loadBlobs(ctx context.Context, blobs map[string]string) error {
+	if len(blobs) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(blobs))
+	for blob := range blobs {
+		keys = append(keys, blob)
+	}
+
+	results, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, blob := range keys {
+			pipe.HMGet(ctx, namespace(ctx, blobPrefix+blob), bodyKey, encodingKey)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return util.Wrap(err, "getting blobs failed")
+	}
+
+	for i, result := range results {
+		values := result.(*redis.SliceCmd).Val()
+		if len(values) != 2 {
+			continue
+		}
+
+		// missing fields come back as nil
+		data, _ := values[0].(string)
+		encoding, _ := values[1].(string)
+
+		body, err := compress.Decode(data, encoding)
+		if err != nil {
+			return util.Wrap(err, "decoding blob failed")
+		}
+
+		blobs[keys[i]] = body
+	}
+
+	return nil
+}
+
+func (s *Store) Stats(ctx context.Context) (*model.StorageStats, error) {
+	values, err := s.client.HGetAll(ctx, namespace(ctx, statsKey)).Result()
+	if err != nil {
+		return nil, util.Wrap(err, "getting storage stats failed")
+	}
+
+	stats := &model.StorageStats{}
+
+	for key, field := range map[string]*int64{
+		blobsStat:       &stats.Blobs,
+		rawBytesStat:    &stats.RawBytes,
+		storedBytesStat: &stats.StoredBytes,
+	} {
+		if v, ok := values[key]; ok {
+			*field, err = strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil, util.Wrap(err, "stats conversion failed")
+			}
+		}
+	}
+
+	stats.UpdateRatio()
+
+	return stats, nil
+}
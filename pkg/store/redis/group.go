@@ -0,0 +1,82 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/go-redis/redis/v8"
+
+	"crawler/pkg/model"
+	"crawler/pkg/util"
+)
+
+// groups are kept JSON encoded in a single hash by name
+
+func (s *Store) SaveGroup(ctx context.Context, g *model.Group) error {
+	encoded, err := json.Marshal(g)
+	if err != nil {
+		return util.Wrap(err, "group encoding failed")
+	}
+
+	err = s.client.HSet(ctx, namespace(ctx, groupsKey), g.Name, encoded).Err()
+	if err != nil {
+		return util.Wrap(err, "saving group failed")
+	}
+
+	return nil
+}
+
+func (s *Store) GetGroup(ctx context.Context, name string) (*model.Group, error) {
+	encoded, err := s.client.HGet(ctx, namespace(ctx, groupsKey), name).Bytes()
+	if err == redis.Nil {
+		return nil, util.ErrResourceNotFound
+	} else if err != nil {
+		return nil, util.Wrap(err, "getting group failed")
+	}
+
+	var g model.Group
+
+	err = json.Unmarshal(encoded, &g)
+	if err != nil {
+		return nil, util.Wrap(err, "group conversion failed")
+	}
+
+	return &g, nil
+}
+
+func (s *Store) ListGroups(ctx context.Context) ([]*model.Group, error) {
+	encoded, err := s.client.HGetAll(ctx, namespace(ctx, groupsKey)).Result()
+	if err != nil {
+		return nil, util.Wrap(err, "getting groups failed")
+	}
+
+	groups := make([]*model.Group, 0, len(encoded))
+	for _, e := range encoded {
+		var g model.Group
+
+		err = json.Unmarshal([]byte(e), &g)
+		if err != nil {
+			return nil, util.Wrap(err, "group conversion failed")
+		}
+
+		groups = append(groups, &g)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+
+	return groups, nil
+}
+
+func (s *Store) DeleteGroup(ctx context.Context, name string) error {
+	deleted, err := s.client.HDel(ctx, namespace(ctx, groupsKey), name).Result()
+	if err != nil {
+		return util.Wrap(err, "deleting group failed")
+	} else if deleted == 0 {
+		return util.ErrResourceNotFound
+	}
+
+	return nil
+}
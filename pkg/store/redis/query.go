@@ -0,0 +1,264 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+
+	"crawler/pkg/labels"
+	"crawler/pkg/model"
+	"crawler/pkg/util"
+)
+
+// urlSeparator separates the url from the task key in members of the url index,
+// all of them have the same score so that they are ordered by the url.
+const urlSeparator = "\x00"
+
+func hostOf(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(u.Hostname())
+}
+
+// indexTask adds the task to the indexes and returns the number of queued commands.
+func indexTask(ctx context.Context, pipe redis.Pipeliner, key string, t *model.Task, labels []byte) int {
+	pipe.ZAdd(ctx, namespace(ctx, idIndex), &redis.Z{Score: float64(t.Id), Member: key})
+	pipe.ZAdd(ctx, namespace(ctx, intervalIndex), &redis.Z{Score: float64(t.EffectiveIntervalMs()), Member: key})
+	pipe.ZAdd(ctx, namespace(ctx, createdIndex), &redis.Z{Score: float64(t.CreatedAt), Member: key})
+	pipe.ZAdd(ctx, namespace(ctx, urlIndex), &redis.Z{Member: t.Url + urlSeparator + key})
+	pipe.HSet(ctx, namespace(ctx, urlsKey), key, t.Url)
+	pipe.SAdd(ctx, namespace(ctx, hostPrefix+hostOf(t.Url)), key)
+	pipe.HSet(ctx, namespace(ctx, labelsIndex), key, labels)
+
+	if t.Paused {
+		pipe.SAdd(ctx, namespace(ctx, pausedSet), key)
+		return 8
+	}
+
+	return 7
+}
+
+// unindexTask removes the task from the indexes and returns the number of queued commands.
+func unindexTask(ctx context.Context, pipe redis.Pipeliner, key string, taskUrl string) int {
+	pipe.ZRem(ctx, namespace(ctx, idIndex), key)
+	pipe.ZRem(ctx, namespace(ctx, intervalIndex), key)
+	pipe.ZRem(ctx, namespace(ctx, createdIndex), key)
+	pipe.ZRem(ctx, namespace(ctx, urlIndex), taskUrl+urlSeparator+key)
+	pipe.HDel(ctx, namespace(ctx, urlsKey), key)
+	pipe.SRem(ctx, namespace(ctx, hostPrefix+hostOf(taskUrl)), key)
+	pipe.SRem(ctx, namespace(ctx, pausedSet), key)
+	pipe.SRem(ctx, namespace(ctx, failingSet), key)
+	pipe.HDel(ctx, namespace(ctx, labelsIndex), key)
+
+	return 9
+}
+
+// ensureIndexed indexes tasks stored by versions without indexes. Whether their
+// latest attempt failed is only known after their next attempt.
+func (s *Store) ensureIndexed(ctx context.Context) error {
+	indexed, err := s.client.ZCard(ctx, namespace(ctx, idIndex)).Result()
+	if err != nil {
+		return util.Wrap(err, "counting indexed tasks failed")
+	}
+
+	stored, err := s.client.LLen(ctx, namespace(ctx, taskPrefix)).Result()
+	if err != nil {
+		return util.Wrap(err, "counting tasks failed")
+	}
+
+	if indexed == stored {
+		return nil
+	}
+
+	tasks, err := s.ListTasks(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, t := range tasks {
+			labels, err := json.Marshal(t.Labels)
+			if err != nil {
+				return err
+			}
+
+			indexTask(ctx, pipe, namespace(ctx, taskPrefix+strconv.Itoa(t.Id)), t, labels)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return util.Wrap(err, "indexing tasks failed")
+	}
+
+	return nil
+}
+
+// sortedKeys returns the keys of all tasks in the order the query asks for.
+func (s *Store) sortedKeys(ctx context.Context, q *model.TaskQuery) ([]string, error) {
+	index := idIndex
+
+	switch q.Sort {
+	case model.SortUrl:
+		index = urlIndex
+	case model.SortInterval:
+		index = intervalIndex
+	case model.SortCreatedAt:
+		index = createdIndex
+	}
+
+	var (
+		keys []string
+		err  error
+	)
+
+	if q.Desc {
+		keys, err = s.client.ZRevRange(ctx, namespace(ctx, index), 0, lastElem).Result()
+	} else {
+		keys, err = s.client.ZRange(ctx, namespace(ctx, index), 0, lastElem).Result()
+	}
+
+	if err != nil {
+		return nil, util.Wrap(err, "getting sorted tasks failed")
+	}
+
+	if index == urlIndex {
+		for i, k := range keys {
+			keys[i] = k[strings.LastIndex(k, urlSeparator)+1:]
+		}
+	}
+
+	return keys, nil
+}
+
+func (s *Store) members(ctx context.Context, set string) (map[string]bool, error) {
+	keys, err := s.client.SMembers(ctx, set).Result()
+	if err != nil {
+		return nil, util.Wrap(err, "getting filtered tasks failed")
+	}
+
+	m := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		m[k] = true
+	}
+
+	return m, nil
+}
+
+// QueryTasks filters and sorts the tasks on the indexes, only the tasks of the page are loaded.
+func (s *Store) QueryTasks(ctx context.Context, q *model.TaskQuery) ([]*model.Task, int, error) {
+	err := s.ensureIndexed(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	keys, err := s.sortedKeys(ctx, q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var state map[string]bool
+
+	switch q.State {
+	case model.FilterPaused, model.FilterActive:
+		state, err = s.members(ctx, namespace(ctx, pausedSet))
+	case model.FilterFailing:
+		state, err = s.members(ctx, namespace(ctx, failingSet))
+	}
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var hosts map[string]bool
+	if q.Host != "" {
+		hosts, err = s.members(ctx, namespace(ctx, hostPrefix+strings.ToLower(q.Host)))
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var urls map[string]string
+	if q.Url != "" {
+		urls, err = s.client.HGetAll(ctx, namespace(ctx, urlsKey)).Result()
+		if err != nil {
+			return nil, 0, util.Wrap(err, "getting task urls failed")
+		}
+	}
+
+	var taskLabels map[string]string
+	if !q.Selector.Empty() {
+		taskLabels, err = s.client.HGetAll(ctx, namespace(ctx, labelsIndex)).Result()
+		if err != nil {
+			return nil, 0, util.Wrap(err, "getting task labels failed")
+		}
+	}
+
+	matching := keys[:0]
+
+	for _, k := range keys {
+		switch {
+		case taskLabels != nil && !matchesLabels(q.Selector, taskLabels[k]):
+		case state != nil && state[k] == (q.State == model.FilterActive):
+		case hosts != nil && !hosts[k]:
+		case urls != nil && !strings.Contains(urls[k], q.Url):
+		default:
+			matching = append(matching, k)
+		}
+	}
+
+	start, end := q.Page(len(matching))
+
+	tasks, err := s.loadTasks(ctx, matching[start:end])
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return tasks, len(matching), nil
+}
+
+func matchesLabels(sel labels.Selector, encoded string) bool {
+	var l map[string]string
+
+	if encoded != "" {
+		if err := json.Unmarshal([]byte(encoded), &l); err != nil {
+			return false
+		}
+	}
+
+	return sel.Matches(l)
+}
+
+func (s *Store) SetPaused(ctx context.Context, id int, paused bool) error {
+	if !s.taskExists(ctx, id) {
+		return util.ErrResourceNotFound
+	}
+
+	task := namespace(ctx, taskPrefix+strconv.Itoa(id))
+
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, task, pausedKey, paused)
+
+		if paused {
+			pipe.SAdd(ctx, namespace(ctx, pausedSet), task)
+		} else {
+			pipe.SRem(ctx, namespace(ctx, pausedSet), task)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return util.Wrap(err, "saving paused state failed")
+	}
+
+	return nil
+}
@@ -2,64 +2,254 @@ package redis
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strconv"
 
 	"github.com/go-redis/redis/v8"
 
 	"crawler/pkg/model"
+	"crawler/pkg/store/compress"
 	"crawler/pkg/util"
 )
 
 const (
 	taskPrefix     = "task:"
 	responsePrefix = "response:"
+	sequencePrefix = "responseSeq:"
+	cookiesPrefix  = "cookies:"
+	deliveryPrefix = "deliveries:"
 	idKey          = "id"
 	urlKey         = "url"
 	intervalKey    = "interval"
+	methodKey      = "method"
+	headersKey     = "headers"
+	queryKey       = "query"
+	requestBodyKey = "requestBody"
+	userAgentKey   = "userAgent"
+	authKey        = "auth"
+	cookiesKey     = "cookies"
+	extractorsKey  = "extractors"
+	extractOnlyKey = "extractOnly"
+	extractedKey   = "extracted"
 	bodyKey        = "body"
 	durationKey    = "duration"
 	createdAtKey   = "createdAt"
+	outcomeKey     = "outcome"
+	statusCodeKey  = "statusCode"
+	etagKey        = "etag"
+	modifiedKey    = "lastModified"
+	notModifiedKey = "notModified"
+	bodyRefKey     = "bodyRef"
+	hashKey        = "hash"
+	changedKey     = "changed"
+	assertionsKey  = "assertions"
+	healthCheckKey = "healthCheck"
+	webhooksKey    = "webhooks"
+	scheduleKey    = "schedule"
+	intervalMsKey  = "intervalMs"
+	jitterMsKey    = "jitterMs"
+	plannedAtKey   = "plannedAtMs"
+	driftKey       = "driftMs"
+	quotaKey       = "quotaExceeded"
+	pausedKey      = "paused"
+	labelsKey      = "labels"
+	groupKey       = "group"
+	retentionKey   = "retention"
+	blobKeyField   = "blob"
+
+	// indexes of the tasks by the properties they are sorted and filtered by,
+	// their members are task keys
+	idIndex       = "tasks:id"
+	urlIndex      = "tasks:url"
+	intervalIndex = "tasks:interval"
+	createdIndex  = "tasks:created"
+	urlsKey       = "tasks:urls"
+	labelsIndex   = "tasks:labels"
+	pausedSet     = "tasks:paused"
+	failingSet    = "tasks:failing"
+	hostPrefix    = "tasks:host:"
+
+	groupsKey = "groups"
+
+	tenantPrefix = "tenant:"
 
 	removeAll = 0
 	lastElem  = -1
 
-	historyLimit = 100
+	historyLimit  = 100
+	deliveryLimit = 100
+
+	// createAttempts bounds retrying creates which raced others
+	createAttempts = 10
 )
 
 var (
-	taskKeys     = []string{idKey, urlKey, intervalKey}
-	responseKeys = []string{bodyKey, durationKey, createdAtKey}
+	taskKeys     = []string{idKey, urlKey, intervalKey, methodKey, headersKey, queryKey, requestBodyKey, userAgentKey, authKey, cookiesKey, extractorsKey, extractOnlyKey, assertionsKey, healthCheckKey, webhooksKey, scheduleKey, intervalMsKey, jitterMsKey, pausedKey, createdAtKey, labelsKey, groupKey, retentionKey}
+	responseKeys = []string{idKey, bodyKey, durationKey, createdAtKey, outcomeKey, statusCodeKey, etagKey, modifiedKey, notModifiedKey, bodyRefKey, hashKey, changedKey, blobKeyField, extractedKey, assertionsKey, plannedAtKey, driftKey, quotaKey}
 )
 
 type Store struct {
 	client *redis.Client
+	codec  compress.Codec
+}
+
+type Option func(*Store)
+
+// WithCompression compresses stored bodies of at least threshold bytes.
+func WithCompression(threshold int) Option {
+	return func(s *Store) {
+		s.codec.Threshold = threshold
+	}
+}
+
+func NewStore(client *redis.Client, opts ...Option) *Store {
+	s := &Store{client: client}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
 }
 
-func NewStore(client *redis.Client) *Store {
-	return &Store{client: client}
+func (s *Store) Ping(ctx context.Context) error {
+	err := s.client.Ping(ctx).Err()
+	if err != nil {
+		return util.Wrap(err, "pinging redis failed")
+	}
+
+	return nil
 }
 
 func (s *Store) Create(ctx context.Context, t *model.Task) error {
-	tasks := taskPrefix
-	task := taskPrefix + strconv.Itoa(t.Id)
+	return s.CreateLimited(ctx, t, 0)
+}
+
+func (s *Store) CreateLimited(ctx context.Context, t *model.Task, maxTasks int) error {
+	tasks := namespace(ctx, taskPrefix)
+	task := namespace(ctx, taskPrefix+strconv.Itoa(t.Id))
+
+	headers, err := json.Marshal(t.Headers)
+	if err != nil {
+		return util.Wrap(err, "headers encoding failed")
+	}
 
-	cmds, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
-		pipe.HSet(ctx, task, idKey, t.Id, urlKey, t.Url, intervalKey, t.Interval)
-		pipe.LPush(ctx, tasks, task)
+	query, err := json.Marshal(t.Query)
+	if err != nil {
+		return util.Wrap(err, "query encoding failed")
+	}
+
+	auth, err := json.Marshal(t.Auth)
+	if err != nil {
+		return util.Wrap(err, "auth encoding failed")
+	}
+
+	extractors, err := json.Marshal(t.Extractors)
+	if err != nil {
+		return util.Wrap(err, "extractors encoding failed")
+	}
+
+	assertions, err := json.Marshal(t.Assertions)
+	if err != nil {
+		return util.Wrap(err, "assertions encoding failed")
+	}
+
+	webhooks, err := json.Marshal(t.Webhooks)
+	if err != nil {
+		return util.Wrap(err, "webhooks encoding failed")
+	}
+
+	schedule, err := json.Marshal(t.Schedule)
+	if err != nil {
+		return util.Wrap(err, "schedule encoding failed")
+	}
+
+	labels, err := json.Marshal(t.Labels)
+	if err != nil {
+		return util.Wrap(err, "labels encoding failed")
+	}
+
+	// the transaction fails when a concurrent create or delete changes the task list or
+	// the task, so that neither the id nor the task limit is taken twice
+	save := func(tx *redis.Tx) error {
+		if maxTasks > 0 {
+			count, err := tx.LLen(ctx, tasks).Result()
+			if err != nil {
+				return util.Wrap(err, "counting tasks failed")
+			}
+
+			if count >= int64(maxTasks) {
+				return util.Wrap(util.ErrQuotaExceeded, fmt.Sprintf("at most %d tasks allowed", maxTasks))
+			}
+		}
+
+		taken, err := tx.HExists(ctx, task, idKey).Result()
+		if err != nil {
+			return util.Wrap(err, "checking task id failed")
+		}
+
+		if taken {
+			return util.Wrap(util.ErrConflict, "task id is taken")
+		}
+
+		var indexed int
+
+		cmds, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, task,
+				idKey, t.Id,
+				urlKey, t.Url,
+				intervalKey, t.Interval,
+				methodKey, t.Method,
+				headersKey, headers,
+				queryKey, query,
+				requestBodyKey, t.Body,
+				userAgentKey, t.UserAgent,
+				authKey, auth,
+				cookiesKey, t.Cookies,
+				extractorsKey, extractors,
+				extractOnlyKey, t.ExtractOnly,
+				assertionsKey, assertions,
+				healthCheckKey, t.HealthCheck,
+				webhooksKey, webhooks,
+				scheduleKey, schedule,
+				intervalMsKey, t.IntervalMs,
+				jitterMsKey, t.JitterMs,
+				pausedKey, t.Paused,
+				createdAtKey, t.CreatedAt,
+				labelsKey, labels,
+				groupKey, t.Group,
+				retentionKey, t.Retention,
+			)
+			pipe.LPush(ctx, tasks, task)
+			indexed = indexTask(ctx, pipe, task, t, labels)
+
+			return nil
+		})
+
+		if err == redis.TxFailedErr {
+			return err
+		}
+
+		if err != nil || len(cmds) != indexed+2 {
+			s.client.Del(ctx, task)
+			return util.Wrap(err, "saving task to DB failed")
+		}
 
 		return nil
-	})
+	}
 
-	if err != nil || len(cmds) != 2 {
-		return util.Wrap(err, "saving task to DB failed")
+	for i := 0; i < createAttempts; i++ {
+		err = s.client.Watch(ctx, save, tasks, task)
+		if err != redis.TxFailedErr {
+			return err
+		}
 	}
 
-	return nil
+	return util.Wrap(err, "saving task to DB failed")
 }
 
 func (s *Store) Get(ctx context.Context, id int) (*model.Task, error) {
-	task := taskPrefix + strconv.Itoa(id)
+	task := namespace(ctx, taskPrefix+strconv.Itoa(id))
 
 	properties, err := s.client.HGetAll(ctx, task).Result()
 	if err != nil {
@@ -70,42 +260,169 @@ func (s *Store) Get(ctx context.Context, id int) (*model.Task, error) {
 		return nil, util.ErrResourceNotFound
 	}
 
+	return parseTask(properties)
+}
+
+func parseTask(properties map[string]string) (*model.Task, error) {
+	id, err := strconv.Atoi(properties[idKey])
+	if err != nil {
+		return nil, util.Wrap(err, "id conversion failed")
+	}
+
 	interval, err := strconv.Atoi(properties[intervalKey])
 	if err != nil {
 		return nil, util.Wrap(err, "interval conversion failed")
 	}
 
-	return &model.Task{
-		Id:       id,
-		Url:      properties[urlKey],
-		Interval: interval,
-	}, nil
+	t := &model.Task{
+		Id:          id,
+		Url:         properties[urlKey],
+		Interval:    interval,
+		Method:      properties[methodKey],
+		Body:        properties[requestBodyKey],
+		UserAgent:   properties[userAgentKey],
+		Cookies:     properties[cookiesKey] == "1",
+		ExtractOnly: properties[extractOnlyKey] == "1",
+		HealthCheck: properties[healthCheckKey] == "1",
+		Paused:      properties[pausedKey] == "1",
+		Group:       properties[groupKey],
+	}
+
+	if err := unmarshalField(properties, headersKey, &t.Headers); err != nil {
+		return nil, util.Wrap(err, "headers conversion failed")
+	}
+
+	if err := unmarshalField(properties, queryKey, &t.Query); err != nil {
+		return nil, util.Wrap(err, "query conversion failed")
+	}
+
+	if err := unmarshalField(properties, authKey, &t.Auth); err != nil {
+		return nil, util.Wrap(err, "auth conversion failed")
+	}
+
+	if err := unmarshalField(properties, extractorsKey, &t.Extractors); err != nil {
+		return nil, util.Wrap(err, "extractors conversion failed")
+	}
+
+	if err := unmarshalField(properties, assertionsKey, &t.Assertions); err != nil {
+		return nil, util.Wrap(err, "assertions conversion failed")
+	}
+
+	if err := unmarshalField(properties, webhooksKey, &t.Webhooks); err != nil {
+		return nil, util.Wrap(err, "webhooks conversion failed")
+	}
+
+	if err := unmarshalField(properties, scheduleKey, &t.Schedule); err != nil {
+		return nil, util.Wrap(err, "schedule conversion failed")
+	}
+
+	if err := unmarshalField(properties, labelsKey, &t.Labels); err != nil {
+		return nil, util.Wrap(err, "labels conversion failed")
+	}
+
+	// fields missing in tasks stored by older versions are left at zero
+	if v, ok := properties[intervalMsKey]; ok {
+		if t.IntervalMs, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, util.Wrap(err, "interval conversion failed")
+		}
+	}
+
+	if v, ok := properties[jitterMsKey]; ok {
+		if t.JitterMs, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, util.Wrap(err, "jitter conversion failed")
+		}
+	}
+
+	if v, ok := properties[createdAtKey]; ok {
+		if t.CreatedAt, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, util.Wrap(err, "creation time conversion failed")
+		}
+	}
+
+	if v, ok := properties[retentionKey]; ok {
+		if t.Retention, err = strconv.Atoi(v); err != nil {
+			return nil, util.Wrap(err, "retention conversion failed")
+		}
+	}
+
+	return t, nil
+}
+
+// namespace returns the key of the context's tenant, keys of the default
+// tenant are not prefixed so that they stay compatible with older versions.
+func namespace(ctx context.Context, key string) string {
+	tenant := util.Tenant(ctx)
+	if tenant == "" {
+		return key
+	}
+
+	return tenantPrefix + tenant + ":" + key
+}
+
+// unmarshalField decodes a JSON encoded hash field, missing fields are left untouched.
+func unmarshalField(properties map[string]string, key string, v interface{}) error {
+	raw, ok := properties[key]
+	if !ok || raw == "" {
+		return nil
+	}
+
+	return json.Unmarshal([]byte(raw), v)
 }
 
 func (s *Store) Delete(ctx context.Context, id int) error {
-	tasks := taskPrefix
-	task := taskPrefix + strconv.Itoa(id)
+	tasks := namespace(ctx, taskPrefix)
+	task := namespace(ctx, taskPrefix+strconv.Itoa(id))
+	responses := namespace(ctx, responsePrefix+strconv.Itoa(id))
+
+	history, err := s.client.LRange(ctx, responses, 0, lastElem).Result()
+	if err != nil {
+		return util.Wrap(err, "getting list of task responses failed")
+	}
+
+	blobs, err := s.blobsOf(ctx, history)
+	if err != nil {
+		return err
+	}
+
+	taskUrl, err := s.client.HGet(ctx, task, urlKey).Result()
+	if err != nil && err != redis.Nil {
+		return util.Wrap(err, "getting task url failed")
+	}
+
+	var unindexed int
 
 	results, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		unindexed = unindexTask(ctx, pipe, task, taskUrl)
 		pipe.LRem(ctx, tasks, removeAll, task)
 		pipe.HDel(ctx, task, taskKeys...)
+		pipe.Del(ctx, namespace(ctx, cookiesPrefix+strconv.Itoa(id)))
+		pipe.Del(ctx, namespace(ctx, deliveryPrefix+strconv.Itoa(id)))
+		pipe.Del(ctx, responses)
+		pipe.Del(ctx, namespace(ctx, sequencePrefix+strconv.Itoa(id)))
+		for _, resp := range history {
+			pipe.Del(ctx, resp)
+		}
 
 		return nil
 	})
 
-	if err != nil || len(results) != 2 {
+	if err != nil || len(results) != unindexed+len(history)+6 {
 		return util.Wrap(err, "deleting task from DB failed")
 	}
 
-	return nil
+	return s.releaseBlobs(ctx, blobs)
 }
 
 func (s *Store) ListTasks(ctx context.Context) ([]*model.Task, error) {
-	tasks, err := s.client.LRange(ctx, taskPrefix, 0, lastElem).Result()
+	tasks, err := s.client.LRange(ctx, namespace(ctx, taskPrefix), 0, lastElem).Result()
 	if err != nil {
 		return nil, util.Wrap(err, "getting list of tasks failed")
 	}
 
+	return s.loadTasks(ctx, tasks)
+}
+
+func (s *Store) loadTasks(ctx context.Context, tasks []string) ([]*model.Task, error) {
 	results, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
 		for _, task := range tasks {
 			pipe.HGetAll(ctx, task)
@@ -126,28 +443,19 @@ func (s *Store) ListTasks(ctx context.Context) ([]*model.Task, error) {
 			return nil, util.Wrap(err, "fetching task properties failed")
 		}
 
-		id, err := strconv.Atoi(properties.Val()[idKey])
-		if err != nil {
-			return nil, util.Wrap(err, "interval conversion failed")
-		}
-
-		interval, err := strconv.Atoi(properties.Val()[intervalKey])
+		task, err := parseTask(properties.Val())
 		if err != nil {
-			return nil, util.Wrap(err, "interval conversion failed")
+			return nil, err
 		}
 
-		ret = append(ret, &model.Task{
-			Id:       id,
-			Url:      properties.Val()[urlKey],
-			Interval: interval,
-		})
+		ret = append(ret, task)
 	}
 
 	return ret, nil
 }
 
 func (s *Store) taskExists(ctx context.Context, id int) bool {
-	task := taskPrefix + strconv.Itoa(id)
+	task := namespace(ctx, taskPrefix+strconv.Itoa(id))
 
 	return s.client.HExists(ctx, task, urlKey).Val()
 }
@@ -157,43 +465,139 @@ func (s *Store) AddAttempt(ctx context.Context, id int, a *model.Attempt) error
 		return util.ErrResourceNotFound
 	}
 
-	err := s.historyCleanup(ctx, id)
+	// bodies are stored once per content in a blob, attempts only point to it. The blob
+	// is retained before the history is cleaned up, so that a 304 keeps the body of the
+	// attempt it replaces.
+	blob := blobKey(a)
+	if blob != "" {
+		retained, err := s.retainBlob(ctx, blob, a.Response)
+		if err != nil {
+			return err
+		}
+
+		if !retained {
+			blob = ""
+		}
+	}
+
+	err := s.addAttempt(ctx, id, a, blob)
+	if err != nil {
+		if blob != "" {
+			_ = s.releaseBlobs(ctx, []string{blob})
+		}
+
+		return err
+	}
+
+	err = s.historyCleanup(ctx, id, historyLimit)
 	if err != nil {
 		return util.Wrap(err, "history cleanup failed")
 	}
 
-	response := fmt.Sprintf("%s%d:%d", responsePrefix, id, a.CreatedAt)
-	responses := responsePrefix + strconv.Itoa(id)
+	return nil
+}
+
+// addAttempt stores the attempt pointing to the retained blob.
+func (s *Store) addAttempt(ctx context.Context, id int, a *model.Attempt, blob string) error {
+	seq, err := s.client.Incr(ctx, namespace(ctx, sequencePrefix+strconv.Itoa(id))).Result()
+	if err != nil {
+		return util.Wrap(err, "generating response id failed")
+	}
+
+	a.Id = seq
+
+	response := namespace(ctx, fmt.Sprintf("%s%d:%d", responsePrefix, id, a.Id))
+	responses := namespace(ctx, responsePrefix+strconv.Itoa(id))
+
+	extracted, err := json.Marshal(a.Extracted)
+	if err != nil {
+		return util.Wrap(err, "extracted values encoding failed")
+	}
+
+	assertions, err := json.Marshal(a.Assertions)
+	if err != nil {
+		return util.Wrap(err, "assertion results encoding failed")
+	}
+
+	// the attempt's hash and its entry in the history, and the failing set unless it was blocked
+	expected := 2
 
 	results, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
-		pipe.HSet(ctx, response, bodyKey, a.Response, durationKey, a.Duration, createdAtKey, a.CreatedAt)
+		pipe.HSet(ctx, response,
+			idKey, a.Id,
+			blobKeyField, blob,
+			durationKey, a.Duration,
+			createdAtKey, a.CreatedAt,
+			outcomeKey, a.Outcome,
+			statusCodeKey, a.StatusCode,
+			etagKey, a.ETag,
+			modifiedKey, a.LastModified,
+			notModifiedKey, a.NotModified,
+			bodyRefKey, a.BodyRef,
+			hashKey, a.Hash,
+			changedKey, a.Changed,
+			extractedKey, extracted,
+			assertionsKey, assertions,
+			plannedAtKey, a.PlannedAtMs,
+			driftKey, a.DriftMs,
+			quotaKey, a.QuotaExceeded,
+		)
 		pipe.RPush(ctx, responses, response)
 
+		switch {
+		case a.Outcome == model.OutcomeBlocked:
+		case a.Failed():
+			pipe.SAdd(ctx, namespace(ctx, failingSet), namespace(ctx, taskPrefix+strconv.Itoa(id)))
+			expected++
+		default:
+			pipe.SRem(ctx, namespace(ctx, failingSet), namespace(ctx, taskPrefix+strconv.Itoa(id)))
+			expected++
+		}
+
 		return nil
 	})
 
-	if err != nil || len(results) != 2 {
+	if err != nil || len(results) != expected {
 		return util.Wrap(err, "saving response to DB failed")
 	}
 
 	return nil
 }
 
-func (s *Store) historyCleanup(ctx context.Context, id int) error {
-	responses := responsePrefix + strconv.Itoa(id)
+// TrimAttempts removes all but the last keep attempts of a task.
+func (s *Store) TrimAttempts(ctx context.Context, id int, keep int) error {
+	if !s.taskExists(ctx, id) {
+		return util.ErrResourceNotFound
+	}
+
+	err := s.historyCleanup(ctx, id, int64(keep))
+	if err != nil {
+		return util.Wrap(err, "history cleanup failed")
+	}
+
+	return nil
+}
+
+func (s *Store) historyCleanup(ctx context.Context, id int, limit int64) error {
+	responses := namespace(ctx, responsePrefix+strconv.Itoa(id))
 
 	historySize := s.client.LLen(ctx, responses).Val()
-	if historySize <= historyLimit {
+	if historySize <= limit {
 		return nil
 	}
 
-	oldResponses, err := s.client.LRange(ctx, responses, 0, historySize-historyLimit-1).Result()
+	oldResponses, err := s.client.LRange(ctx, responses, 0, historySize-limit-1).Result()
 	if err != nil {
 		return util.Wrap(err, "getting list of task old responses failed")
 	}
 
+	blobs, err := s.blobsOf(ctx, oldResponses)
+	if err != nil {
+		return err
+	}
+
 	results, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
-		pipe.LTrim(ctx, responses, historySize-historyLimit, lastElem)
+		pipe.LTrim(ctx, responses, historySize-limit, lastElem)
 		for _, resp := range oldResponses {
 			pipe.HDel(ctx, resp, responseKeys...)
 		}
@@ -205,7 +609,7 @@ func (s *Store) historyCleanup(ctx context.Context, id int) error {
 		return util.Wrap(err, "removing old responses from DB failed")
 	}
 
-	return nil
+	return s.releaseBlobs(ctx, blobs)
 }
 
 func (s *Store) ListAttempts(ctx context.Context, id int) ([]*model.Attempt, error) {
@@ -213,7 +617,7 @@ func (s *Store) ListAttempts(ctx context.Context, id int) ([]*model.Attempt, err
 		return nil, util.ErrResourceNotFound
 	}
 
-	taskResponses := responsePrefix + strconv.Itoa(id)
+	taskResponses := namespace(ctx, responsePrefix+strconv.Itoa(id))
 	responses, err := s.client.LRange(ctx, taskResponses, 0, lastElem).Result()
 	if err != nil {
 		return nil, util.Wrap(err, "getting list of task responses failed")
@@ -232,6 +636,8 @@ func (s *Store) ListAttempts(ctx context.Context, id int) ([]*model.Attempt, err
 	}
 
 	ret := make([]*model.Attempt, 0, len(responses))
+	attemptBlobs := make([]string, 0, len(responses))
+	blobs := make(map[string]string)
 
 	for _, result := range results {
 		properties, ok := result.(*redis.StringStringMapCmd)
@@ -239,22 +645,229 @@ func (s *Store) ListAttempts(ctx context.Context, id int) ([]*model.Attempt, err
 			return nil, util.Wrap(err, "fetching response properties failed")
 		}
 
-		createdAt, err := strconv.ParseInt(properties.Val()[createdAtKey], 10, 64)
+		attempt, err := parseAttempt(properties.Val())
 		if err != nil {
-			return nil, util.Wrap(err, "timestamp conversion failed")
+			return nil, err
 		}
 
-		duration, err := strconv.ParseFloat(properties.Val()[durationKey], 64)
-		if err != nil {
-			return nil, util.Wrap(err, "duration conversion failed")
+		blob := properties.Val()[blobKeyField]
+		if blob != "" {
+			blobs[blob] = ""
 		}
 
-		ret = append(ret, &model.Attempt{
-			Response:  properties.Val()[bodyKey],
-			CreatedAt: createdAt,
-			Duration:  duration,
-		})
+		ret = append(ret, attempt)
+		attemptBlobs = append(attemptBlobs, blob)
+	}
+
+	err = s.loadBlobs(ctx, blobs)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, blob := range attemptBlobs {
+		if blob != "" {
+			ret[i].Response = blobs[blob]
+		}
 	}
 
 	return ret, nil
 }
+
+// LastAttempt reads the newest attempt's hash only, its body blob is not loaded.
+func (s *Store) LastAttempt(ctx context.Context, id int) (*model.Attempt, error) {
+	if !s.taskExists(ctx, id) {
+		return nil, util.ErrResourceNotFound
+	}
+
+	response, err := s.client.LIndex(ctx, namespace(ctx, responsePrefix+strconv.Itoa(id)), lastElem).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, util.Wrap(err, "getting last task response failed")
+	}
+
+	properties, err := s.client.HGetAll(ctx, response).Result()
+	if err != nil {
+		return nil, util.Wrap(err, "getting last response from DB failed")
+	}
+
+	a, err := parseAttempt(properties)
+	if err != nil {
+		return nil, err
+	}
+
+	// responses stored by older versions hold the body inline
+	a.Response = ""
+
+	return a, nil
+}
+
+func (s *Store) SaveCookies(ctx context.Context, id int, cookies []*model.Cookie) error {
+	if !s.taskExists(ctx, id) {
+		return util.ErrResourceNotFound
+	}
+
+	key := namespace(ctx, cookiesPrefix+strconv.Itoa(id))
+
+	if len(cookies) == 0 {
+		err := s.client.Del(ctx, key).Err()
+		if err != nil {
+			return util.Wrap(err, "clearing cookies failed")
+		}
+
+		return nil
+	}
+
+	encoded, err := json.Marshal(cookies)
+	if err != nil {
+		return util.Wrap(err, "cookies encoding failed")
+	}
+
+	err = s.client.Set(ctx, key, encoded, 0).Err()
+	if err != nil {
+		return util.Wrap(err, "saving cookies failed")
+	}
+
+	return nil
+}
+
+func (s *Store) ListCookies(ctx context.Context, id int) ([]*model.Cookie, error) {
+	if !s.taskExists(ctx, id) {
+		return nil, util.ErrResourceNotFound
+	}
+
+	encoded, err := s.client.Get(ctx, namespace(ctx, cookiesPrefix+strconv.Itoa(id))).Bytes()
+	if err == redis.Nil {
+		return []*model.Cookie{}, nil
+	} else if err != nil {
+		return nil, util.Wrap(err, "getting cookies failed")
+	}
+
+	var cookies []*model.Cookie
+
+	err = json.Unmarshal(encoded, &cookies)
+	if err != nil {
+		return nil, util.Wrap(err, "cookies conversion failed")
+	}
+
+	return cookies, nil
+}
+
+func (s *Store) AddDelivery(ctx context.Context, id int, d *model.Delivery) error {
+	if !s.taskExists(ctx, id) {
+		return util.ErrResourceNotFound
+	}
+
+	encoded, err := json.Marshal(d)
+	if err != nil {
+		return util.Wrap(err, "delivery encoding failed")
+	}
+
+	key := namespace(ctx, deliveryPrefix+strconv.Itoa(id))
+
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, key, encoded)
+		pipe.LTrim(ctx, key, -deliveryLimit, lastElem)
+
+		return nil
+	})
+
+	if err != nil {
+		return util.Wrap(err, "saving delivery failed")
+	}
+
+	return nil
+}
+
+func (s *Store) ListDeliveries(ctx context.Context, id int) ([]*model.Delivery, error) {
+	if !s.taskExists(ctx, id) {
+		return nil, util.ErrResourceNotFound
+	}
+
+	encoded, err := s.client.LRange(ctx, namespace(ctx, deliveryPrefix+strconv.Itoa(id)), 0, lastElem).Result()
+	if err != nil {
+		return nil, util.Wrap(err, "getting deliveries failed")
+	}
+
+	deliveries := make([]*model.Delivery, 0, len(encoded))
+	for _, e := range encoded {
+		var d model.Delivery
+
+		err = json.Unmarshal([]byte(e), &d)
+		if err != nil {
+			return nil, util.Wrap(err, "delivery conversion failed")
+		}
+
+		deliveries = append(deliveries, &d)
+	}
+
+	return deliveries, nil
+}
+
+func parseAttempt(properties map[string]string) (*model.Attempt, error) {
+	createdAt, err := strconv.ParseInt(properties[createdAtKey], 10, 64)
+	if err != nil {
+		return nil, util.Wrap(err, "timestamp conversion failed")
+	}
+
+	duration, err := strconv.ParseFloat(properties[durationKey], 64)
+	if err != nil {
+		return nil, util.Wrap(err, "duration conversion failed")
+	}
+
+	a := &model.Attempt{
+		Response:      properties[bodyKey],
+		CreatedAt:     createdAt,
+		Duration:      duration,
+		Outcome:       properties[outcomeKey],
+		ETag:          properties[etagKey],
+		LastModified:  properties[modifiedKey],
+		NotModified:   properties[notModifiedKey] == "1",
+		Hash:          properties[hashKey],
+		Changed:       properties[changedKey] == "1",
+		QuotaExceeded: properties[quotaKey] == "1",
+	}
+
+	if err := unmarshalField(properties, extractedKey, &a.Extracted); err != nil {
+		return nil, util.Wrap(err, "extracted values conversion failed")
+	}
+
+	if err := unmarshalField(properties, assertionsKey, &a.Assertions); err != nil {
+		return nil, util.Wrap(err, "assertion results conversion failed")
+	}
+
+	// numeric fields missing in responses stored by older versions are left at zero
+	if v, ok := properties[idKey]; ok {
+		if a.Id, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, util.Wrap(err, "id conversion failed")
+		}
+	}
+
+	if v, ok := properties[statusCodeKey]; ok {
+		if a.StatusCode, err = strconv.Atoi(v); err != nil {
+			return nil, util.Wrap(err, "status code conversion failed")
+		}
+	}
+
+	if v, ok := properties[bodyRefKey]; ok {
+		if a.BodyRef, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, util.Wrap(err, "body reference conversion failed")
+		}
+	}
+
+	if v, ok := properties[plannedAtKey]; ok {
+		if a.PlannedAtMs, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, util.Wrap(err, "planned time conversion failed")
+		}
+	}
+
+	if v, ok := properties[driftKey]; ok {
+		if a.DriftMs, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, util.Wrap(err, "drift conversion failed")
+		}
+	}
+
+	return a, nil
+}
@@ -7,10 +7,37 @@ import (
 )
 
 type Store interface {
+	// Create stores a new task, it fails with util.ErrConflict when the id is taken.
 	Create(ctx context.Context, task *model.Task) error
+	// CreateLimited stores a new task unless the context's tenant has maxTasks tasks already,
+	// then it fails with util.ErrQuotaExceeded. Counting and storing is atomic, a zero
+	// maxTasks means no limit.
+	CreateLimited(ctx context.Context, task *model.Task, maxTasks int) error
 	Get(ctx context.Context, id int) (*model.Task, error)
 	Delete(ctx context.Context, id int) error
 	ListTasks(ctx context.Context) ([]*model.Task, error)
+	// QueryTasks returns a page of tasks and the number of all tasks matching the query.
+	QueryTasks(ctx context.Context, q *model.TaskQuery) ([]*model.Task, int, error)
+	SetPaused(ctx context.Context, id int, paused bool) error
 	AddAttempt(ctx context.Context, id int, attempt *model.Attempt) error
 	ListAttempts(ctx context.Context, id int) ([]*model.Attempt, error)
+	// LastAttempt returns the newest attempt of a task without its body, nil when it has none.
+	LastAttempt(ctx context.Context, id int) (*model.Attempt, error)
+	// TrimAttempts removes all but the last keep attempts of a task.
+	TrimAttempts(ctx context.Context, id int, keep int) error
+	SaveCookies(ctx context.Context, id int, cookies []*model.Cookie) error
+	ListCookies(ctx context.Context, id int) ([]*model.Cookie, error)
+	AddDelivery(ctx context.Context, id int, delivery *model.Delivery) error
+	ListDeliveries(ctx context.Context, id int) ([]*model.Delivery, error)
+	SaveGroup(ctx context.Context, group *model.Group) error
+	GetGroup(ctx context.Context, name string) (*model.Group, error)
+	ListGroups(ctx context.Context) ([]*model.Group, error)
+	DeleteGroup(ctx context.Context, name string) error
+	// AddAuditEntry appends an entry to the audit trail and sets its id.
+	AddAuditEntry(ctx context.Context, entry *model.AuditEntry) error
+	// ListAuditEntries returns the entries matching the query, newest first.
+	ListAuditEntries(ctx context.Context, q *model.AuditQuery) ([]*model.AuditEntry, error)
+	Stats(ctx context.Context) (*model.StorageStats, error)
+	// Ping tells whether the store is reachable.
+	Ping(ctx context.Context) error
 }
@@ -0,0 +1,89 @@
+// Package storetest holds tests every store.Store implementation has to pass.
+package storetest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"crawler/pkg/model"
+	"crawler/pkg/store"
+	"crawler/pkg/util"
+)
+
+// historyLimit is the number of attempts the stores keep per task.
+const historyLimit = 100
+
+func hash(body string) string {
+	sum := sha256.Sum256([]byte(body))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// NotModified checks that attempts answered with 304 keep the body of the attempt they
+// refer to, also when it is dropped from the history at the same time, and that they
+// store no body once it is gone. It works in its own tenant.
+func NotModified(t *testing.T, s store.Store) {
+	ctx := util.WithTenant(context.Background(), "storetest")
+
+	// leftovers of an earlier run
+	_ = s.Delete(ctx, 1)
+
+	err := s.Create(ctx, &model.Task{Id: 1, Url: "http://localhost", Interval: 60})
+	require.NoError(t, err)
+
+	defer func() { _ = s.Delete(ctx, 1) }()
+
+	full := &model.Attempt{Response: "body", Hash: hash("body"), Outcome: model.OutcomeSuccess}
+	err = s.AddAttempt(ctx, 1, full)
+	require.NoError(t, err)
+
+	for i := 1; i < historyLimit; i++ {
+		err = s.AddAttempt(ctx, 1, &model.Attempt{Response: "other", Hash: hash("other"), Outcome: model.OutcomeSuccess})
+		require.NoError(t, err)
+	}
+
+	// the history is full, the 304 pushes out the only other attempt with the body
+	err = s.AddAttempt(ctx, 1, &model.Attempt{NotModified: true, BodyRef: full.Id, Hash: full.Hash, Outcome: model.OutcomeSuccess})
+	require.NoError(t, err)
+
+	attempts, err := s.ListAttempts(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, attempts, historyLimit)
+	assert.Equal(t, "other", attempts[0].Response)
+	assert.Equal(t, "body", attempts[historyLimit-1].Response)
+
+	stats, err := s.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Blobs)
+
+	// the body a 304 refers to is gone once no attempt holds it anymore
+	err = s.TrimAttempts(ctx, 1, 0)
+	require.NoError(t, err)
+
+	err = s.AddAttempt(ctx, 1, &model.Attempt{NotModified: true, BodyRef: full.Id, Hash: full.Hash, Outcome: model.OutcomeSuccess})
+	require.NoError(t, err)
+
+	attempts, err = s.ListAttempts(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, attempts, 1)
+	assert.Empty(t, attempts[0].Response)
+
+	stats, err = s.Stats(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, stats.Blobs)
+
+	// trimming releases nothing the 304 did not hold
+	err = s.TrimAttempts(ctx, 1, 0)
+	require.NoError(t, err)
+
+	stats, err = s.Stats(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, stats.Blobs)
+	assert.Zero(t, stats.RawBytes)
+	assert.Zero(t, stats.StoredBytes)
+}
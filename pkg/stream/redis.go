@@ -0,0 +1,67 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/go-redis/redis/v8"
+
+	"crawler/pkg/logging"
+	"crawler/pkg/util"
+)
+
+const channel = "attempts"
+
+// Relay publishes messages through redis pub/sub, so that they reach the
+// subscribers of every replica sharing the redis instance.
+type Relay struct {
+	client      *redis.Client
+	broadcaster *Broadcaster
+}
+
+func NewRelay(client *redis.Client, broadcaster *Broadcaster) *Relay {
+	return &Relay{client: client, broadcaster: broadcaster}
+}
+
+func (r *Relay) Publish(ctx context.Context, m *Message) error {
+	encoded, err := json.Marshal(m)
+	if err != nil {
+		return util.Wrap(err, "message encoding failed")
+	}
+
+	err = r.client.Publish(ctx, channel, encoded).Err()
+	if err != nil {
+		return util.Wrap(err, "publishing message failed")
+	}
+
+	return nil
+}
+
+// Run passes messages received from redis to the local broadcaster until the context is done.
+func (r *Relay) Run(ctx context.Context) {
+	pubsub := r.client.Subscribe(ctx, channel)
+	defer util.MustClose(pubsub)
+
+	messages := pubsub.Channel()
+
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+
+			var m Message
+
+			err := json.Unmarshal([]byte(msg.Payload), &m)
+			if err != nil {
+				logging.Default().Error("decoding relayed message failed", "error", err)
+				continue
+			}
+
+			_ = r.broadcaster.Publish(ctx, &m)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
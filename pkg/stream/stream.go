@@ -0,0 +1,93 @@
+package stream
+
+import (
+	"context"
+	"sync"
+
+	"crawler/pkg/model"
+)
+
+const (
+	// AllTasks subscribes to attempts of every task.
+	AllTasks = -1
+
+	bufferSize = 64
+)
+
+// Message announces an attempt which was just stored.
+type Message struct {
+	Tenant  string         `json:"tenant,omitempty"`
+	TaskId  int            `json:"task_id"`
+	Attempt *model.Attempt `json:"attempt"`
+}
+
+type Publisher interface {
+	Publish(ctx context.Context, m *Message) error
+}
+
+type Subscription struct {
+	// C is closed when the subscriber could not keep up, it is expected to
+	// reconnect and resume from the last message it received.
+	C <-chan *Message
+
+	tenant string
+	taskId int
+	c      chan *Message
+}
+
+// Broadcaster passes published messages to the subscribers in this process.
+type Broadcaster struct {
+	subscriptions map[*Subscription]struct{}
+	mutex         sync.Mutex
+}
+
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{subscriptions: make(map[*Subscription]struct{})}
+}
+
+// Subscribe receives the messages of a task or of all tasks (AllTasks) of the tenant.
+func (b *Broadcaster) Subscribe(tenant string, taskId int) *Subscription {
+	c := make(chan *Message, bufferSize)
+	s := &Subscription{C: c, tenant: tenant, taskId: taskId, c: c}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.subscriptions[s] = struct{}{}
+
+	return s
+}
+
+func (b *Broadcaster) Unsubscribe(s *Subscription) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.remove(s)
+}
+
+func (b *Broadcaster) remove(s *Subscription) {
+	if _, found := b.subscriptions[s]; found {
+		delete(b.subscriptions, s)
+		close(s.c)
+	}
+}
+
+// Publish never blocks, subscribers with a full buffer are dropped.
+func (b *Broadcaster) Publish(ctx context.Context, m *Message) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for s := range b.subscriptions {
+		if s.tenant != m.Tenant || s.taskId != AllTasks && s.taskId != m.TaskId {
+			continue
+		}
+
+		select {
+		case s.c <- m:
+		default:
+			b.remove(s)
+		}
+	}
+
+	return nil
+}
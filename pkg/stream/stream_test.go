@@ -0,0 +1,56 @@
+// +build unit !integration
+
+package stream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"crawler/pkg/model"
+)
+
+func TestBroadcaster(t *testing.T) {
+	b := NewBroadcaster()
+
+	all := b.Subscribe("", AllTasks)
+	one := b.Subscribe("", 1)
+	other := b.Subscribe("other", AllTasks)
+
+	m1 := &Message{TaskId: 1, Attempt: &model.Attempt{Id: 1}}
+	m2 := &Message{TaskId: 2, Attempt: &model.Attempt{Id: 1}}
+
+	require.NoError(t, b.Publish(context.Background(), m1))
+	require.NoError(t, b.Publish(context.Background(), m2))
+
+	assert.Equal(t, m1, <-all.C)
+	assert.Equal(t, m2, <-all.C)
+	assert.Equal(t, m1, <-one.C)
+	assert.Len(t, one.C, 0)
+	assert.Len(t, other.C, 0)
+
+	b.Unsubscribe(one)
+	_, ok := <-one.C
+	assert.False(t, ok)
+
+	// unsubscribing twice is fine
+	b.Unsubscribe(one)
+}
+
+func TestBroadcasterDropsSlowSubscribers(t *testing.T) {
+	b := NewBroadcaster()
+	s := b.Subscribe("", AllTasks)
+
+	for i := 0; i <= bufferSize; i++ {
+		require.NoError(t, b.Publish(context.Background(), &Message{Attempt: &model.Attempt{Id: int64(i)}}))
+	}
+
+	received := 0
+	for range s.C {
+		received++
+	}
+
+	assert.Equal(t, bufferSize, received)
+}
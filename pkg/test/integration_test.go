@@ -13,6 +13,8 @@ import (
 	"testing"
 	"time"
 
+	redis_db "crawler/pkg/store/redis"
+	"crawler/pkg/store/storetest"
 	"crawler/pkg/util"
 
 	"github.com/go-redis/redis/v8"
@@ -25,6 +27,7 @@ const (
 	responderUrlFormat = "http://responder:8080/range/%d"
 	createTaskUrl      = "http://crawler:8080/api/fetcher"
 	getTaskUrlFormat   = "http://crawler:8080/api/fetcher/%s/history"
+	taskUrlFormat      = "http://crawler:8080/api/fetcher/%s"
 )
 
 var (
@@ -100,3 +103,48 @@ func TestFull(t *testing.T) {
 		assert.Equal(t, responseSize, len(response))
 	}
 }
+
+func TestDelete(t *testing.T) {
+	url := fmt.Sprintf(responderUrlFormat, 10)
+	payload := fmt.Sprintf(`{"url": "%s", "interval": 1}`, url)
+
+	resp, err := http.Post(createTaskUrl, "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	id := resp.Header.Get("Location")
+	ctx := context.Background()
+
+	// wait for the first attempt to number the responses
+	for i := 0; i < 10; i++ {
+		time.Sleep(time.Second)
+
+		n, err := rdb.Exists(ctx, "responseSeq:"+id).Result()
+		require.NoError(t, err)
+		if n > 0 {
+			break
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf(taskUrlFormat, id), nil)
+	require.NoError(t, err)
+
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	for _, key := range []string{"task:" + id, "response:" + id, "responseSeq:" + id} {
+		n, err := rdb.Exists(ctx, key).Result()
+		require.NoError(t, err)
+		assert.Zero(t, n, key)
+	}
+}
+
+func TestNotModifiedHistory(t *testing.T) {
+	storetest.NotModified(t, redis_db.NewStore(rdb))
+
+	// no blob without a body is left behind for the 304 whose body was gone
+	keys, err := rdb.Keys(context.Background(), "tenant:storetest:blob:*").Result()
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+}
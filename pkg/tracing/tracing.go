@@ -0,0 +1,275 @@
+// Package tracing records spans through the OpenTelemetry API and exports finished
+// spans as JSON lines, so that traces can be followed locally without a collector.
+// Until a provider is installed with Install, spans are not recorded at all.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/api/global"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/propagators"
+)
+
+// instrumentation names the tracer of the service's own spans.
+const instrumentation = "crawler"
+
+// Provider creates tracers whose spans are exported when they end.
+type Provider struct {
+	exporter Exporter
+}
+
+func NewProvider(exporter Exporter) *Provider {
+	return &Provider{exporter: exporter}
+}
+
+// Install makes the provider the global one, so that spans of libraries like the
+// redis client are recorded as well.
+func Install(p *Provider) {
+	global.SetTracerProvider(p)
+}
+
+func (p *Provider) Tracer(name string, _ ...trace.TracerOption) trace.Tracer {
+	return &tracer{provider: p, name: name}
+}
+
+type tracer struct {
+	provider *Provider
+	name     string
+}
+
+// Start starts a span which is a child of the context's span or of the remote span
+// extracted from an incoming request. Every trace is sampled.
+func (t *tracer) Start(ctx context.Context, name string, opts ...trace.SpanOption) (context.Context, trace.Span) {
+	cfg := trace.NewSpanConfig(opts...)
+
+	var parent trace.SpanContext
+	if !cfg.NewRoot {
+		parent = trace.SpanFromContext(ctx).SpanContext()
+		if !parent.IsValid() {
+			parent = trace.RemoteSpanContextFromContext(ctx)
+		}
+	}
+
+	sc := trace.SpanContext{TraceID: parent.TraceID, TraceFlags: trace.FlagsSampled}
+	if !parent.IsValid() {
+		_, _ = rand.Read(sc.TraceID[:])
+	}
+
+	_, _ = rand.Read(sc.SpanID[:])
+
+	start := cfg.Timestamp
+	if start.IsZero() {
+		start = time.Now()
+	}
+
+	s := &span{
+		tracer:     t,
+		name:       name,
+		context:    sc,
+		parent:     parent.SpanID,
+		kind:       cfg.SpanKind,
+		start:      start,
+		attributes: make(map[string]interface{}),
+	}
+	s.SetAttributes(cfg.Attributes...)
+
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+type span struct {
+	tracer     *tracer
+	name       string
+	context    trace.SpanContext
+	parent     trace.SpanID
+	kind       trace.SpanKind
+	start      time.Time
+	end        time.Time
+	attributes map[string]interface{}
+	events     []Event
+	status     codes.Code
+	message    string
+	mutex      sync.Mutex
+}
+
+func (s *span) Tracer() trace.Tracer {
+	return s.tracer
+}
+
+// End exports the span, later calls are ignored.
+func (s *span) End(opts ...trace.SpanOption) {
+	cfg := trace.NewSpanConfig(opts...)
+
+	s.mutex.Lock()
+	if !s.end.IsZero() {
+		s.mutex.Unlock()
+		return
+	}
+
+	s.end = cfg.Timestamp
+	if s.end.IsZero() {
+		s.end = time.Now()
+	}
+
+	data := s.data()
+	s.mutex.Unlock()
+
+	s.tracer.provider.exporter.Export(data)
+}
+
+func (s *span) AddEvent(ctx context.Context, name string, attrs ...label.KeyValue) {
+	s.AddEventWithTimestamp(ctx, time.Now(), name, attrs...)
+}
+
+func (s *span) AddEventWithTimestamp(_ context.Context, timestamp time.Time, name string, attrs ...label.KeyValue) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.end.IsZero() {
+		return
+	}
+
+	e := Event{Name: name, Time: timestamp}
+	if len(attrs) > 0 {
+		e.Attributes = make(map[string]interface{}, len(attrs))
+		for _, kv := range attrs {
+			e.Attributes[string(kv.Key)] = kv.Value.AsInterface()
+		}
+	}
+
+	s.events = append(s.events, e)
+}
+
+func (s *span) IsRecording() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.end.IsZero()
+}
+
+func (s *span) RecordError(ctx context.Context, err error, opts ...trace.ErrorOption) {
+	if err == nil {
+		return
+	}
+
+	cfg := &trace.ErrorConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	timestamp := cfg.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	if cfg.StatusCode != codes.OK {
+		s.SetStatus(cfg.StatusCode, "")
+	}
+
+	s.AddEventWithTimestamp(ctx, timestamp, "error", label.String("error.message", err.Error()))
+}
+
+func (s *span) SpanContext() trace.SpanContext {
+	return s.context
+}
+
+func (s *span) SetStatus(code codes.Code, msg string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.status = code
+	s.message = msg
+}
+
+func (s *span) SetName(name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.name = name
+}
+
+func (s *span) SetAttributes(kv ...label.KeyValue) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, a := range kv {
+		s.attributes[string(a.Key)] = a.Value.AsInterface()
+	}
+}
+
+func (s *span) SetAttribute(k string, v interface{}) {
+	s.SetAttributes(label.Any(k, v))
+}
+
+// data copies the span for the exporter, the mutex must be held.
+func (s *span) data() *SpanData {
+	d := &SpanData{
+		TraceId:    s.context.TraceID.String(),
+		SpanId:     s.context.SpanID.String(),
+		Name:       s.name,
+		Kind:       s.kind.String(),
+		Scope:      s.tracer.name,
+		Start:      s.start,
+		End:        s.end,
+		DurationMs: float64(s.end.Sub(s.start)) / float64(time.Millisecond),
+		Attributes: make(map[string]interface{}, len(s.attributes)),
+		Events:     append([]Event(nil), s.events...),
+		Status:     "ok",
+		Message:    s.message,
+	}
+
+	if s.parent.IsValid() {
+		d.ParentId = s.parent.String()
+	}
+
+	if s.status != codes.OK {
+		d.Status = "error"
+	}
+
+	for k, v := range s.attributes {
+		d.Attributes[k] = v
+	}
+
+	return d
+}
+
+// Start starts a span of the service.
+func Start(ctx context.Context, name string, kv ...label.KeyValue) (context.Context, trace.Span) {
+	return global.Tracer(instrumentation).Start(ctx, name, trace.WithAttributes(kv...))
+}
+
+// End ends the span, failing it with the error if there is one.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(context.Background(), err, trace.WithErrorStatus(codes.Unknown))
+	}
+
+	span.End()
+}
+
+// Inject adds the traceparent header of the context's span to an outgoing request.
+func Inject(ctx context.Context, header http.Header) {
+	propagators.TraceContext{}.Inject(ctx, header)
+}
+
+// Extract returns a context whose spans continue the trace of an incoming request.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return propagators.TraceContext{}.Extract(ctx, header)
+}
+
+// WithParent returns a context whose spans are children of the span, which may have
+// ended, instead of the context's current span.
+func WithParent(ctx context.Context, parent trace.SpanContext) context.Context {
+	if !parent.IsValid() {
+		return ctx
+	}
+
+	// without a current span new spans continue the remote one
+	return trace.ContextWithRemoteSpanContext(trace.ContextWithSpan(ctx, nil), parent)
+}
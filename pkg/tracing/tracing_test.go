@@ -0,0 +1,93 @@
+// +build unit !integration
+
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/api/global"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/label"
+)
+
+type recorder struct {
+	spans []*SpanData
+	mutex sync.Mutex
+}
+
+func (r *recorder) Export(span *SpanData) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.spans = append(r.spans, span)
+}
+
+func TestSpans(t *testing.T) {
+	exported := &recorder{}
+	tracer := NewProvider(exported).Tracer("test")
+
+	ctx, parent := tracer.Start(context.Background(), "parent", trace.WithAttributes(label.Int("task.id", 1)))
+	_, child := tracer.Start(ctx, "child")
+
+	child.RecordError(ctx, errors.New("boom"), trace.WithErrorStatus(2))
+	child.End()
+	child.End()
+	parent.End()
+
+	require.Len(t, exported.spans, 2)
+
+	c, p := exported.spans[0], exported.spans[1]
+	assert.Equal(t, "child", c.Name)
+	assert.Equal(t, p.TraceId, c.TraceId)
+	assert.Equal(t, p.SpanId, c.ParentId)
+	assert.Equal(t, "error", c.Status)
+	require.Len(t, c.Events, 1)
+	assert.Equal(t, "boom", c.Events[0].Attributes["error.message"])
+
+	assert.Empty(t, p.ParentId)
+	assert.Equal(t, "ok", p.Status)
+	assert.Equal(t, int64(1), p.Attributes["task.id"])
+	assert.Equal(t, "test", p.Scope)
+}
+
+func TestPropagation(t *testing.T) {
+	previous := global.TracerProvider()
+	defer global.SetTracerProvider(previous)
+
+	exported := &recorder{}
+	Install(NewProvider(exported))
+
+	incoming := http.Header{}
+	incoming.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+
+	ctx, span := Start(Extract(context.Background(), incoming), "request")
+
+	outgoing := http.Header{}
+	Inject(ctx, outgoing)
+	End(span, nil)
+
+	require.Len(t, exported.spans, 1)
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", exported.spans[0].TraceId)
+	assert.Equal(t, "b7ad6b7169203331", exported.spans[0].ParentId)
+	assert.Equal(t, "00-0af7651916cd43dd8448eb211c80319c-"+exported.spans[0].SpanId+"-01", outgoing.Get("traceparent"))
+}
+
+func TestWriterExporter(t *testing.T) {
+	var buf bytes.Buffer
+
+	_, span := NewProvider(NewWriterExporter(&buf)).Tracer("test").Start(context.Background(), "span")
+	span.End()
+
+	var data SpanData
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &data))
+	assert.Equal(t, "span", data.Name)
+	assert.Len(t, data.TraceId, 32)
+}
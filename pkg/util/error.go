@@ -27,6 +27,10 @@ func EmitHttpError(w http.ResponseWriter, err error) {
 		http.Error(w, "", http.StatusNotFound)
 	} else if errors.Is(err, ErrValidation) {
 		http.Error(w, "", http.StatusBadRequest)
+	} else if errors.Is(err, ErrQuotaExceeded) {
+		http.Error(w, "", http.StatusForbidden)
+	} else if errors.Is(err, ErrConflict) {
+		http.Error(w, "", http.StatusConflict)
 	} else {
 		http.Error(w, "", http.StatusInternalServerError)
 	}
@@ -35,4 +39,6 @@ func EmitHttpError(w http.ResponseWriter, err error) {
 var (
 	ErrResourceNotFound = errors.New("resource not found")
 	ErrValidation       = errors.New("invalid request")
+	ErrQuotaExceeded    = errors.New("quota exceeded")
+	ErrConflict         = errors.New("conflict")
 )
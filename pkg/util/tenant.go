@@ -0,0 +1,17 @@
+package util
+
+import "context"
+
+type tenantKey struct{}
+
+// WithTenant scopes store operations done with the context to the tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// Tenant returns the tenant of the context, the default tenant is the empty string.
+func Tenant(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+
+	return tenant
+}